@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/admission"
+	"github.com/google/uuid"
+)
+
+// processingFileCopies is roughly how many copies of an upload exist on disk
+// at once while it's processed: the upload, the intermediate stage output and
+// the fast start output.
+const processingFileCopies = 3
+
+type processingAdmission struct {
+	limiter     *admission.Limiter
+	minFreeDisk uint64
+	retryAfter  time.Duration
+	// freeDiskSpace measures the temp dir, admission.FreeDiskSpace if nil.
+	freeDiskSpace func(path string) (uint64, error)
+
+	mu sync.Mutex
+	// reservedDisk is what admitted jobs may still write to the temp dir.
+	// It counts a job's files in full until it finishes, even once some are
+	// on disk and already missing from the free space, so it errs towards
+	// refusing work.
+	reservedDisk uint64
+}
+
+// loadProcessingAdmission reads the job limits from the environment.
+// PROCESSING_MAX_JOBS caps concurrent jobs across all users,
+// PROCESSING_MAX_JOBS_PER_USER caps a single user's running and queued jobs,
+// and up to PROCESSING_QUEUE_SIZE jobs wait PROCESSING_QUEUE_TIMEOUT for a
+// slot before being refused. MIN_FREE_DISK_BYTES is kept free in the temp dir.
+func loadProcessingAdmission() (*processingAdmission, error) {
+	cfg := admission.Config{
+		MaxJobs:        runtime.NumCPU(),
+		MaxJobsPerUser: 2,
+		MaxQueued:      10,
+		MaxWait:        30 * time.Second,
+	}
+	minFreeDisk := uint64(1 << 30)
+
+	var err error
+	for name, value := range map[string]*int{
+		"PROCESSING_MAX_JOBS":          &cfg.MaxJobs,
+		"PROCESSING_MAX_JOBS_PER_USER": &cfg.MaxJobsPerUser,
+		"PROCESSING_QUEUE_SIZE":        &cfg.MaxQueued,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			*value, err = strconv.Atoi(raw)
+			if err != nil || *value < 0 {
+				return nil, fmt.Errorf("invalid %s %q", name, raw)
+			}
+		}
+	}
+	if cfg.MaxJobs < 1 {
+		return nil, fmt.Errorf("PROCESSING_MAX_JOBS must be at least 1")
+	}
+	if raw := os.Getenv("PROCESSING_QUEUE_TIMEOUT"); raw != "" {
+		cfg.MaxWait, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PROCESSING_QUEUE_TIMEOUT: %w", err)
+		}
+	}
+	if raw := os.Getenv("MIN_FREE_DISK_BYTES"); raw != "" {
+		minFreeDisk, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MIN_FREE_DISK_BYTES: %w", err)
+		}
+	}
+
+	retryAfter := cfg.MaxWait
+	if retryAfter < 5*time.Second {
+		retryAfter = 5 * time.Second
+	}
+
+	return &processingAdmission{
+		limiter:     admission.NewLimiter(cfg),
+		minFreeDisk: minFreeDisk,
+		retryAfter:  retryAfter,
+	}, nil
+}
+
+// admitProcessingJob reserves disk space for expectedBytes of input and a
+// processing slot for the user. When it returns false it has already written
+// a 429 or 503 response; otherwise the caller must call release.
+func (cfg *apiConfig) admitProcessingJob(w http.ResponseWriter, r *http.Request, userID uuid.UUID, expectedBytes int64) (func(), bool) {
+	releaseDisk, ok := cfg.reserveProcessingDiskSpace(w, expectedBytes)
+	if !ok {
+		return nil, false
+	}
+	releaseSlot, ok := cfg.acquireProcessingSlot(w, r, userID)
+	if !ok {
+		releaseDisk()
+		return nil, false
+	}
+	return func() {
+		releaseSlot()
+		releaseDisk()
+	}, true
+}
+
+// reserveProcessingDiskSpace is the cheap half of admission, for uploads to
+// run before reading the body. It sets aside room for the copies of
+// expectedBytes a job makes, so concurrent jobs can't each pass a check sized
+// for one. When it returns false it has already written a response; otherwise
+// the caller must call release once the job's files are gone.
+func (cfg *apiConfig) reserveProcessingDiskSpace(w http.ResponseWriter, expectedBytes int64) (func(), bool) {
+	p := cfg.processing
+	freeDiskSpace := p.freeDiskSpace
+	if freeDiskSpace == nil {
+		freeDiskSpace = admission.FreeDiskSpace
+	}
+	free, err := freeDiskSpace(os.TempDir())
+	if err != nil && !errors.Is(err, admission.ErrDiskSpaceUnsupported) {
+		respondWithError(w, http.StatusInternalServerError, "Unable to check free disk space", err)
+		return nil, false
+	}
+
+	var reserve uint64
+	if expectedBytes > 0 {
+		reserve = uint64(expectedBytes) * processingFileCopies
+	}
+
+	p.mu.Lock()
+	if err == nil {
+		available := uint64(0)
+		if free > p.reservedDisk {
+			available = free - p.reservedDisk
+		}
+		required := p.minFreeDisk + reserve
+		if available < required {
+			reserved := p.reservedDisk
+			p.mu.Unlock()
+			cfg.respondRetryLater(w, http.StatusServiceUnavailable, "Not enough disk space to process the video, try again later",
+				fmt.Errorf("%d bytes free in %s with %d reserved, need %d", free, os.TempDir(), reserved, required))
+			return nil, false
+		}
+	}
+	p.reservedDisk += reserve
+	p.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.reservedDisk -= reserve
+		})
+	}, true
+}
+
+// acquireProcessingSlot reserves one of the processing slots for the user,
+// waiting in the queue if needed. Take it once the input is on disk, so slots
+// cap ffmpeg work rather than slow uploads.
+func (cfg *apiConfig) acquireProcessingSlot(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (func(), bool) {
+	release, err := cfg.processing.limiter.Acquire(r.Context(), userID.String())
+	switch {
+	case errors.Is(err, admission.ErrUserLimit):
+		cfg.respondRetryLater(w, http.StatusTooManyRequests, "You already have too many videos processing", err)
+		return nil, false
+	case errors.Is(err, admission.ErrQueueFull), errors.Is(err, admission.ErrWaitTimeout):
+		cfg.respondRetryLater(w, http.StatusServiceUnavailable, "The server is busy processing other videos, try again later", err)
+		return nil, false
+	case err != nil:
+		respondWithError(w, http.StatusServiceUnavailable, "Request cancelled while waiting for a processing slot", err)
+		return nil, false
+	}
+	return release, true
+}
+
+func (cfg *apiConfig) respondRetryLater(w http.ResponseWriter, code int, msg string, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(cfg.processing.retryAfter.Seconds())))
+	respondWithError(w, code, msg, err)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReserveProcessingDiskSpace(t *testing.T) {
+	cfg := newTestAPIConfig()
+	cfg.processing.minFreeDisk = 1000
+	cfg.processing.freeDiskSpace = func(path string) (uint64, error) {
+		return 10000, nil
+	}
+
+	reserve := func(expectedBytes int64) (func(), int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		release, ok := cfg.reserveProcessingDiskSpace(rec, expectedBytes)
+		if !ok {
+			return nil, rec.Code
+		}
+		return release, http.StatusOK
+	}
+
+	// Each 1000 byte job sets aside three copies, so three fit above the
+	// minimum and a fourth doesn't, however free the disk still looks.
+	releases := []func(){}
+	for i := range 3 {
+		release, code := reserve(1000)
+		if code != http.StatusOK {
+			t.Fatalf("job %d = %d", i+1, code)
+		}
+		releases = append(releases, release)
+	}
+	if _, code := reserve(1000); code != http.StatusServiceUnavailable {
+		t.Fatalf("job over the reserved space = %d", code)
+	}
+
+	// Releasing is idempotent and frees the room for another job.
+	releases[0]()
+	releases[0]()
+	if cfg.processing.reservedDisk != 6000 {
+		t.Errorf("reserved after releasing one job = %d", cfg.processing.reservedDisk)
+	}
+	release, code := reserve(1000)
+	if code != http.StatusOK {
+		t.Fatalf("job after a release = %d", code)
+	}
+	release()
+
+	// A job refused a slot gives its disk space back.
+	userID := uuid.New()
+	releaseSlot, err := cfg.processing.limiter.Acquire(context.Background(), userID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseSlot()
+	rec := httptest.NewRecorder()
+	if _, ok := cfg.admitProcessingJob(rec, httptest.NewRequest(http.MethodPost, "/", nil), userID, 1000); ok || rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("job over the user's limit = %d", rec.Code)
+	}
+	if cfg.processing.reservedDisk != 6000 {
+		t.Errorf("refused job kept its reservation: %d reserved", cfg.processing.reservedDisk)
+	}
+}
@@ -188,18 +188,27 @@ const videoStateHandler = createVideoStateHandler();
 
 async function getVideos() {
   try {
-    const res = await fetch('/api/videos', {
-      method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
-    });
-    if (!res.ok) {
+    const videos = [];
+    let cursor = null;
+    do {
+      const params = new URLSearchParams({ limit: '100' });
+      if (cursor) {
+        params.set('cursor', cursor);
+      }
+      const res = await fetch(`/api/videos?${params}`, {
+        method: 'GET',
+        headers: {
+          Authorization: `Bearer ${localStorage.getItem('token')}`,
+        },
+      });
       const data = await res.json();
-      throw new Error(`Failed to get videos. Error: ${data.error}`);
-    }
+      if (!res.ok) {
+        throw new Error(`Failed to get videos. Error: ${data.error}`);
+      }
+      videos.push(...data.videos);
+      cursor = data.next_cursor;
+    } while (cursor);
 
-    const videos = await res.json();
     const videoList = document.getElementById('video-list');
     videoList.innerHTML = '';
     for (const video of videos) {
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
 )
 
 
@@ -54,3 +57,24 @@ func TestAspectRatio_Other(t *testing.T) {
 	
 }
 
+
+func TestGetVideoAspectRatio_FromProbe(t *testing.T) {
+	runner := &ffmpeg.FakeRunner{
+		Handler: func(ctx context.Context, name string, args []string) (ffmpeg.Result, error) {
+			return ffmpeg.Result{Stdout: []byte(`{"streams":[{"width":1080,"height":1920}]}`)}, nil
+		},
+	}
+
+	result, err := getVideoAspectRatio(context.Background(), runner, "video.mp4")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result != "9:16" {
+		t.Errorf("Expected: %s\n Received: %s\n", "9:16", result)
+	}
+
+	calls := runner.Calls()
+	if len(calls) != 1 || calls[0].Name != "ffprobe" || calls[0].Args[len(calls[0].Args)-1] != "video.mp4" {
+		t.Errorf("Unexpected ffprobe calls: %v", calls)
+	}
+}
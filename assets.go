@@ -1,7 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -10,3 +15,33 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	}
 	return nil
 }
+
+func getAssetPath(fileExtension string) string {
+	randBytes := make([]byte, 32)
+	rand.Read(randBytes)
+	randBase64String := base64.RawURLEncoding.EncodeToString(randBytes)
+	return fmt.Sprintf("%s.%s", randBase64String, fileExtension)
+}
+
+func (cfg apiConfig) getAssetDiskPath(assetPath string) string {
+	return filepath.Join(cfg.assetsRoot, assetPath)
+}
+
+// getAssetURL is the URL stored for an asset: its disk path under the
+// server's host and port, the format thumbnail URLs have always had.
+func (cfg apiConfig) getAssetURL(assetPath string) string {
+	return fmt.Sprintf("%s:%s/%s", cfg.host, cfg.port, cfg.getAssetDiskPath(assetPath))
+}
+
+// getAssetPathFromURL maps an asset URL back to its path under assetsRoot.
+func (cfg apiConfig) getAssetPathFromURL(assetURL string) (string, bool) {
+	diskPath, ok := strings.CutPrefix(assetURL, fmt.Sprintf("%s:%s/", cfg.host, cfg.port))
+	if !ok {
+		return "", false
+	}
+	assetPath := filepath.Base(diskPath)
+	if assetPath == "." || assetPath == string(filepath.Separator) || cfg.getAssetDiskPath(assetPath) != diskPath {
+		return "", false
+	}
+	return assetPath, true
+}
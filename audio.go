@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
+)
+
+// loudnormSettings are the EBU R128 targets handed to ffmpeg's loudnorm filter.
+type loudnormSettings struct {
+	IntegratedLoudness float64
+	TruePeak           float64
+	LoudnessRange      float64
+}
+
+type audioRendition struct {
+	Codec       string
+	Extension   string
+	ContentType string
+	Format      string
+}
+
+var audioRenditions = map[string]audioRendition{
+	"aac": {Codec: "aac", Extension: "m4a", ContentType: "audio/mp4", Format: "ipod"},
+	"mp3": {Codec: "libmp3lame", Extension: "mp3", ContentType: "audio/mpeg", Format: "mp3"},
+}
+
+// loadLoudnormSettings returns nil unless LOUDNORM_ENABLED is set. The targets
+// default to the EBU R128 broadcast values.
+func loadLoudnormSettings() (*loudnormSettings, error) {
+	enabled := os.Getenv("LOUDNORM_ENABLED")
+	if enabled == "" {
+		return nil, nil
+	}
+	isEnabled, err := strconv.ParseBool(enabled)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOUDNORM_ENABLED: %w", err)
+	}
+	if !isEnabled {
+		return nil, nil
+	}
+
+	settings := loudnormSettings{
+		IntegratedLoudness: -23,
+		TruePeak:           -1,
+		LoudnessRange:      7,
+	}
+	for name, value := range map[string]*float64{
+		"LOUDNORM_TARGET_I":   &settings.IntegratedLoudness,
+		"LOUDNORM_TARGET_TP":  &settings.TruePeak,
+		"LOUDNORM_TARGET_LRA": &settings.LoudnessRange,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			*value, err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+	return &settings, nil
+}
+
+func loadAudioRendition() (*audioRendition, error) {
+	format := os.Getenv("AUDIO_RENDITION_FORMAT")
+	if format == "" {
+		return nil, nil
+	}
+	rendition, ok := audioRenditions[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported AUDIO_RENDITION_FORMAT %q, expected aac or mp3", format)
+	}
+	return &rendition, nil
+}
+
+func hasAudioStream(ctx context.Context, runner ffmpeg.Runner, filePath string) (bool, error) {
+	result, err := runner.Run(ctx, "ffprobe", "-v", "error", "-select_streams", "a", "-show_entries", "stream=index", "-print_format", "json", filePath)
+	if err != nil {
+		return false, fmt.Errorf("unable to probe audio streams of %s: %w", filePath, err)
+	}
+
+	output := struct {
+		Streams []struct{} `json:"streams"`
+	}{}
+	err = json.Unmarshal(result.Stdout, &output)
+	if err != nil {
+		return false, fmt.Errorf("unable to unmarshal the stream: %s", err)
+	}
+	return len(output.Streams) > 0, nil
+}
+
+type loudnormMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// parseLoudnormMeasurement pulls the JSON block loudnorm prints at the end of
+// ffmpeg's stderr on the analysis pass.
+func parseLoudnormMeasurement(stderr []byte) (loudnormMeasurement, error) {
+	start := bytes.LastIndexByte(stderr, '{')
+	end := bytes.LastIndexByte(stderr, '}')
+	if start == -1 || end < start {
+		return loudnormMeasurement{}, fmt.Errorf("no loudnorm measurement in ffmpeg output")
+	}
+
+	measurement := loudnormMeasurement{}
+	err := json.Unmarshal(stderr[start:end+1], &measurement)
+	if err != nil {
+		return loudnormMeasurement{}, fmt.Errorf("unable to unmarshal loudnorm measurement: %s", err)
+	}
+	return measurement, nil
+}
+
+func (settings loudnormSettings) filter() string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s",
+		strconv.FormatFloat(settings.IntegratedLoudness, 'f', -1, 64),
+		strconv.FormatFloat(settings.TruePeak, 'f', -1, 64),
+		strconv.FormatFloat(settings.LoudnessRange, 'f', -1, 64),
+	)
+}
+
+// normalizeLoudness runs loudnorm in two passes: the first measures the input,
+// the second applies a linear correction using those measurements. Video is
+// stream copied.
+func normalizeLoudness(ctx context.Context, runner ffmpeg.Runner, filepath string, settings loudnormSettings) (string, error) {
+	analysis, err := runner.Run(ctx, "ffmpeg", "-i", filepath, "-af", settings.filter()+":print_format=json", "-vn", "-f", "null", "-")
+	if err != nil {
+		return "", fmt.Errorf("unable to measure loudness of %s: %w", filepath, err)
+	}
+
+	measurement, err := parseLoudnormMeasurement(analysis.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	outputFilepath := fmt.Sprintf("%s.loudnorm", filepath)
+	filter := strings.Join([]string{
+		settings.filter(),
+		"measured_I=" + measurement.InputI,
+		"measured_TP=" + measurement.InputTP,
+		"measured_LRA=" + measurement.InputLRA,
+		"measured_thresh=" + measurement.InputThresh,
+		"offset=" + measurement.TargetOffset,
+		"linear=true",
+	}, ":")
+	_, err = runner.Run(ctx, "ffmpeg", "-y", "-i", filepath, "-af", filter, "-c:v", "copy", "-c:a", "aac", "-ar", "48000", "-f", "mp4", outputFilepath)
+	if err != nil {
+		return "", fmt.Errorf("unable to normalize loudness of %s: %w", filepath, err)
+	}
+
+	return outputFilepath, nil
+}
+
+func extractAudio(ctx context.Context, runner ffmpeg.Runner, filepath string, rendition audioRendition) (string, error) {
+	outputFilepath := fmt.Sprintf("%s.%s", filepath, rendition.Extension)
+	args := []string{"-y", "-i", filepath, "-vn", "-c:a", rendition.Codec}
+	if rendition.Codec == "libmp3lame" {
+		args = append(args, "-q:a", "2")
+	} else {
+		args = append(args, "-b:a", "192k")
+	}
+	args = append(args, "-f", rendition.Format, outputFilepath)
+
+	_, err := runner.Run(ctx, "ffmpeg", args...)
+	if err != nil {
+		return "", fmt.Errorf("unable to extract audio from %s: %w", filepath, err)
+	}
+
+	return outputFilepath, nil
+}
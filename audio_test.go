@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseLoudnormMeasurement(t *testing.T) {
+	stderr := `[Parsed_loudnorm_0 @ 0x5581] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`
+	result, err := parseLoudnormMeasurement([]byte(stderr))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := loudnormMeasurement{
+		InputI:       "-27.61",
+		InputTP:      "-4.47",
+		InputLRA:     "18.06",
+		InputThresh:  "-39.20",
+		TargetOffset: "0.58",
+	}
+	if result != expected {
+		t.Errorf("Expected: %+v\n Received: %+v\n", expected, result)
+	}
+}
+
+func TestParseLoudnormMeasurement_Missing(t *testing.T) {
+	_, err := parseLoudnormMeasurement([]byte("Output file is empty, nothing was encoded"))
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+}
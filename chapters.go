@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
+)
+
+type chapterMarker struct {
+	Title string
+	Start time.Duration
+}
+
+type chapterDetectionSettings struct {
+	Threshold float64
+	MinLength time.Duration
+}
+
+const (
+	maxChapterTitleLength = 100
+	maxChapters           = 100
+)
+
+var scenePTSPattern = regexp.MustCompile(`pts_time:([0-9]+(?:\.[0-9]+)?)`)
+
+// loadChapterDetectionSettings returns nil unless CHAPTER_DETECTION_ENABLED is set.
+func loadChapterDetectionSettings() (*chapterDetectionSettings, error) {
+	enabled := os.Getenv("CHAPTER_DETECTION_ENABLED")
+	if enabled == "" {
+		return nil, nil
+	}
+	isEnabled, err := strconv.ParseBool(enabled)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CHAPTER_DETECTION_ENABLED: %w", err)
+	}
+	if !isEnabled {
+		return nil, nil
+	}
+
+	settings := chapterDetectionSettings{
+		Threshold: 0.4,
+		MinLength: 30 * time.Second,
+	}
+	if threshold := os.Getenv("CHAPTER_SCENE_THRESHOLD"); threshold != "" {
+		settings.Threshold, err = strconv.ParseFloat(threshold, 64)
+		if err != nil || settings.Threshold <= 0 || settings.Threshold >= 1 {
+			return nil, fmt.Errorf("invalid CHAPTER_SCENE_THRESHOLD %q", threshold)
+		}
+	}
+	if minLength := os.Getenv("CHAPTER_MIN_LENGTH"); minLength != "" {
+		settings.MinLength, err = time.ParseDuration(minLength)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CHAPTER_MIN_LENGTH: %w", err)
+		}
+	}
+	return &settings, nil
+}
+
+func chapterMarkersFromDatabase(chapters []database.Chapter) []chapterMarker {
+	markers := make([]chapterMarker, 0, len(chapters))
+	for _, chapter := range chapters {
+		markers = append(markers, chapterMarker{
+			Title: chapter.Title,
+			Start: time.Duration(chapter.StartSeconds * float64(time.Second)),
+		})
+	}
+	return markers
+}
+
+func chapterParamsFromMarkers(markers []chapterMarker, source string) []database.CreateChapterParams {
+	params := make([]database.CreateChapterParams, 0, len(markers))
+	for _, marker := range markers {
+		params = append(params, database.CreateChapterParams{
+			Title:        marker.Title,
+			StartSeconds: marker.Start.Seconds(),
+			Source:       source,
+		})
+	}
+	return params
+}
+
+func validateChapters(chapters []database.CreateChapterParams) error {
+	if len(chapters) > maxChapters {
+		return fmt.Errorf("a video can have at most %d chapters", maxChapters)
+	}
+	seen := map[float64]bool{}
+	for _, chapter := range chapters {
+		title := strings.TrimSpace(chapter.Title)
+		if title == "" || len(title) > maxChapterTitleLength {
+			return fmt.Errorf("chapter titles must be between 1 and %d characters", maxChapterTitleLength)
+		}
+		if chapter.StartSeconds < 0 {
+			return fmt.Errorf("chapter %q starts before the video", title)
+		}
+		if seen[chapter.StartSeconds] {
+			return fmt.Errorf("more than one chapter starts at %v seconds", chapter.StartSeconds)
+		}
+		seen[chapter.StartSeconds] = true
+	}
+	return nil
+}
+
+// chapterEnds returns when each chapter finishes: at the start of the next one,
+// or at the end of the video for the last.
+func chapterEnds(markers []chapterMarker, duration time.Duration) []time.Duration {
+	ends := make([]time.Duration, len(markers))
+	for i := range markers {
+		if i+1 < len(markers) {
+			ends[i] = markers[i+1].Start
+		} else {
+			ends[i] = duration
+		}
+	}
+	return ends
+}
+
+// formatChaptersWebVTT renders a WebVTT chapters track (kind="chapters").
+func formatChaptersWebVTT(markers []chapterMarker, duration time.Duration) []byte {
+	ends := chapterEnds(markers, duration)
+	cues := []subtitleCue{}
+	for i, marker := range markers {
+		if ends[i] <= marker.Start {
+			continue
+		}
+		cues = append(cues, subtitleCue{
+			ID:    strconv.Itoa(len(cues) + 1),
+			Start: marker.Start,
+			End:   ends[i],
+			Text:  []string{marker.Title},
+		})
+	}
+	return formatWebVTT(cues)
+}
+
+func escapeFFMetadata(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+	return replacer.Replace(value)
+}
+
+// writeChapterMetadata writes an ffmetadata file that ffmpeg can map chapters from.
+func writeChapterMetadata(markers []chapterMarker, duration time.Duration) (string, error) {
+	var builder strings.Builder
+	builder.WriteString(";FFMETADATA1\n")
+	ends := chapterEnds(markers, duration)
+	for i, marker := range markers {
+		if ends[i] <= marker.Start {
+			continue
+		}
+		builder.WriteString("[CHAPTER]\nTIMEBASE=1/1000\n")
+		builder.WriteString(fmt.Sprintf("START=%d\nEND=%d\n", marker.Start.Milliseconds(), ends[i].Milliseconds()))
+		builder.WriteString("title=" + escapeFFMetadata(marker.Title) + "\n")
+	}
+
+	metadataFile, err := os.CreateTemp("", "tubely-chapters-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer metadataFile.Close()
+
+	_, err = metadataFile.WriteString(builder.String())
+	if err != nil {
+		os.Remove(metadataFile.Name())
+		return "", err
+	}
+	return metadataFile.Name(), nil
+}
+
+func parseSceneChanges(output []byte) []time.Duration {
+	changes := []time.Duration{}
+	for _, match := range scenePTSPattern.FindAllSubmatch(output, -1) {
+		seconds, err := strconv.ParseFloat(string(match[1]), 64)
+		if err != nil {
+			continue
+		}
+		changes = append(changes, time.Duration(seconds*float64(time.Second)))
+	}
+	return changes
+}
+
+// suggestChapters turns scene changes into chapter markers, always starting at
+// zero and dropping changes that would make a chapter shorter than minLength.
+func suggestChapters(sceneChanges []time.Duration, duration, minLength time.Duration) []chapterMarker {
+	markers := []chapterMarker{{Title: "Chapter 1", Start: 0}}
+	for _, change := range sceneChanges {
+		if len(markers) >= maxChapters {
+			break
+		}
+		if change-markers[len(markers)-1].Start < minLength || duration-change < minLength {
+			continue
+		}
+		markers = append(markers, chapterMarker{
+			Title: fmt.Sprintf("Chapter %d", len(markers)+1),
+			Start: change,
+		})
+	}
+	return markers
+}
+
+// detectSceneChanges has the metadata filter write frame info to a temp file
+// instead of reading showinfo off stderr, which the runner truncates. Temp file
+// names are plain enough that they don't need filtergraph escaping.
+func detectSceneChanges(ctx context.Context, runner ffmpeg.Runner, filepath string, threshold float64) ([]time.Duration, error) {
+	scoresFile, err := os.CreateTemp("", "tubely-scenes-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	scoresFile.Close()
+	defer os.Remove(scoresFile.Name())
+
+	filter := fmt.Sprintf("select='gt(scene,%s)',metadata=print:file=%s",
+		strconv.FormatFloat(threshold, 'f', -1, 64),
+		scoresFile.Name(),
+	)
+	_, err = runner.Run(ctx, "ffmpeg", "-i", filepath, "-an", "-vf", filter, "-f", "null", "-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to detect scene changes in %s: %w", filepath, err)
+	}
+
+	scores, err := os.ReadFile(scoresFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	return parseSceneChanges(scores), nil
+}
+
+// shiftChaptersForTrim moves chapters onto the timeline of a clip cut from
+// [start, end). The chapter that was playing at start becomes the first one.
+func shiftChaptersForTrim(markers []chapterMarker, start, end time.Duration) []chapterMarker {
+	shifted := []chapterMarker{}
+	for _, marker := range markers {
+		if marker.Start >= end {
+			continue
+		}
+		if marker.Start <= start {
+			shifted = []chapterMarker{{Title: marker.Title, Start: 0}}
+			continue
+		}
+		shifted = append(shifted, chapterMarker{Title: marker.Title, Start: marker.Start - start})
+	}
+	return shifted
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSuggestChapters(t *testing.T) {
+	sceneChanges := []time.Duration{5 * time.Second, 40 * time.Second, 50 * time.Second, 100 * time.Second, 118 * time.Second}
+	expected := []chapterMarker{
+		{Title: "Chapter 1", Start: 0},
+		{Title: "Chapter 2", Start: 40 * time.Second},
+		{Title: "Chapter 3", Start: 100 * time.Second},
+	}
+
+	result := suggestChapters(sceneChanges, 2*time.Minute, 15*time.Second)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\n Received: %v\n", expected, result)
+	}
+}
+
+func TestShiftChaptersForTrim(t *testing.T) {
+	markers := []chapterMarker{
+		{Title: "Intro", Start: 0},
+		{Title: "Setup", Start: 30 * time.Second},
+		{Title: "Demo", Start: 90 * time.Second},
+		{Title: "Outro", Start: 300 * time.Second},
+	}
+	expected := []chapterMarker{
+		{Title: "Setup", Start: 0},
+		{Title: "Demo", Start: 50 * time.Second},
+	}
+
+	result := shiftChaptersForTrim(markers, 40*time.Second, 200*time.Second)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\n Received: %v\n", expected, result)
+	}
+}
+
+func TestFormatChaptersWebVTT(t *testing.T) {
+	markers := []chapterMarker{
+		{Title: "Intro", Start: 0},
+		{Title: "Main", Start: 61500 * time.Millisecond},
+	}
+	expected := "WEBVTT\n\n1\n00:00:00.000 --> 00:01:01.500\nIntro\n\n2\n00:01:01.500 --> 00:02:00.000\nMain\n"
+
+	result := string(formatChaptersWebVTT(markers, 2*time.Minute))
+	if result != expected {
+		t.Errorf("Expected: %q\n Received: %q\n", expected, result)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// videoETag identifies a version of a video's metadata. It is derived from
+// updated_at, which only has second precision on SQLite, so the editable
+// fields go into it too and two edits in the same second still differ.
+func videoETag(video database.Video) string {
+	h := sha256.New()
+	for _, field := range []string{
+		video.ID.String(),
+		video.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		video.Title,
+		video.Description,
+		video.Visibility,
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// ifMatch reports whether the request's If-Match header allows changing a
+// resource whose current ETag is etag, and whether the header was sent at
+// all. Weak ETags never match, as RFC 9110 requires.
+func ifMatch(header http.Header, etag string) (matches, present bool) {
+	values := header.Values("If-Match")
+	if len(values) == 0 {
+		return true, false
+	}
+	for _, value := range values {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || candidate == etag {
+				return true, true
+			}
+		}
+	}
+	return false, true
+}
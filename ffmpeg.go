@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
+)
+
+// loadFFmpegRunner builds the runner every ffmpeg and ffprobe call goes through.
+// FFMPEG_TIMEOUT bounds a single command and FFMPEG_MAX_CONCURRENT caps how many
+// run at once across all requests.
+func loadFFmpegRunner() (*ffmpeg.ExecRunner, error) {
+	timeout := 10 * time.Minute
+	if raw := os.Getenv("FFMPEG_TIMEOUT"); raw != "" {
+		var err error
+		timeout, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FFMPEG_TIMEOUT: %w", err)
+		}
+	}
+
+	maxConcurrent := runtime.NumCPU()
+	if raw := os.Getenv("FFMPEG_MAX_CONCURRENT"); raw != "" {
+		var err error
+		maxConcurrent, err = strconv.Atoi(raw)
+		if err != nil || maxConcurrent < 1 {
+			return nil, fmt.Errorf("invalid FFMPEG_MAX_CONCURRENT %q", raw)
+		}
+	}
+
+	return ffmpeg.NewExecRunner(timeout, maxConcurrent), nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxBulkVideos = 100
+
+const (
+	bulkOperationDelete         = "delete"
+	bulkOperationSetVisibility  = "set_visibility"
+	bulkOperationAddTag         = "add_tag"
+	bulkOperationMoveToPlaylist = "move_to_playlist"
+)
+
+var (
+	errBulkPlaylistNotFound = errors.New("playlist not found")
+	errBulkPlaylistNotOwned = errors.New("playlist not owned by user")
+)
+
+// bulkResult is what happened to one video. Status is the code the single
+// video endpoint would have answered with.
+type bulkResult struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Status  int       `json:"status"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// handlerVideosBulk applies one operation to many videos. Videos that are
+// missing or belong to someone else are reported and skipped; the changes to
+// the rest happen in one transaction, so either all of them stick or, on a
+// database error, none do.
+func (cfg *apiConfig) handlerVideosBulk(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs   []uuid.UUID `json:"video_ids"`
+		Operation  string      `json:"operation"`
+		Visibility string      `json:"visibility"`
+		Tag        string      `json:"tag"`
+		PlaylistID uuid.UUID   `json:"playlist_id"`
+	}
+	type response struct {
+		Results []bulkResult `json:"results"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.VideoIDs) == 0 || len(params.VideoIDs) > maxBulkVideos {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Give between 1 and %d video IDs", maxBulkVideos), nil)
+		return
+	}
+
+	// prepare runs first in the transaction, for checks the whole batch
+	// depends on.
+	prepare := func(tx database.Store) error { return nil }
+	var apply func(tx database.Store, video database.Video) error
+	// applied is the status of a video the operation went through for.
+	applied := http.StatusOK
+	switch params.Operation {
+	case bulkOperationDelete:
+		apply = func(tx database.Store, video database.Video) error {
+			return tx.TrashVideo(r.Context(), video.ID)
+		}
+		applied = http.StatusNoContent
+	case bulkOperationSetVisibility:
+		if params.Visibility == "" || !validVideoVisibility(params.Visibility) {
+			respondWithError(w, http.StatusBadRequest, "Visibility must be private, unlisted or public", nil)
+			return
+		}
+		apply = func(tx database.Store, video database.Video) error {
+			_, err := tx.UpdateVideoMetadata(r.Context(), database.UpdateVideoMetadataParams{
+				ID:          video.ID,
+				Title:       video.Title,
+				Description: video.Description,
+				Visibility:  params.Visibility,
+			})
+			return err
+		}
+	case bulkOperationAddTag:
+		if _, err := database.NormalizeTag(params.Tag); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		apply = func(tx database.Store, video database.Video) error {
+			_, err := tx.AddVideoTags(r.Context(), video.ID, []string{params.Tag})
+			return err
+		}
+	case bulkOperationMoveToPlaylist:
+		// The playlist is checked inside the transaction so it can't be
+		// deleted or change hands halfway through the batch. Only the
+		// caller's own playlists give the videos up; other users' playlists
+		// keep whatever they link to.
+		ownPlaylists := map[uuid.UUID]bool{}
+		prepare = func(tx database.Store) error {
+			playlist, err := tx.GetPlaylist(r.Context(), params.PlaylistID)
+			if errors.Is(err, database.ErrNotFound) {
+				return errBulkPlaylistNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if playlist.UserID != userID {
+				return errBulkPlaylistNotOwned
+			}
+			playlists, err := tx.GetPlaylists(r.Context(), userID)
+			if err != nil {
+				return err
+			}
+			for _, playlist := range playlists {
+				ownPlaylists[playlist.ID] = true
+			}
+			return nil
+		}
+		// Videos already in the playlist keep their place, so repeating the
+		// request doesn't add them twice.
+		apply = func(tx database.Store, video database.Video) error {
+			entries, err := tx.GetVideoPlaylistEntries(r.Context(), video.ID)
+			if err != nil {
+				return err
+			}
+			inPlaylist := false
+			for _, entry := range entries {
+				switch {
+				case entry.PlaylistID == params.PlaylistID:
+					inPlaylist = true
+				case ownPlaylists[entry.PlaylistID]:
+					err := tx.RemovePlaylistEntry(r.Context(), entry.PlaylistID, entry.ID)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			if inPlaylist {
+				return nil
+			}
+			_, err = tx.AddPlaylistEntry(r.Context(), database.AddPlaylistEntryParams{PlaylistID: params.PlaylistID, VideoID: video.ID})
+			if errors.Is(err, database.ErrNotFound) {
+				return errBulkPlaylistNotFound
+			}
+			return err
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Operation must be %s, %s, %s or %s", bulkOperationDelete, bulkOperationSetVisibility, bulkOperationAddTag, bulkOperationMoveToPlaylist), nil)
+		return
+	}
+
+	var results []bulkResult
+	err = cfg.db.WithTx(r.Context(), func(tx database.Store) error {
+		err := prepare(tx)
+		if err != nil {
+			return err
+		}
+		results = make([]bulkResult, 0, len(params.VideoIDs))
+		seen := map[uuid.UUID]bool{}
+		for _, videoID := range params.VideoIDs {
+			if seen[videoID] {
+				continue
+			}
+			seen[videoID] = true
+
+			video, err := tx.GetVideo(r.Context(), videoID)
+			if errors.Is(err, database.ErrNotFound) || (err == nil && video.DeletedAt != nil) {
+				results = append(results, bulkResult{VideoID: videoID, Status: http.StatusNotFound, Error: "Couldn't get video"})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if video.UserID != userID {
+				results = append(results, bulkResult{VideoID: videoID, Status: http.StatusForbidden, Error: "You can't edit this video"})
+				continue
+			}
+
+			err = apply(tx, video)
+			if err != nil {
+				return err
+			}
+			results = append(results, bulkResult{VideoID: videoID, Status: applied})
+		}
+		return nil
+	})
+	if errors.Is(err, errBulkPlaylistNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", err)
+		return
+	}
+	if errors.Is(err, errBulkPlaylistNotOwned) {
+		respondWithError(w, http.StatusForbidden, "You can't edit this playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update videos", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{Results: results})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideosBulk(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "other@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(userID uuid.UUID, title string) uuid.UUID {
+		t.Helper()
+		video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: title, UserID: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return video.ID
+	}
+	first := create(owner.ID, "First")
+	second := create(owner.ID, "Second")
+	theirs := create(other.ID, "Theirs")
+	missing := uuid.New()
+	createPlaylist := func(userID uuid.UUID, title string) uuid.UUID {
+		t.Helper()
+		playlist, err := cfg.db.CreatePlaylist(ctx, database.CreatePlaylistParams{Title: title, UserID: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return playlist.ID
+	}
+	playlist := createPlaylist(owner.ID, "Series")
+	drafts := createPlaylist(owner.ID, "Drafts")
+	favourites := createPlaylist(other.ID, "Favourites")
+	for _, entry := range []database.AddPlaylistEntryParams{
+		{PlaylistID: drafts, VideoID: first},
+		{PlaylistID: drafts, VideoID: second},
+		{PlaylistID: favourites, VideoID: first},
+	} {
+		if _, err := cfg.db.AddPlaylistEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	videoIDs := func(playlistID uuid.UUID) []uuid.UUID {
+		t.Helper()
+		entries, err := cfg.db.GetPlaylistEntries(ctx, playlistID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []uuid.UUID{}
+		for _, entry := range entries {
+			ids = append(ids, entry.VideoID)
+		}
+		return ids
+	}
+
+	bulk := func(body string) (int, map[uuid.UUID]int) {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodPost, "/api/videos/bulk", owner.ID)
+		req.Body = io.NopCloser(strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		cfg.handlerVideosBulk(rec, req)
+
+		var resp struct {
+			Results []bulkResult `json:"results"`
+		}
+		statuses := map[uuid.UUID]int{}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			for _, result := range resp.Results {
+				statuses[result.VideoID] = result.Status
+			}
+		}
+		return rec.Code, statuses
+	}
+	ids := `["` + first.String() + `", "` + second.String() + `", "` + theirs.String() + `", "` + missing.String() + `", "` + first.String() + `"]`
+	wantStatuses := map[uuid.UUID]int{first: http.StatusOK, second: http.StatusOK, theirs: http.StatusForbidden, missing: http.StatusNotFound}
+	checkStatuses := func(operation string, code int, statuses map[uuid.UUID]int) {
+		t.Helper()
+		if code != http.StatusOK || len(statuses) != len(wantStatuses) {
+			t.Fatalf("%s = %d %v", operation, code, statuses)
+		}
+		for id, want := range wantStatuses {
+			if statuses[id] != want {
+				t.Errorf("%s on %s = %d, want %d", operation, id, statuses[id], want)
+			}
+		}
+	}
+
+	code, statuses := bulk(`{"operation": "set_visibility", "visibility": "public", "video_ids": ` + ids + `}`)
+	checkStatuses("set_visibility", code, statuses)
+	code, statuses = bulk(`{"operation": "add_tag", "tag": "Cleanup", "video_ids": ` + ids + `}`)
+	checkStatuses("add_tag", code, statuses)
+	for range 2 {
+		code, statuses = bulk(`{"operation": "move_to_playlist", "playlist_id": "` + playlist.String() + `", "video_ids": ` + ids + `}`)
+		checkStatuses("move_to_playlist", code, statuses)
+	}
+	if got := videoIDs(playlist); len(got) != 2 || got[0] != first || got[1] != second {
+		t.Errorf("playlist after moving = %v", got)
+	}
+	// The videos leave the owner's other playlists, but someone else's
+	// playlist keeps linking to them.
+	if got := videoIDs(drafts); len(got) != 0 {
+		t.Errorf("moved videos are still in another playlist: %v", got)
+	}
+	if got := videoIDs(favourites); len(got) != 1 || got[0] != first {
+		t.Errorf("someone else's playlist = %v", got)
+	}
+	// Deleting answers each video the way DELETE /api/videos/{videoID} does.
+	wantStatuses[first], wantStatuses[second] = http.StatusNoContent, http.StatusNoContent
+	code, statuses = bulk(`{"operation": "delete", "video_ids": ` + ids + `}`)
+	checkStatuses("delete", code, statuses)
+
+	for _, id := range []uuid.UUID{first, second} {
+		video, err := cfg.db.GetVideo(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if video.Visibility != database.VideoVisibilityPublic || len(video.Tags) != 1 || video.Tags[0] != "cleanup" || video.DeletedAt == nil {
+			t.Errorf("video after bulk operations = %+v", video)
+		}
+	}
+	video, err := cfg.db.GetVideo(ctx, theirs)
+	if err != nil || video.Visibility != database.VideoVisibilityPrivate || len(video.Tags) != 0 || video.DeletedAt != nil {
+		t.Errorf("someone else's video was changed: %+v, %v", video, err)
+	}
+
+	for _, body := range []string{
+		`{"operation": "delete", "video_ids": []}`,
+		`{"operation": "archive", "video_ids": ["` + first.String() + `"]}`,
+		`{"operation": "set_visibility", "visibility": "friends", "video_ids": ["` + first.String() + `"]}`,
+		`{"operation": "add_tag", "tag": " ", "video_ids": ["` + first.String() + `"]}`,
+	} {
+		if code, _ := bulk(body); code != http.StatusBadRequest {
+			t.Errorf("%s returned %d", body, code)
+		}
+	}
+	if code, _ := bulk(`{"operation": "move_to_playlist", "playlist_id": "` + uuid.NewString() + `", "video_ids": ["` + first.String() + `"]}`); code != http.StatusNotFound {
+		t.Errorf("missing playlist returned %d", code)
+	}
+	if code, _ := bulk(`{"operation": "move_to_playlist", "playlist_id": "` + favourites.String() + `", "video_ids": ["` + first.String() + `"]}`); code != http.StatusForbidden {
+		t.Errorf("someone else's playlist returned %d", code)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerChaptersGet(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chapters", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+func (cfg *apiConfig) handlerChaptersWebVTT(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.Duration == nil {
+		respondWithError(w, http.StatusConflict, "Video hasn't been processed yet", nil)
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chapters", err)
+		return
+	}
+
+	duration := time.Duration(*video.Duration * float64(time.Second))
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(formatChaptersWebVTT(chapterMarkersFromDatabase(chapters), duration))
+}
+
+func (cfg *apiConfig) handlerChaptersReplace(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Chapters []database.CreateChapterParams `json:"chapters"`
+	}
+
+	video, ok := cfg.getOwnedVideoForChapters(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	for i := range params.Chapters {
+		params.Chapters[i].Source = database.ChapterSourceManual
+	}
+
+	err = validateChapters(params.Chapters)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chapters, err := cfg.db.ReplaceChapters(r.Context(), video.ID, params.Chapters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save chapters", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+// handlerChapterCreate adds a single chapter. Adding to a list of suggestions
+// means the user has taken the list over, so every chapter becomes manual.
+func (cfg *apiConfig) handlerChapterCreate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideoForChapters(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := database.CreateChapterParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	existing, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chapters", err)
+		return
+	}
+
+	chapters := []database.CreateChapterParams{}
+	for _, chapter := range existing {
+		chapters = append(chapters, chapter.CreateChapterParams)
+	}
+	chapters = append(chapters, params)
+	for i := range chapters {
+		chapters[i].Source = database.ChapterSourceManual
+	}
+
+	err = validateChapters(chapters)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	saved, err := cfg.db.ReplaceChapters(r.Context(), video.ID, chapters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save chapters", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, saved)
+}
+
+func (cfg *apiConfig) handlerChapterDelete(w http.ResponseWriter, r *http.Request) {
+	chapterID, err := uuid.Parse(r.PathValue("chapterID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chapter ID", err)
+		return
+	}
+
+	video, ok := cfg.getOwnedVideoForChapters(w, r)
+	if !ok {
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chapters", err)
+		return
+	}
+	found := false
+	for _, chapter := range chapters {
+		if chapter.ID == chapterID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chapter", nil)
+		return
+	}
+
+	err = cfg.db.DeleteChapter(r.Context(), chapterID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete chapter", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getOwnedVideoForChapters authenticates the caller and loads the video from
+// the path, responding with an error and returning false when either fails.
+func (cfg *apiConfig) getOwnedVideoForChapters(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit chapters on this video", errors.New("video not owned by user"))
+		return database.Video{}, false
+	}
+
+	return video, true
+}
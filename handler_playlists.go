@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type playlistParameters struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+}
+
+// problem describes what is wrong with the parameters, if anything.
+func (params playlistParameters) problem() string {
+	if params.Title == "" {
+		return "Playlists need a title"
+	}
+	if !validVideoVisibility(params.Visibility) {
+		return "Visibility must be private, unlisted or public"
+	}
+	return ""
+}
+
+func (cfg *apiConfig) handlerPlaylistCreate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := playlistParameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if problem := params.problem(); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+
+	playlist, err := cfg.db.CreatePlaylist(r.Context(), database.CreatePlaylistParams{
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  params.Visibility,
+		UserID:      userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistsGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	playlists, err := cfg.db.GetPlaylists(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+// handlerPlaylistGet returns a playlist with the videos in it. Anyone can
+// see unlisted and public playlists; the entries leave out videos in the
+// trash and other people's private videos.
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	// Video is a database.Video for the viewer's own videos and a
+	// publicVideo for everyone else's.
+	type entry struct {
+		database.PlaylistEntry
+		Video any `json:"video"`
+	}
+	type response struct {
+		database.Playlist
+		Entries []entry `json:"entries"`
+	}
+
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return
+	}
+
+	viewerID, err := cfg.optionalViewerID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	playlist, err := cfg.db.GetPlaylist(r.Context(), playlistID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && playlist.Visibility == database.VideoVisibilityPrivate && playlist.UserID != viewerID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+
+	entries, err := cfg.db.GetPlaylistEntries(r.Context(), playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlist entries", err)
+		return
+	}
+
+	resp := response{Playlist: playlist, Entries: []entry{}}
+	for _, playlistEntry := range entries {
+		video, err := cfg.db.GetVideo(r.Context(), playlistEntry.VideoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+		if video.DeletedAt != nil || !canViewVideo(video, viewerID) {
+			continue
+		}
+		if video.UserID != viewerID {
+			resp.Entries = append(resp.Entries, entry{PlaylistEntry: playlistEntry, Video: newPublicVideo(video)})
+			continue
+		}
+		resp.Entries = append(resp.Entries, entry{PlaylistEntry: playlistEntry, Video: video})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := playlistParameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if problem := params.problem(); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+
+	playlist.Title = params.Title
+	playlist.Description = params.Description
+	if params.Visibility != "" {
+		playlist.Visibility = params.Visibility
+	}
+	err = cfg.db.UpdatePlaylist(r.Context(), playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playlist", err)
+		return
+	}
+
+	playlist, err = cfg.db.GetPlaylist(r.Context(), playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeletePlaylist(r.Context(), playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete playlist", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistEntryCreate adds one of the user's videos, or someone else's
+// that isn't private, to the playlist. Without a position it goes last.
+func (cfg *apiConfig) handlerPlaylistEntryCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID  uuid.UUID `json:"video_id"`
+		Position *int      `json:"position"`
+	}
+
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), params.VideoID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && video.DeletedAt != nil) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !canViewVideo(video, playlist.UserID) {
+		respondWithError(w, http.StatusForbidden, "You can't add this video", errors.New("video is private"))
+		return
+	}
+
+	entry, err := cfg.db.AddPlaylistEntry(r.Context(), database.AddPlaylistEntryParams{
+		PlaylistID: playlist.ID,
+		VideoID:    video.ID,
+		Position:   params.Position,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add video to playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, entry)
+}
+
+// handlerPlaylistEntryMove moves an entry to a new position and returns the
+// playlist's entries in their new order.
+func (cfg *apiConfig) handlerPlaylistEntryMove(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Position *int `json:"position"`
+	}
+
+	entryID, err := uuid.Parse(r.PathValue("entryID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid entry ID", err)
+		return
+	}
+
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Position == nil {
+		respondWithError(w, http.StatusBadRequest, "Position is required", nil)
+		return
+	}
+
+	err = cfg.db.MovePlaylistEntry(r.Context(), playlist.ID, entryID, *params.Position)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist entry", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move playlist entry", err)
+		return
+	}
+
+	entries, err := cfg.db.GetPlaylistEntries(r.Context(), playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlist entries", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, entries)
+}
+
+func (cfg *apiConfig) handlerPlaylistEntryDelete(w http.ResponseWriter, r *http.Request) {
+	entryID, err := uuid.Parse(r.PathValue("entryID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid entry ID", err)
+		return
+	}
+
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	err = cfg.db.RemovePlaylistEntry(r.Context(), playlist.ID, entryID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove playlist entry", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// optionalViewerID returns who signed the request, or uuid.Nil if it carries no
+// token. Signing in is optional, but a bad token is still an error.
+func (cfg *apiConfig) optionalViewerID(r *http.Request) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, nil
+	}
+	return auth.ValidateJWT(token, cfg.jwtSecret)
+}
+
+// canViewVideo reports whether userID may see the video, which is anyone
+// unless it is private.
+func canViewVideo(video database.Video, userID uuid.UUID) bool {
+	return video.UserID == userID || video.Visibility != database.VideoVisibilityPrivate
+}
+
+func (cfg *apiConfig) getOwnedPlaylist(w http.ResponseWriter, r *http.Request) (database.Playlist, bool) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Playlist{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Playlist{}, false
+	}
+
+	playlist, err := cfg.db.GetPlaylist(r.Context(), playlistID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+	if playlist.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this playlist", errors.New("playlist not owned by user"))
+		return database.Playlist{}, false
+	}
+
+	return playlist, true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerPlaylistGetHidesPrivateVideos(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist, err := cfg.db.CreatePlaylist(ctx, database.CreatePlaylistParams{Title: "Series", Visibility: database.VideoVisibilityUnlisted, UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, visibility := range []string{database.VideoVisibilityPublic, database.VideoVisibilityPrivate} {
+		video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: visibility, Visibility: visibility, UserID: owner.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cfg.db.AddPlaylistEntry(ctx, database.AddPlaylistEntryParams{PlaylistID: playlist.ID, VideoID: video.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(viewerID uuid.UUID) (int, []map[string]any) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/playlists/"+playlist.ID.String(), nil)
+		if viewerID != uuid.Nil {
+			req = newAuthedRequest(t, cfg, http.MethodGet, "/api/playlists/"+playlist.ID.String(), viewerID)
+		}
+		req.SetPathValue("playlistID", playlist.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerPlaylistGet(rec, req)
+
+		var resp struct {
+			Entries []struct {
+				Position int            `json:"position"`
+				Video    map[string]any `json:"video"`
+			} `json:"entries"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		videos := []map[string]any{}
+		for _, entry := range resp.Entries {
+			videos = append(videos, entry.Video)
+		}
+		return rec.Code, videos
+	}
+
+	code, videos := get(owner.ID)
+	if code != http.StatusOK || len(videos) != 2 {
+		t.Fatalf("owner got %d %v", code, videos)
+	}
+	for _, video := range videos {
+		if video["user_id"] != owner.ID.String() {
+			t.Errorf("owner's entry = %v, want the full video", video)
+		}
+	}
+
+	// Anyone else gets the public projection.
+	for _, viewerID := range []uuid.UUID{uuid.Nil, uuid.New()} {
+		code, videos := get(viewerID)
+		if code != http.StatusOK || len(videos) != 1 || videos[0]["title"] != database.VideoVisibilityPublic {
+			t.Fatalf("viewer %s got %d %v", viewerID, code, videos)
+		}
+		for _, field := range []string{"user_id", "current_version_id", "subtitles", "deleted_at", "audio_url"} {
+			if _, ok := videos[0][field]; ok {
+				t.Errorf("viewer %s can see %s: %v", viewerID, field, videos[0])
+			}
+		}
+	}
+
+	playlist.Visibility = database.VideoVisibilityPrivate
+	if err := cfg.db.UpdatePlaylist(ctx, playlist); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get(uuid.Nil); code != http.StatusNotFound {
+		t.Errorf("private playlist returned %d", code)
+	}
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
+// refreshTokenLifetime is how long a refresh token lasts. Each refresh
+// replaces it with a new one, so a session lasts as long as it is used at
+// least this often.
+const refreshTokenLifetime = 60 * 24 * time.Hour
+
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,14 +26,32 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	newRefreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+	rotated, err := cfg.db.RotateRefreshToken(r.Context(), refreshToken, database.CreateRefreshTokenParams{
+		Token:     newRefreshToken,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenLifetime),
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+	})
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used; log in again", err)
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrRefreshTokenExpired) {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
 
 	accessToken, err := auth.MakeJWT(
-		user.ID,
+		rotated.UserID,
 		cfg.jwtSecret,
 		time.Hour,
 	)
@@ -35,7 +61,8 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: rotated.Token,
 	})
 }
 
@@ -46,7 +73,11 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(refreshToken)
+	err = cfg.db.RevokeRefreshToken(r.Context(), refreshToken)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find session", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerRefreshRotates(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "login", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(token string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		cfg.handlerRefresh(rec, req)
+
+		var resp struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Token == "" {
+				t.Error("refresh didn't return an access token")
+			}
+		}
+		return rec.Code, resp.RefreshToken
+	}
+
+	code, rotated := refresh("login")
+	if code != http.StatusOK || rotated == "" || rotated == "login" {
+		t.Fatalf("refresh = %d %q", code, rotated)
+	}
+	code, latest := refresh(rotated)
+	if code != http.StatusOK {
+		t.Fatalf("refreshing with the rotated token = %d", code)
+	}
+
+	if code, _ := refresh("login"); code != http.StatusUnauthorized {
+		t.Errorf("reusing a replaced token = %d", code)
+	}
+	if code, _ := refresh(latest); code != http.StatusUnauthorized {
+		t.Errorf("latest token survived reuse of an older one: %d", code)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// publicVideo is what anyone allowed to watch a video may see of it. Use it
+// for videos shown to someone other than their owner.
+type publicVideo struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Visibility   string    `json:"visibility"`
+	ThumbnailURL *string   `json:"thumbnail_url"`
+	VideoURL     *string   `json:"video_url"`
+	Duration     *float64  `json:"duration_seconds"`
+	Tags         []string  `json:"tags"`
+}
+
+func newPublicVideo(video database.Video) publicVideo {
+	return publicVideo{
+		ID:           video.ID,
+		CreatedAt:    video.CreatedAt,
+		Title:        video.Title,
+		Description:  video.Description,
+		Visibility:   video.Visibility,
+		ThumbnailURL: video.ThumbnailURL,
+		VideoURL:     video.VideoURL,
+		Duration:     video.Duration,
+		Tags:         video.Tags,
+	}
+}
+
+// handlerVideosSearch runs a full-text search over titles and descriptions.
+// It covers the user's own videos and everyone's public ones, or only the
+// user's with scope=mine.
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	// Results include other users' public videos, so they only carry what
+	// anyone watching one could see.
+	type searchResult struct {
+		publicVideo
+		Rank    float64 `json:"rank"`
+		Snippet string  `json:"snippet"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.SearchVideosParams{
+		Query:  query.Get("q"),
+		UserID: userID,
+	}
+	if params.Query == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query q", nil)
+		return
+	}
+	switch scope := query.Get("scope"); scope {
+	case "", "all":
+	case "mine":
+		params.OwnOnly = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid scope, use mine or all", nil)
+		return
+	}
+	params.Limit, err = parsePageLimit(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	results, err := cfg.db.SearchVideos(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	resp := []searchResult{}
+	for _, result := range results {
+		resp = append(resp, searchResult{
+			publicVideo: newPublicVideo(result.Video),
+			Rank:        result.Rank,
+			Snippet:     result.Snippet,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerVideosSearch(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	viewer, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "viewer@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots unboxing", Visibility: database.VideoVisibilityPublic, UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.CreateSubtitleTrack(ctx, database.CreateSubtitleTrackParams{VideoID: video.ID, Language: "en", Label: "English", URL: "u", FilePath: "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query url.Values) (int, []map[string]any) {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodGet, "/api/videos/search?"+query.Encode(), viewer.ID)
+		rec := httptest.NewRecorder()
+		cfg.handlerVideosSearch(rec, req)
+		var results []map[string]any
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, results
+	}
+
+	code, results := search(url.Values{"q": {"boots"}})
+	if code != http.StatusOK || len(results) != 1 || results[0]["id"] != video.ID.String() {
+		t.Fatalf("search = %d %v", code, results)
+	}
+	// Someone else's public video doesn't give away who owns it or anything
+	// only the owner works with.
+	for _, field := range []string{"user_id", "current_version_id", "subtitles", "deleted_at", "updated_at", "audio_url"} {
+		if _, ok := results[0][field]; ok {
+			t.Errorf("search result exposes %s: %v", field, results[0])
+		}
+	}
+	for _, field := range []string{"title", "visibility", "rank", "snippet"} {
+		if _, ok := results[0][field]; !ok {
+			t.Errorf("search result is missing %s: %v", field, results[0])
+		}
+	}
+
+	if code, results := search(url.Values{"q": {"boots"}, "scope": {"mine"}}); code != http.StatusOK || len(results) != 0 {
+		t.Errorf("own search = %d %v", code, results)
+	}
+	for _, query := range []url.Values{
+		{},
+		{"q": {"boots"}, "scope": {"theirs"}},
+		{"q": {"boots"}, "limit": {"0"}},
+	} {
+		if code, _ := search(query); code != http.StatusBadRequest {
+			t.Errorf("%v = %d", query, code)
+		}
+	}
+}
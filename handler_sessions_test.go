@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerSessions(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"laptop", "phone"} {
+		_, err := cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: token, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loggedIn, err := cfg.db.GetRefreshToken(ctx, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer laptop")
+	req.Header.Set("User-Agent", "Firefox")
+	rec := httptest.NewRecorder()
+	cfg.handlerRefresh(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh = %d", rec.Code)
+	}
+
+	list := func() []database.Session {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerSessionsGet(rec, newAuthedRequest(t, cfg, http.MethodGet, "/api/sessions", user.ID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list sessions = %d", rec.Code)
+		}
+		var sessions []database.Session
+		if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+			t.Fatal(err)
+		}
+		return sessions
+	}
+	revoke := func(userID uuid.UUID, sessionID string) int {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodDelete, "/api/sessions/"+sessionID, userID)
+		req.SetPathValue("sessionID", sessionID)
+		rec := httptest.NewRecorder()
+		cfg.handlerSessionDelete(rec, req)
+		return rec.Code
+	}
+
+	sessions := list()
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	laptop, err := cfg.db.GetRefreshToken(ctx, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range sessions {
+		if session.ID == laptop.FamilyID && (session.UserAgent != "Firefox" || session.IPAddress != "192.0.2.1" || !session.LastUsedAt.After(loggedIn.LastUsedAt)) {
+			t.Errorf("refreshed session = %+v", session)
+		}
+	}
+
+	if code := revoke(uuid.New(), laptop.FamilyID.String()); code != http.StatusNotFound {
+		t.Errorf("revoking someone else's session = %d", code)
+	}
+	if code := revoke(user.ID, laptop.FamilyID.String()); code != http.StatusNoContent {
+		t.Errorf("revoking a session = %d", code)
+	}
+	if sessions := list(); len(sessions) != 1 || sessions[0].ID == laptop.FamilyID {
+		t.Errorf("sessions after revoking one = %+v", sessions)
+	}
+
+	rec = httptest.NewRecorder()
+	cfg.handlerSessionsDelete(rec, newAuthedRequest(t, cfg, http.MethodDelete, "/api/sessions", user.ID))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("log out everywhere = %d", rec.Code)
+	}
+	if sessions := list(); len(sessions) != 0 {
+		t.Errorf("sessions after logging out everywhere = %+v", sessions)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerSubtitleUpload(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't add subtitles to this video", errors.New("video not owned by user"))
+		return
+	}
+
+	const maxSubtitleSize = 2 << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubtitleSize)
+	err = r.ParseMultipartForm(maxSubtitleSize)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
+		return
+	}
+
+	language := strings.TrimSpace(r.FormValue("language"))
+	if !subtitleLanguagePattern.MatchString(language) {
+		respondWithError(w, http.StatusBadRequest, "Invalid language code", fmt.Errorf("provided language: %q", language))
+		return
+	}
+	label := strings.TrimSpace(r.FormValue("label"))
+	if label == "" {
+		label = language
+	}
+
+	file, _, err := r.FormFile("subtitle")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Could not get subtitle file", err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to read subtitle file", err)
+		return
+	}
+
+	webVTT, err := convertSubtitlesToWebVTT(data)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid subtitle file: %s", err), err)
+		return
+	}
+
+	assetPath := getAssetPath("vtt")
+	diskPath := cfg.getAssetDiskPath(assetPath)
+	err = os.WriteFile(diskPath, webVTT, 0644)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to save subtitle file", err)
+		return
+	}
+
+	track, err := cfg.db.CreateSubtitleTrack(r.Context(), database.CreateSubtitleTrackParams{
+		VideoID:  videoID,
+		Language: language,
+		Label:    label,
+		URL:      cfg.getAssetURL(assetPath),
+		FilePath: diskPath,
+	})
+	if err != nil {
+		os.Remove(diskPath)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save subtitle track", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, track)
+}
+
+func (cfg *apiConfig) handlerSubtitlesGet(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	viewerID, err := cfg.optionalViewerID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && (video.DeletedAt != nil || !canViewVideo(video, viewerID))) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	tracks, err := cfg.db.GetSubtitleTracks(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve subtitle tracks", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tracks)
+}
+
+func (cfg *apiConfig) handlerSubtitleDelete(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	trackID, err := uuid.Parse(r.PathValue("trackID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid track ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't delete subtitles from this video", errors.New("video not owned by user"))
+		return
+	}
+
+	track, err := cfg.db.GetSubtitleTrack(r.Context(), trackID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && track.VideoID != videoID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get subtitle track", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subtitle track", err)
+		return
+	}
+
+	err = cfg.db.DeleteSubtitleTrack(r.Context(), trackID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete subtitle track", err)
+		return
+	}
+	os.Remove(track.FilePath)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newFormFileRequest builds an authenticated multipart request with the given
+// form fields and one file part.
+func newFormFileRequest(t *testing.T, cfg *apiConfig, target string, userID uuid.UUID, fields map[string]string, fileField, contentType string, content []byte) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+fileField+`"; filename="upload"`)
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := newAuthedRequest(t, cfg, http.MethodPost, target, userID)
+	req.ContentLength = int64(body.Len())
+	req.Body = io.NopCloser(body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestHandlerSubtitles(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	cfg.assetsRoot = t.TempDir()
+	cfg.host = "http://localhost"
+	cfg.port = "8091"
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(userID uuid.UUID, language, subtitles string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := newFormFileRequest(t, cfg, "/api/videos/"+video.ID.String()+"/subtitles", userID,
+			map[string]string{"language": language, "label": "English"}, "subtitle", "application/x-subrip", []byte(subtitles))
+		req.SetPathValue("videoID", video.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerSubtitleUpload(rec, req)
+		return rec
+	}
+
+	srt := "1\n00:00:01,000 --> 00:00:04,000\nHello there\n"
+	rec := upload(owner.ID, "en", srt)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+	var track database.SubtitleTrack
+	if err := json.Unmarshal(rec.Body.Bytes(), &track); err != nil {
+		t.Fatal(err)
+	}
+	if track.Language != "en" || track.Label != "English" || track.VideoID != video.ID {
+		t.Errorf("track = %+v", track)
+	}
+	assetPath, ok := cfg.getAssetPathFromURL(track.URL)
+	if !ok || track.URL != "http://localhost:8091/"+cfg.getAssetDiskPath(assetPath) || !strings.HasSuffix(assetPath, ".vtt") {
+		t.Errorf("track URL = %s", track.URL)
+	}
+	diskPath := cfg.getAssetDiskPath(assetPath)
+	stored, err := os.ReadFile(diskPath)
+	if err != nil || !strings.HasPrefix(string(stored), "WEBVTT\n\n00:00:01.000 --> 00:00:04.000\nHello there") {
+		t.Errorf("stored subtitles = %q, %v", stored, err)
+	}
+
+	got, err := cfg.db.GetVideo(ctx, video.ID)
+	if err != nil || len(got.Subtitles) != 1 || got.Subtitles[0].ID != track.ID {
+		t.Errorf("video subtitles = %+v, %v", got.Subtitles, err)
+	}
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"bad language":   upload(owner.ID, "not a language", srt),
+		"bad subtitles":  upload(owner.ID, "en", "1\n00:00:04,000 --> 00:00:01,000\nBackwards\n"),
+		"someone else's": upload(uuid.New(), "en", srt),
+	} {
+		want := http.StatusBadRequest
+		if name == "someone else's" {
+			want = http.StatusForbidden
+		}
+		if rec.Code != want {
+			t.Errorf("%s upload = %d, want %d", name, rec.Code, want)
+		}
+	}
+
+	req := newAuthedRequest(t, cfg, http.MethodDelete, "/api/videos/"+video.ID.String()+"/subtitles/"+track.ID.String(), owner.ID)
+	req.SetPathValue("videoID", video.ID.String())
+	req.SetPathValue("trackID", track.ID.String())
+	rec = httptest.NewRecorder()
+	cfg.handlerSubtitleDelete(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d", rec.Code)
+	}
+	if _, err := os.Stat(diskPath); !os.IsNotExist(err) {
+		t.Errorf("subtitle file left behind: %v", err)
+	}
+	if tracks, err := cfg.db.GetSubtitleTracks(ctx, video.ID); err != nil || len(tracks) != 0 {
+		t.Errorf("tracks after delete = %+v, %v", tracks, err)
+	}
+}
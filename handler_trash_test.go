@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/admission"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestAPIConfig serves handlers from an in-memory store. Processing runs
+// one job at a time.
+func newTestAPIConfig() *apiConfig {
+	return &apiConfig{
+		db:        database.NewMemoryStore(),
+		jwtSecret: "test-secret",
+		trash:     trashSettings{Retention: time.Hour},
+		processing: &processingAdmission{
+			limiter:    admission.NewLimiter(admission.Config{MaxJobs: 1, MaxJobsPerUser: 1, MaxQueued: 1, MaxWait: time.Second}),
+			retryAfter: 5 * time.Second,
+		},
+	}
+}
+
+// newAuthedRequest builds a request carrying an access token for userID.
+func newAuthedRequest(t *testing.T, cfg *apiConfig, method, target string, userID uuid.UUID) *http.Request {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestHandlerTrashRestore(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restore := func(videoID, userID uuid.UUID) int {
+		req := newAuthedRequest(t, cfg, http.MethodPost, "/api/trash/"+videoID.String()+"/restore", userID)
+		req.SetPathValue("videoID", videoID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerTrashRestore(rec, req)
+		return rec.Code
+	}
+
+	if code := restore(video.ID, owner.ID); code != http.StatusNotFound {
+		t.Errorf("restoring a video that isn't trashed returned %d", code)
+	}
+	if code := restore(uuid.New(), owner.ID); code != http.StatusNotFound {
+		t.Errorf("restoring a video that doesn't exist returned %d", code)
+	}
+
+	err = cfg.db.TrashVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := restore(video.ID, uuid.New()); code != http.StatusForbidden {
+		t.Errorf("restoring someone else's video returned %d", code)
+	}
+	if code := restore(video.ID, owner.ID); code != http.StatusOK {
+		t.Fatalf("restoring returned %d", code)
+	}
+
+	restored, err := cfg.db.GetVideo(ctx, video.ID)
+	if err != nil || restored.DeletedAt != nil {
+		t.Fatalf("video is still trashed: %+v, %v", restored, err)
+	}
+}
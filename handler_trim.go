@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoTrim(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Start        string `json:"start"`
+		End          string `json:"end"`
+		Mode         string `json:"mode"`
+		KeepOriginal bool   `json:"keep_original"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Mode == "" {
+		params.Mode = trimModeCopy
+	}
+	if params.Mode != trimModeCopy && params.Mode != trimModeReencode {
+		respondWithError(w, http.StatusBadRequest, "Mode must be copy or reencode", fmt.Errorf("provided mode: %s", params.Mode))
+		return
+	}
+
+	start, err := parseClipTimestamp(params.Start)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid start timestamp", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && video.DeletedAt != nil) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't trim this video", errors.New("video not owned by user"))
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusBadRequest, "Video has no uploaded file to trim", nil)
+		return
+	}
+	sourceKey, ok := cfg.getObjectKey(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Video file isn't stored in the bucket", fmt.Errorf("unexpected video url: %s", *video.VideoURL))
+		return
+	}
+
+	release, ok := cfg.admitProcessingJob(w, r, userID, video.VideoBytes)
+	if !ok {
+		return
+	}
+	defer release()
+
+	sourceFilePath, err := cfg.downloadObject(r.Context(), sourceKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to fetch the stored video", err)
+		return
+	}
+	defer os.Remove(sourceFilePath)
+
+	duration, err := getVideoDuration(r.Context(), cfg.ffmpeg, sourceFilePath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video duration", err)
+		return
+	}
+
+	end := duration
+	if params.End != "" {
+		end, err = parseClipTimestamp(params.End)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid end timestamp", err)
+			return
+		}
+	}
+	if end > duration {
+		end = duration
+	}
+	if start >= end {
+		respondWithError(w, http.StatusBadRequest, "Start must be before end and within the video", fmt.Errorf("start %s, end %s, duration %s", start, end, duration))
+		return
+	}
+
+	trimmedFilePath, err := trimVideo(r.Context(), cfg.ffmpeg, sourceFilePath, start, end, params.Mode)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to trim the video", err)
+		return
+	}
+	defer os.Remove(trimmedFilePath)
+
+	chapters, err := cfg.getManualChapterMarkers(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video chapters", err)
+		return
+	}
+	chapters = shiftChaptersForTrim(chapters, start, end)
+
+	processed, err := cfg.processVideo(r.Context(), trimmedFilePath, nil, chapters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to process the video", err)
+		return
+	}
+	defer processed.cleanup()
+
+	previousAudioURL := video.AudioURL
+	err = cfg.publishProcessedVideo(r.Context(), &video, processed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to add the object to the bucket", err)
+		return
+	}
+
+	// The retained source is untrimmed, so reprocessing it would undo the trim.
+	retainedSourceKey := video.SourceKey
+	video.SourceKey = nil
+
+	// Keeping the original leaves it behind as the previous version to roll
+	// back to; otherwise the trim replaces the current version.
+	versionParams := newVideoVersionParams(video, processed, userID, database.VideoVersionSourceTrim, processed.StoredBytes)
+	if params.KeepOriginal {
+		err = cfg.addVideoVersion(r.Context(), &video, versionParams)
+	} else {
+		err = cfg.replaceCurrentVersion(r.Context(), &video, versionParams)
+	}
+	if err != nil {
+		cfg.releaseVersionParamsObjects(r.Context(), versionParams)
+		respondToWriteError(w, "Unable to record the video version", err)
+		return
+	}
+
+	// Old suggestions no longer line up with the clip, so they are always replaced.
+	if len(processed.SuggestedChapters) > 0 {
+		err = cfg.saveSuggestedChapters(r.Context(), video, processed)
+	} else {
+		_, err = cfg.db.ReplaceChapters(r.Context(), video.ID, chapterParamsFromMarkers(chapters, database.ChapterSourceManual))
+	}
+	if err != nil {
+		log.Printf("Couldn't update chapters for trimmed video %s: %v", video.ID, err)
+	}
+
+	if !params.KeepOriginal {
+		err = cfg.releaseObject(r.Context(), sourceKey)
+		if err != nil {
+			log.Printf("Couldn't remove untrimmed source for video %s: %v", video.ID, err)
+		}
+		err = cfg.releaseObjectURL(r.Context(), previousAudioURL)
+		if err != nil {
+			log.Printf("Couldn't remove previous audio rendition for video %s: %v", video.ID, err)
+		}
+		if retainedSourceKey != nil {
+			err = cfg.releaseObject(r.Context(), *retainedSourceKey)
+			if err != nil {
+				log.Printf("Couldn't remove retained source for video %s: %v", video.ID, err)
+			}
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
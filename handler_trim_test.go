@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoTrim(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	bucket := useFakeBucket(t, cfg)
+	runner := newFakeMediaRunner()
+	cfg.ffmpeg = runner
+	cfg.loudnorm = &loudnormSettings{IntegratedLoudness: -16, TruePeak: -1.5, LoudnessRange: 11}
+	mp3 := audioRenditions["mp3"]
+	cfg.audioRendition = &mp3
+
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishTestVideo(t, cfg, &video, "original footage")
+	untrimmedKey, _ := cfg.getObjectKey(*video.VideoURL)
+	untrimmedAudioKey, _ := cfg.getObjectKey(*video.AudioURL)
+
+	trim := func(userID uuid.UUID, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodPost, "/api/videos/"+video.ID.String()+"/trim", userID)
+		req.SetPathValue("videoID", video.ID.String())
+		req.Body = io.NopCloser(strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoTrim(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"start": "4", "end": "1"}`,
+		`{"start": "00:00:11"}`,
+		`{"start": "1", "mode": "fast"}`,
+		`{"start": "soon"}`,
+	} {
+		if rec := trim(owner.ID, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d", body, rec.Code)
+		}
+	}
+	if rec := trim(uuid.New(), `{"start": "1"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("trimming someone else's video = %d", rec.Code)
+	}
+
+	before := len(runner.Calls())
+	rec := trim(owner.ID, `{"start": "1", "end": "00:04.5", "mode": "reencode"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("trim = %d %s", rec.Code, rec.Body)
+	}
+	var trimmed database.Video
+	if err := json.Unmarshal(rec.Body.Bytes(), &trimmed); err != nil {
+		t.Fatal(err)
+	}
+
+	// The clip goes through the same stages as an upload: loudness is
+	// measured and then corrected, and the audio-only rendition is cut from
+	// the fast start output.
+	calls := runner.Calls()[before:]
+	for _, want := range [][]string{
+		{"-ss", "1.000", "-i", "-t", "3.500", "-c:v", "libx264", "-c:a", "aac"},
+		{"-af", "loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json", "-vn", "-f", "null", "-"},
+		{"-af", "loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.20:offset=0.58:linear=true", "-c:v", "copy"},
+		{"-movflags", "faststart"},
+		{"-vn", "-c:a", "libmp3lame", "-q:a", "2", "-f", "mp3"},
+	} {
+		if _, ok := findCall(calls, "ffmpeg", want...); !ok {
+			t.Errorf("no ffmpeg call with %v in:\n%s", want, formatCalls(calls))
+		}
+	}
+	audioCall, _ := findCall(calls, "ffmpeg", "-f", "mp3")
+	fastStartCall, _ := findCall(calls, "ffmpeg", "-movflags", "faststart")
+	if audioCall.Args[2] != fastStartCall.Args[len(fastStartCall.Args)-1] {
+		t.Errorf("audio rendition read %s, not the fast start output", audioCall.Args[2])
+	}
+
+	if trimmed.VideoURL == nil || trimmed.AudioURL == nil || *trimmed.VideoURL == *video.VideoURL || *trimmed.AudioURL == *video.AudioURL {
+		t.Fatalf("trimmed video = %+v", trimmed)
+	}
+	videoKey, _ := cfg.getObjectKey(*trimmed.VideoURL)
+	audioKey, _ := cfg.getObjectKey(*trimmed.AudioURL)
+	if !strings.HasPrefix(videoKey, "landscape/") || !strings.HasPrefix(audioKey, "audio/") || !strings.HasSuffix(audioKey, ".mp3") {
+		t.Errorf("trimmed keys = %s, %s", videoKey, audioKey)
+	}
+	for _, key := range []string{videoKey, audioKey} {
+		if _, ok := bucket.object(key); !ok {
+			t.Errorf("%s wasn't uploaded", key)
+		}
+	}
+	// Without keep_original the trim replaces the current version and its
+	// objects go.
+	for _, key := range []string{untrimmedKey, untrimmedAudioKey} {
+		if _, ok := bucket.object(key); ok {
+			t.Errorf("%s is still in the bucket", key)
+		}
+	}
+	versions, err := cfg.db.GetVideoVersions(ctx, video.ID)
+	if err != nil || len(versions) != 1 || versions[0].Source != database.VideoVersionSourceTrim || versions[0].VideoURL != *trimmed.VideoURL {
+		t.Errorf("versions after trim = %+v, %v", versions, err)
+	}
+
+	rec = trim(owner.ID, `{"start": "0.5", "keep_original": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("trim keeping the original = %d %s", rec.Code, rec.Body)
+	}
+	if _, ok := findCall(runner.Calls(), "ffmpeg", "-ss", "0.500", "-t", "9.500", "-c", "copy", "-avoid_negative_ts", "make_zero"); !ok {
+		t.Errorf("no copy mode trim in:\n%s", formatCalls(runner.Calls()))
+	}
+	if _, ok := bucket.object(videoKey); !ok {
+		t.Errorf("keep_original removed the previous rendition %s", videoKey)
+	}
+	if versions, err := cfg.db.GetVideoVersions(ctx, video.ID); err != nil || len(versions) != 2 {
+		t.Errorf("versions after keeping the original = %+v, %v", versions, err)
+	}
+}
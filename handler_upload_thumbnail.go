@@ -1,15 +1,12 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"os"
-	"path/filepath"
 	"slices"
 	"strings"
 
@@ -70,7 +67,7 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	}
 	
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Unable to read request body", err)
 		return
@@ -81,18 +78,14 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	encoding := base64.RawURLEncoding
-	randBytes := make([]byte, 32)
-	rand.Read(randBytes)
-	randBase64String := encoding.EncodeToString(randBytes)
-
 	fileExtension := strings.Split(mediaType, "/")[1]
-	videoFilePath := filepath.Join(cfg.assetsRoot, fmt.Sprintf("%s.%s", randBase64String, fileExtension))
-	destFile, err := os.Create(videoFilePath)
+	assetPath := getAssetPath(fileExtension)
+	destFile, err := os.Create(cfg.getAssetDiskPath(assetPath))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Unable to create video file", err)
 		return
 	}
+	defer destFile.Close()
 
 	result, err := io.Copy(destFile, file)
 	if err != nil {
@@ -103,13 +96,14 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 
 	fmt.Printf("Bytes copied: %d\n", result)
 
-	hostWithPort := fmt.Sprintf("%s:%s",cfg.host, cfg.port)
-	fullPath := fmt.Sprintf("%s/%s", hostWithPort, videoFilePath)  
-	video.ThumbnailURL = &fullPath
+	thumbnailURL := cfg.getAssetURL(assetPath)
+	video.ThumbnailURL = &thumbnailURL
+	video.ThumbnailBytes = result
 
-	updateVideoErr := cfg.db.UpdateVideo(video)
+	updateVideoErr := cfg.db.UpdateVideo(r.Context(), video)
 	if updateVideoErr != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video", updateVideoErr)
+		os.Remove(cfg.getAssetDiskPath(assetPath))
+		respondToWriteError(w, "Unable to update video", updateVideoErr)
 		return
 	}
 
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerUploadThumbnail(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	cfg.assetsRoot = t.TempDir()
+	cfg.host = "http://localhost"
+	cfg.port = "8091"
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := []byte("\x89PNG not really")
+	req := newFormFileRequest(t, cfg, "/api/thumbnail_upload/"+video.ID.String(), owner.ID, nil, "thumbnail", "image/png", image)
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+	}
+
+	video, err = cfg.db.GetVideo(ctx, video.ID)
+	if err != nil || video.ThumbnailURL == nil {
+		t.Fatalf("video after upload = %+v, %v", video, err)
+	}
+	// Thumbnail URLs are the file's disk path under the host, as they were
+	// before subtitles shared the asset helpers.
+	assetPath, ok := cfg.getAssetPathFromURL(*video.ThumbnailURL)
+	if !ok || *video.ThumbnailURL != "http://localhost:8091/"+filepath.Join(cfg.assetsRoot, assetPath) || filepath.Ext(assetPath) != ".png" {
+		t.Errorf("thumbnail URL = %s", *video.ThumbnailURL)
+	}
+	stored, err := os.ReadFile(cfg.getAssetDiskPath(assetPath))
+	if err != nil || !bytes.Equal(stored, image) {
+		t.Errorf("stored thumbnail = %q, %v", stored, err)
+	}
+	if video.ThumbnailBytes != int64(len(image)) {
+		t.Errorf("thumbnail bytes = %d", video.ThumbnailBytes)
+	}
+
+	for _, assetURL := range []string{
+		"http://localhost:8091/" + cfg.assetsRoot + "/",
+		"http://localhost:8091/" + cfg.assetsRoot + "/../" + assetPath,
+		"http://localhost:8091/" + filepath.Join(cfg.assetsRoot, "nested", assetPath),
+		"http://example.com:8091/" + filepath.Join(cfg.assetsRoot, assetPath),
+	} {
+		if assetPath, ok := cfg.getAssetPathFromURL(assetURL); ok {
+			t.Errorf("%s mapped to asset %q", assetURL, assetPath)
+		}
+	}
+}
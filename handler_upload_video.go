@@ -1,34 +1,29 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"log"
 	"mime"
 	"net/http"
 	"os"
-	"os/exec"
+	"strconv"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
 	"github.com/google/uuid"
 )
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-	var buffer bytes.Buffer
-	cmd.Stdout = &buffer
-	err := cmd.Run()
-
+func getVideoAspectRatio(ctx context.Context, runner ffmpeg.Runner, filePath string) (string, error) {
+	result, err := runner.Run(ctx, "ffprobe", "-v", "error", "-select_streams", "v:0", "-print_format", "json", "-show_streams", filePath)
 	if err != nil {
-		return "", fmt.Errorf("unable to run command with filePath %s. cmd: %s, error: %s", filePath, cmd.String(), err)
+		return "", fmt.Errorf("unable to probe streams of %s: %w", filePath, err)
 	}
 
-
 	type stream struct {
 		Width int `json:"width"`
 		Height int `json:"height"`
@@ -38,20 +33,46 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	}
 
 	outputStream := streams{}
-	err = json.Unmarshal(buffer.Bytes(), &outputStream)
+	err = json.Unmarshal(result.Stdout, &outputStream)
 
 	if err != nil {
 		return "", fmt.Errorf("unable to unmarshal the stream: %s", err)
 	}
-
+	if len(outputStream.Streams) == 0 {
+		return "", fmt.Errorf("no video stream in %s", filePath)
+	}
 
 	return GetVideoAspectRatio(outputStream.Streams[0].Width, outputStream.Streams[0].Height), nil
 
 }
 
+func getVideoDuration(ctx context.Context, runner ffmpeg.Runner, filePath string) (time.Duration, error) {
+	result, err := runner.Run(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", filePath)
+	if err != nil {
+		return 0, fmt.Errorf("unable to probe format of %s: %w", filePath, err)
+	}
+
+	output := struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}{}
+	err = json.Unmarshal(result.Stdout, &output)
+	if err != nil {
+		return 0, fmt.Errorf("unable to unmarshal the format: %s", err)
+	}
+
+	seconds, err := strconv.ParseFloat(output.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse duration %q: %s", output.Format.Duration, err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	maxUploadLimit := 1 << 30
-	http.MaxBytesReader(w, r.Body, int64(maxUploadLimit))
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxUploadLimit))
 
 	videoID := r.PathValue("videoID")
 	videoUUID, err := uuid.Parse(videoID)
@@ -71,8 +92,8 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoUUID)
-	if err != nil {
+	video, err := cfg.db.GetVideo(r.Context(), videoUUID)
+	if err != nil || video.DeletedAt != nil {
 		respondWithError(w, http.StatusNotFound, "Could not find video", err)
 		return
 	}
@@ -82,96 +103,119 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	videoFile, videoFileHeader, err := r.FormFile("video")	
+	remainingBytes, err := cfg.db.GetRemainingBytes(r.Context(), userID)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Could not get video file", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to check storage quota", err)
 		return
 	}
+	if remainingBytes >= 0 {
+		if remainingBytes == 0 || r.ContentLength > remainingBytes {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Upload would exceed your storage quota", fmt.Errorf("%d bytes left", remainingBytes))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, remainingBytes)
+	}
 
-	defer videoFile.Close()
-
-	mediaType, _, err := mime.ParseMediaType(videoFileHeader.Header.Get("Content-Type"))
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to parse media type", err)
+	expectedBytes := r.ContentLength
+	if expectedBytes <= 0 {
+		expectedBytes = int64(maxUploadLimit)
+	}
+	releaseDisk, ok := cfg.reserveProcessingDiskSpace(w, expectedBytes)
+	if !ok {
 		return
 	}
+	defer releaseDisk()
 
-	if mediaType != "video/mp4" {
-		respondWithError(w, http.StatusBadRequest, "Unsupported media type", fmt.Errorf("provided media type: %s", mediaType))
+	upload, err := receiveMultipartFile(r, "video")
+	if err != nil {
+		respondToUploadError(w, r, err)
 		return
 	}
+	defer os.Remove(upload.FilePath)
+	log.Printf("Received %d bytes for video %s (sha256 %s)", upload.Size, video.ID, upload.SHA256)
 
-	placeholderFilename := "tubely-upload-placeholder.mp4"
-	tempFile, err := os.CreateTemp("", placeholderFilename)	
+	mediaType, _, err := mime.ParseMediaType(upload.ContentType)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to create temporary placeholder", err)
+		respondWithError(w, http.StatusBadRequest, "Unable to parse media type", err)
 		return
 	}
 
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()	
-
-	_, err = io.Copy(tempFile, videoFile)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to copy to temp file", err)
+	if mediaType != "video/mp4" {
+		respondWithError(w, http.StatusBadRequest, "Unsupported media type", fmt.Errorf("provided media type: %s", mediaType))
 		return
 	}
 
-	processedVideoFilePath, err := processVideoForFastStart(tempFile.Name())
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to fast start the video", err)
+	release, ok := cfg.acquireProcessingSlot(w, r, userID)
+	if !ok {
 		return
 	}
+	defer release()
 
-	processedVideoFile, err := os.Open(processedVideoFilePath)	
+	watermark, err := cfg.getWatermarkSettings(r.Context(), userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to open processed video file", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to get watermark settings", err)
 		return
 	}
 
-	_, err = processedVideoFile.Seek(0, io.SeekStart)
+	chapters, err := cfg.getManualChapterMarkers(r.Context(), video)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to offset to the beginning of the temp file", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video chapters", err)
 		return
 	}
 
-	aspectRatio, err := getVideoAspectRatio(processedVideoFile.Name())
-
+	processed, err := cfg.processVideo(r.Context(), upload.FilePath, watermark, chapters)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to get video aspect ratio", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to process the video", err)
 		return
 	}
+	defer processed.cleanup()
 
-	aspectRatioText := aspectRatioToText(aspectRatio)
+	retainSource := watermark != nil && watermark.RetainSource
+	storedBytes := processed.StoredBytes
+	if retainSource {
+		storedBytes += upload.Size
+	}
+	// The store enforces the quota when the version is recorded; this only
+	// saves uploading a video that clearly won't fit.
+	if remainingBytes >= 0 && storedBytes > remainingBytes {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Processed video would exceed your storage quota", fmt.Errorf("%d bytes needed, %d bytes left", storedBytes, remainingBytes))
+		return
+	}
 
-	
-	encoding := base64.RawURLEncoding
-	randBytes := make([]byte, 32)
-	rand.Read(randBytes)
-	randBase64String := encoding.EncodeToString(randBytes)
-	s3ObjectKey := fmt.Sprintf("%s/%s.mp4", aspectRatioText, randBase64String)
-	params := s3.PutObjectInput{
-		Bucket: &cfg.s3Bucket,
-		Key: &s3ObjectKey,
-		Body: processedVideoFile,
-		ContentType: &mediaType,
+	video.SourceKey = nil
+	if retainSource {
+		sourceKey, err := cfg.uploadSourceObject(r.Context(), upload.FilePath, mediaType)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to retain the source video", err)
+			return
+		}
+		video.SourceKey = &sourceKey
 	}
 
-	_, err = cfg.s3Client.PutObject(r.Context(), &params)
+	err = cfg.publishProcessedVideo(r.Context(), &video, processed)
 	if err != nil {
+		if video.SourceKey != nil {
+			cfg.releaseObject(r.Context(), *video.SourceKey)
+		}
 		respondWithError(w, http.StatusInternalServerError, "Unable to add the object to the bucket", err)
 		return
 	}
 
-	newURL := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, s3ObjectKey)
-	video.VideoURL = &newURL
-
-	err = cfg.db.UpdateVideo(video)
+	versionParams := newVideoVersionParams(video, processed, userID, database.VideoVersionSourceUpload, storedBytes)
+	versionParams.ContentSHA256 = &upload.SHA256
+	err = cfg.addVideoVersion(r.Context(), &video, versionParams)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
+		cfg.releaseVersionParamsObjects(r.Context(), versionParams)
+		respondToWriteError(w, "Unable to record the video version", err)
 		return
 	}
 
+	err = cfg.saveSuggestedChapters(r.Context(), video, processed)
+	if err != nil {
+		log.Printf("Couldn't save suggested chapters for video %s: %v", video.ID, err)
+	}
+
+
 
 	videoInBytes, err := json.Marshal(&video)
 	if err != nil {
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadVideoTakesSlotAfterBody(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	useFakeBucket(t, cfg)
+	cfg.ffmpeg = newFakeMediaRunner()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := newMultipartRequest(t, "video", []byte("footage"))
+	full, err := io.ReadAll(form.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newUploadRequest := func(body io.Reader) *http.Request {
+		req := newAuthedRequest(t, cfg, http.MethodPost, "/api/video_upload/"+video.ID.String(), owner.ID)
+		req.Header.Set("Content-Type", form.Header.Get("Content-Type"))
+		req.Body = io.NopCloser(body)
+		req.SetPathValue("videoID", video.ID.String())
+		return req
+	}
+
+	// Feed the body slowly through a pipe. While it trickles in, the only
+	// processing slot stays free for someone else's job.
+	bodyReader, bodyWriter := io.Pipe()
+	req := newUploadRequest(bodyReader)
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		cfg.handlerUploadVideo(rec, req)
+		done <- rec
+	}()
+	bodyWriter.Write(full[:len(full)/2])
+
+	acquireCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	release, err := cfg.processing.limiter.Acquire(acquireCtx, uuid.NewString())
+	if err != nil {
+		t.Fatalf("a slow upload is holding the processing slot: %v", err)
+	}
+	release()
+
+	bodyWriter.Write(full[len(full)/2:])
+	bodyWriter.Close()
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Fatalf("slow upload = %d %s", rec.Code, rec.Body)
+	}
+
+	// Once the body is in, the user's job limit applies as before.
+	release, err = cfg.processing.limiter.Acquire(ctx, owner.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(bytes.NewReader(full)))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("upload over the job limit = %d %v", rec.Code, rec.Header())
+	}
+}
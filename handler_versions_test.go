@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoVersions(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	bucket := useFakeBucket(t, cfg)
+	cfg.ffmpeg = newFakeMediaRunner()
+
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishTestVideo(t, cfg, &video, "first cut")
+	first := *video.CurrentVersionID
+	firstURL := *video.VideoURL
+	publishTestVideo(t, cfg, &video, "second cut")
+	second := *video.CurrentVersionID
+
+	list := func(userID uuid.UUID) (int, []database.VideoVersion) {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodGet, "/api/videos/"+video.ID.String()+"/versions", userID)
+		req.SetPathValue("videoID", video.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoVersionsGet(rec, req)
+		var versions []database.VideoVersion
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &versions); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, versions
+	}
+	rollback := func(userID uuid.UUID, versionID string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodPost, "/api/videos/"+video.ID.String()+"/versions/"+versionID+"/rollback", userID)
+		req.SetPathValue("videoID", video.ID.String())
+		req.SetPathValue("versionID", versionID)
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoVersionRollback(rec, req)
+		return rec
+	}
+
+	code, versions := list(owner.ID)
+	if code != http.StatusOK || len(versions) != 2 {
+		t.Fatalf("versions = %d %+v", code, versions)
+	}
+	ids := []uuid.UUID{versions[0].ID, versions[1].ID}
+	if !slices.Contains(ids, first) || !slices.Contains(ids, second) {
+		t.Errorf("versions = %+v", versions)
+	}
+	if code, _ := list(uuid.New()); code != http.StatusForbidden {
+		t.Errorf("listing someone else's versions = %d", code)
+	}
+
+	// Superseded versions keep their objects, so rolling back only moves the
+	// video's URLs.
+	puts := bucket.putCount()
+	rec := rollback(owner.ID, first.String())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rollback = %d %s", rec.Code, rec.Body)
+	}
+	video, err = cfg.db.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *video.CurrentVersionID != first || *video.VideoURL != firstURL {
+		t.Errorf("video after rollback = %+v", video)
+	}
+	firstKey, _ := cfg.getObjectKey(firstURL)
+	if data, ok := bucket.object(firstKey); !ok || !strings.HasPrefix(string(data), "first cut") {
+		t.Errorf("first version's object = %q, %v", data, ok)
+	}
+	if bucket.putCount() != puts {
+		t.Errorf("rollback uploaded %d objects", bucket.putCount()-puts)
+	}
+
+	other, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Other", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishTestVideo(t, cfg, &other, "other footage")
+	for versionID, want := range map[string]int{
+		"not-a-uuid":                    http.StatusBadRequest,
+		uuid.NewString():                http.StatusNotFound,
+		other.CurrentVersionID.String(): http.StatusNotFound,
+	} {
+		if rec := rollback(owner.ID, versionID); rec.Code != want {
+			t.Errorf("rollback to %s = %d, expected %d", versionID, rec.Code, want)
+		}
+	}
+	if rec := rollback(uuid.New(), second.String()); rec.Code != http.StatusForbidden {
+		t.Errorf("rolling back someone else's video = %d", rec.Code)
+	}
+
+	// Trashed videos can't be changed until they're restored.
+	err = cfg.db.TrashVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := rollback(owner.ID, second.String()); rec.Code != http.StatusNotFound {
+		t.Errorf("rolling back a trashed video = %d", rec.Code)
+	}
+	req := newAuthedRequest(t, cfg, http.MethodPost, "/api/videos/"+video.ID.String()+"/trim", owner.ID)
+	req.SetPathValue("videoID", video.ID.String())
+	req.Body = io.NopCloser(strings.NewReader(`{"start": "1"}`))
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoTrim(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("trimming a trashed video = %d", rec.Code)
+	}
+	req = newMultipartRequest(t, "video", []byte("third cut"))
+	authed := newAuthedRequest(t, cfg, http.MethodPost, "/api/video_upload/"+video.ID.String(), owner.ID)
+	req.Header.Set("Authorization", authed.Header.Get("Authorization"))
+	req.SetPathValue("videoID", video.ID.String())
+	rec = httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("uploading to a trashed video = %d", rec.Code)
+	}
+}
+
+func TestHandlerVideoTrimReleasesObjectsWhenVersionFails(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	bucket := useFakeBucket(t, cfg)
+	cfg.ffmpeg = newFakeMediaRunner()
+
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishTestVideo(t, cfg, &video, "original footage")
+
+	// Cap the owner at what they already store, so recording the trimmed
+	// version as an extra one fails after its objects were uploaded.
+	usage, err := cfg.db.GetUserUsage(ctx, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.SetUserQuota(ctx, database.SetUserQuotaParams{UserID: owner.ID, MaxBytes: &usage.BytesUsed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := bucket.keys()
+	blobs, err := cfg.db.GetBlobs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := newAuthedRequest(t, cfg, http.MethodPost, "/api/videos/"+video.ID.String()+"/trim", owner.ID)
+	req.SetPathValue("videoID", video.ID.String())
+	req.Body = io.NopCloser(strings.NewReader(`{"start": "1", "keep_original": true}`))
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoTrim(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("trim over quota = %d %s", rec.Code, rec.Body)
+	}
+
+	after := bucket.keys()
+	slices.Sort(keys)
+	slices.Sort(after)
+	if !slices.Equal(keys, after) {
+		t.Errorf("bucket went from %v to %v", keys, after)
+	}
+	afterBlobs, err := cfg.db.GetBlobs(ctx)
+	if err != nil || len(afterBlobs) != len(blobs) {
+		t.Errorf("blobs went from %+v to %+v, %v", blobs, afterBlobs, err)
+	}
+	for _, blob := range afterBlobs {
+		if blob.RefCount != 1 {
+			t.Errorf("blob %s has %d references", blob.ObjectKey, blob.RefCount)
+		}
+	}
+}
@@ -2,13 +2,27 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+)
+
 func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		database.CreateVideoParams
@@ -33,16 +47,171 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	if !validVideoVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be private, unlisted or public", nil)
+		return
+	}
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	video, err := cfg.db.CreateVideo(r.Context(), params.CreateVideoParams)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
+		respondToWriteError(w, "Couldn't create video", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
+// validVideoVisibility accepts the visibilities a video can have, or none to
+// leave the default.
+func validVideoVisibility(visibility string) bool {
+	switch visibility {
+	case "", database.VideoVisibilityPrivate, database.VideoVisibilityUnlisted, database.VideoVisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// videoMetadataProblem describes what is wrong with a title and description,
+// if anything.
+func videoMetadataProblem(title, description string) string {
+	if strings.TrimSpace(title) == "" {
+		return "Title can't be empty"
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return fmt.Sprintf("Title can't be longer than %d characters", maxVideoTitleLength)
+	}
+	if utf8.RuneCountInString(description) > maxVideoDescriptionLength {
+		return fmt.Sprintf("Description can't be longer than %d characters", maxVideoDescriptionLength)
+	}
+	return ""
+}
+
+// handlerVideoMetaPatch applies a JSON Merge Patch (RFC 7396) to the video's
+// title, description and visibility. With If-Match, the patch only applies to
+// the version of the video the client last saw.
+func (cfg *apiConfig) handlerVideoMetaPatch(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/merge-patch+json", err)
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	err = json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil || patch == nil {
+		respondWithError(w, http.StatusBadRequest, "Patch must be a JSON object", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && video.DeletedAt != nil) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", errors.New("video not owned by user"))
+		return
+	}
+
+	matches, conditional := ifMatch(r.Header, videoETag(video))
+	if !matches {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has changed since you fetched it", nil)
+		return
+	}
+
+	params := database.UpdateVideoMetadataParams{
+		ID:          video.ID,
+		Title:       video.Title,
+		Description: video.Description,
+		Visibility:  video.Visibility,
+	}
+	if problem := applyVideoMergePatch(&params, patch); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+	if conditional {
+		params.IfMatch = &video
+	}
+
+	updated, err := cfg.db.UpdateVideoMetadata(r.Context(), params)
+	if errors.Is(err, database.ErrModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has changed since you fetched it", err)
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(updated))
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// applyVideoMergePatch merges patch into params and describes what is wrong
+// with it, if anything. null removes a field, which resets the description to
+// empty and the visibility to private; the title can't be removed.
+func applyVideoMergePatch(params *database.UpdateVideoMetadataParams, patch map[string]json.RawMessage) string {
+	for _, field := range slices.Sorted(maps.Keys(patch)) {
+		raw := patch[field]
+		var target *string
+		switch field {
+		case "title":
+			target = &params.Title
+		case "description":
+			target = &params.Description
+		case "visibility":
+			target = &params.Visibility
+		default:
+			return fmt.Sprintf("%q can't be changed", field)
+		}
+
+		if string(raw) == "null" {
+			switch field {
+			case "title":
+				return "Title can't be removed"
+			case "visibility":
+				*target = database.VideoVisibilityPrivate
+			default:
+				*target = ""
+			}
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return fmt.Sprintf("%s must be a string", field)
+		}
+	}
+
+	if params.Visibility == "" || !validVideoVisibility(params.Visibility) {
+		return "Visibility must be private, unlisted or public"
+	}
+	return videoMetadataProblem(params.Title, params.Description)
+}
+
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -62,17 +231,21 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
 	if video.UserID != userID {
 		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	err = cfg.db.TrashVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -89,16 +262,35 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	viewerID, err := cfg.optionalViewerID(r)
 	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	// Private videos look missing to everyone but their owner.
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && (video.DeletedAt != nil || !canViewVideo(video, viewerID))) {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
 
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusOK, video)
 }
 
+// handlerVideosRetrieve lists the user's videos a page at a time. The response
+// carries a next_cursor to pass back as ?cursor= until it comes back null.
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Videos     []database.Video `json:"videos"`
+		NextCursor *string          `json:"next_cursor"`
+	}
+
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
@@ -110,11 +302,115 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	params, err := parseListVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.UserID = userID
+
+	page, err := cfg.db.ListVideos(r.Context(), params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	resp := response{Videos: page.Videos}
+	if page.Next != nil {
+		nextCursor, err := encodeCursor(page.Next)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+			return
+		}
+		resp.NextCursor = &nextCursor
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// parseListVideosParams reads limit, cursor, sort (created_at, updated_at,
+// title or duration), order (asc or desc, newest first by default),
+// aspect_ratio, status (draft or ready) and an RFC 3339 created_after and
+// created_before.
+func parseListVideosParams(query url.Values) (database.ListVideosParams, error) {
+	params := database.ListVideosParams{
+		Sort:        database.VideoSortCreatedAt,
+		Descending:  true,
+		AspectRatio: query.Get("aspect_ratio"),
+		Status:      query.Get("status"),
+	}
+
+	var err error
+	params.Limit, err = parsePageLimit(query)
+	if err != nil {
+		return params, err
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		switch sort {
+		case database.VideoSortCreatedAt, database.VideoSortUpdatedAt, database.VideoSortTitle, database.VideoSortDuration:
+			params.Sort = sort
+		default:
+			return params, fmt.Errorf("invalid sort %q", sort)
+		}
+	}
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		params.Descending = false
+	default:
+		return params, fmt.Errorf("invalid order %q", order)
+	}
+
+	switch params.AspectRatio {
+	case "", "16:9", "9:16", "other":
+	default:
+		return params, fmt.Errorf("invalid aspect_ratio %q", params.AspectRatio)
+	}
+	switch params.Status {
+	case "", database.VideoStatusDraft, database.VideoStatusReady:
+	default:
+		return params, fmt.Errorf("invalid status %q", params.Status)
+	}
+
+	for _, field := range []struct {
+		name  string
+		value **time.Time
+	}{{"created_after", &params.CreatedAfter}, {"created_before", &params.CreatedBefore}} {
+		raw := query.Get(field.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return params, fmt.Errorf("invalid %s %q", field.name, raw)
+		}
+		*field.value = &t
+	}
+
+	params.Tags = query["tag"]
+	switch match := query.Get("tag_match"); match {
+	case "", "any":
+	case "all":
+		params.MatchAllTags = true
+	default:
+		return params, fmt.Errorf("invalid tag_match %q", match)
+	}
+	for _, tag := range params.Tags {
+		if _, err := database.NormalizeTag(tag); err != nil {
+			return params, err
+		}
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		var cursor database.VideoCursor
+		err := decodeCursor(raw, &cursor)
+		if err != nil {
+			return params, err
+		}
+		if cursor.Sort != params.Sort || cursor.Descending != params.Descending {
+			return params, errors.New("cursor doesn't match sort and order")
+		}
+		params.After = &cursor
+	}
+	return params, nil
 }
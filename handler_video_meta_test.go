@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideosRetrievePages(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"Charlie", "Alpha", "Bravo"} {
+		_, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: title, UserID: owner.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query url.Values) (int, []string, *string) {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodGet, "/api/videos?"+query.Encode(), owner.ID)
+		rec := httptest.NewRecorder()
+		cfg.handlerVideosRetrieve(rec, req)
+
+		var resp struct {
+			Videos     []database.Video `json:"videos"`
+			NextCursor *string          `json:"next_cursor"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		titles := []string{}
+		for _, video := range resp.Videos {
+			titles = append(titles, video.Title)
+		}
+		return rec.Code, titles, resp.NextCursor
+	}
+
+	code, titles, next := list(url.Values{"sort": {"title"}, "order": {"asc"}, "limit": {"2"}})
+	if code != http.StatusOK || len(titles) != 2 || titles[0] != "Alpha" || titles[1] != "Bravo" || next == nil {
+		t.Fatalf("first page = %d %v %v", code, titles, next)
+	}
+	code, titles, next = list(url.Values{"sort": {"title"}, "order": {"asc"}, "limit": {"2"}, "cursor": {*next}})
+	if code != http.StatusOK || len(titles) != 1 || titles[0] != "Charlie" || next != nil {
+		t.Fatalf("second page = %d %v %v", code, titles, next)
+	}
+
+	_, _, next = list(url.Values{"sort": {"title"}, "limit": {"1"}})
+	for _, query := range []url.Values{
+		{"cursor": {"not a cursor"}},
+		{"cursor": {*next}},
+		{"sort": {"size"}},
+		{"limit": {"0"}},
+		{"status": {"processing"}},
+		{"created_after": {"yesterday"}},
+		{"tag": {" "}},
+		{"tag_match": {"some"}},
+	} {
+		if code, _, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("%v returned %d", query, code)
+		}
+	}
+}
+
+func TestHandlerVideoMetaPatch(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "other@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", Description: "Old", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(userID uuid.UUID, body, contentType, etag string) (*httptest.ResponseRecorder, database.Video) {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodPatch, "/api/videos/"+video.ID.String(), userID)
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+		req.SetPathValue("videoID", video.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoMetaPatch(rec, req)
+
+		var updated database.Video
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, updated
+	}
+
+	etag := videoETag(video)
+	rec, updated := patch(owner.ID, `{"title": "Hiking boots", "description": null}`, "application/merge-patch+json", etag)
+	if rec.Code != http.StatusOK || updated.Title != "Hiking boots" || updated.Description != "" || updated.Visibility != database.VideoVisibilityPrivate {
+		t.Fatalf("patch = %d %+v", rec.Code, updated)
+	}
+	newETag := rec.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Errorf("ETag after patch = %q, was %q", newETag, etag)
+	}
+
+	if rec, _ := patch(owner.ID, `{"title": "Lost update"}`, "application/merge-patch+json", etag); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match returned %d", rec.Code)
+	}
+	if rec, updated := patch(owner.ID, `{"visibility": "public"}`, "application/merge-patch+json", "W/"+newETag+", "+newETag); rec.Code != http.StatusOK || updated.Title != "Hiking boots" || updated.Visibility != database.VideoVisibilityPublic {
+		t.Errorf("If-Match list returned %d %+v", rec.Code, updated)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		userID      uuid.UUID
+		body        string
+		contentType string
+		want        int
+	}{
+		{"unowned", other.ID, `{"title": "Mine"}`, "application/merge-patch+json", http.StatusForbidden},
+		{"content type", owner.ID, `{"title": "x"}`, "text/plain", http.StatusUnsupportedMediaType},
+		{"not an object", owner.ID, `["title"]`, "application/merge-patch+json", http.StatusBadRequest},
+		{"null title", owner.ID, `{"title": null}`, "application/merge-patch+json", http.StatusBadRequest},
+		{"empty title", owner.ID, `{"title": " "}`, "application/merge-patch+json", http.StatusBadRequest},
+		{"long title", owner.ID, `{"title": "` + strings.Repeat("a", maxVideoTitleLength+1) + `"}`, "application/json", http.StatusBadRequest},
+		{"long description", owner.ID, `{"description": "` + strings.Repeat("a", maxVideoDescriptionLength+1) + `"}`, "application/json", http.StatusBadRequest},
+		{"visibility", owner.ID, `{"visibility": "friends"}`, "application/json", http.StatusBadRequest},
+		{"read-only field", owner.ID, `{"user_id": "` + other.ID.String() + `"}`, "application/json", http.StatusBadRequest},
+		{"wrong type", owner.ID, `{"title": 5}`, "application/json", http.StatusBadRequest},
+	} {
+		if rec, _ := patch(tc.userID, tc.body, tc.contentType, ""); rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	got, err := cfg.db.GetVideo(ctx, video.ID)
+	if err != nil || got.Title != "Hiking boots" || got.UserID != owner.ID {
+		t.Errorf("video after rejected patches = %+v, %v", got, err)
+	}
+}
+
+func TestHandlerVideoGetVisibility(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Private", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlisted, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Unlisted", Visibility: database.VideoVisibilityUnlisted, UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// get asks for the video and its subtitle tracks, which follow the same
+	// rules.
+	get := func(videoID uuid.UUID, viewerID uuid.UUID, token string) (int, int) {
+		t.Helper()
+		codes := []int{}
+		for _, handler := range []http.HandlerFunc{cfg.handlerVideoGet, cfg.handlerSubtitlesGet} {
+			req := httptest.NewRequest(http.MethodGet, "/api/videos/"+videoID.String(), nil)
+			if viewerID != uuid.Nil {
+				req = newAuthedRequest(t, cfg, http.MethodGet, "/api/videos/"+videoID.String(), viewerID)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			req.SetPathValue("videoID", videoID.String())
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			codes = append(codes, rec.Code)
+		}
+		return codes[0], codes[1]
+	}
+
+	for _, tc := range []struct {
+		name     string
+		videoID  uuid.UUID
+		viewerID uuid.UUID
+		token    string
+		want     int
+	}{
+		{"owner", private.ID, owner.ID, "", http.StatusOK},
+		{"someone else", private.ID, uuid.New(), "", http.StatusNotFound},
+		{"anonymous", private.ID, uuid.Nil, "", http.StatusNotFound},
+		{"anonymous on an unlisted video", unlisted.ID, uuid.Nil, "", http.StatusOK},
+		{"bad token", unlisted.ID, uuid.Nil, "nonsense", http.StatusUnauthorized},
+	} {
+		if video, subtitles := get(tc.videoID, tc.viewerID, tc.token); video != tc.want || subtitles != tc.want {
+			t.Errorf("%s = %d and %d, want %d", tc.name, video, subtitles, tc.want)
+		}
+	}
+}
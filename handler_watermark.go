@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerWatermarkUpdate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	const maxMemory = 10 << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxMemory)
+	err = r.ParseMultipartForm(maxMemory)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
+		return
+	}
+
+	existing, err := cfg.db.GetWatermark(r.Context(), userID)
+	hasExisting := err == nil
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+
+	params := database.UpsertWatermarkParams{
+		UserID:   userID,
+		Position: defaultWatermarkPosition,
+		Opacity:  defaultWatermarkOpacity,
+		Scale:    defaultWatermarkScale,
+		Enabled:  true,
+	}
+	if hasExisting {
+		params = existing.UpsertWatermarkParams
+	}
+
+	if position := r.FormValue("position"); position != "" {
+		params.Position = position
+	}
+	for _, field := range []struct {
+		name  string
+		value *float64
+	}{{"opacity", &params.Opacity}, {"scale", &params.Scale}} {
+		if raw := r.FormValue(field.name); raw != "" {
+			*field.value, err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s", field.name), err)
+				return
+			}
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value *bool
+	}{{"enabled", &params.Enabled}, {"retain_source", &params.RetainSource}} {
+		if raw := r.FormValue(field.name); raw != "" {
+			*field.value, err = strconv.ParseBool(raw)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s", field.name), err)
+				return
+			}
+		}
+	}
+
+	err = validateWatermarkSettings(params.Position, params.Opacity, params.Scale)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	file, header, err := r.FormFile("image")
+	switch {
+	case errors.Is(err, http.ErrMissingFile):
+		if !hasExisting {
+			respondWithError(w, http.StatusBadRequest, "A watermark image is required", err)
+			return
+		}
+	case err != nil:
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	default:
+		defer file.Close()
+
+		mediaType, _, err := mime.ParseMediaType(header.Header.Get("Content-Type"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Unable to parse media type", err)
+			return
+		}
+		if !slices.Contains(supportedImageTypes, mediaType) {
+			respondWithError(w, http.StatusBadRequest, "Unsupported media type", fmt.Errorf("provided media type: %s", mediaType))
+			return
+		}
+
+		assetPath := getAssetPath(strings.Split(mediaType, "/")[1])
+		diskPath := cfg.getAssetDiskPath(assetPath)
+		destFile, err := os.Create(diskPath)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to create watermark file", err)
+			return
+		}
+		defer destFile.Close()
+
+		_, err = io.Copy(destFile, file)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to copy file", err)
+			return
+		}
+
+		params.ImageURL = cfg.getAssetURL(assetPath)
+		params.FilePath = diskPath
+	}
+
+	watermark, err := cfg.db.UpsertWatermark(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save watermark", err)
+		return
+	}
+	if existing.FilePath != "" && existing.FilePath != watermark.FilePath {
+		os.Remove(existing.FilePath)
+	}
+
+	respondWithJSON(w, http.StatusOK, watermark)
+}
+
+func (cfg *apiConfig) handlerWatermarkGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	watermark, err := cfg.db.GetWatermark(r.Context(), userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "No watermark configured", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, watermark)
+}
+
+func (cfg *apiConfig) handlerWatermarkDelete(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	watermark, err := cfg.db.GetWatermark(r.Context(), userID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+
+	err = cfg.db.DeleteWatermark(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete watermark", err)
+		return
+	}
+	if watermark.FilePath != "" {
+		os.Remove(watermark.FilePath)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerVideoReprocess rebuilds video_url from the retained un-watermarked
+// source using the caller's current watermark settings.
+func (cfg *apiConfig) handlerVideoReprocess(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't reprocess this video", errors.New("video not owned by user"))
+		return
+	}
+	if video.SourceKey == nil {
+		respondWithError(w, http.StatusConflict, "Video has no retained source to reprocess", nil)
+		return
+	}
+
+	release, ok := cfg.admitProcessingJob(w, r, userID, video.VideoBytes)
+	if !ok {
+		return
+	}
+	defer release()
+
+	watermark, err := cfg.getWatermarkSettings(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark settings", err)
+		return
+	}
+
+	sourceFilePath, err := cfg.downloadObject(r.Context(), *video.SourceKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to fetch the retained source", err)
+		return
+	}
+	defer os.Remove(sourceFilePath)
+	sourceInfo, err := os.Stat(sourceFilePath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read the retained source", err)
+		return
+	}
+
+	chapters, err := cfg.getManualChapterMarkers(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video chapters", err)
+		return
+	}
+
+	processed, err := cfg.processVideo(r.Context(), sourceFilePath, watermark, chapters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to process the video", err)
+		return
+	}
+	defer processed.cleanup()
+
+	previousURLs := []*string{video.VideoURL, video.AudioURL}
+	err = cfg.publishProcessedVideo(r.Context(), &video, processed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to add the object to the bucket", err)
+		return
+	}
+
+	versionParams := newVideoVersionParams(video, processed, userID, "", processed.StoredBytes+sourceInfo.Size())
+	err = cfg.replaceCurrentVersion(r.Context(), &video, versionParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to record the video version", err)
+		return
+	}
+
+	err = cfg.saveSuggestedChapters(r.Context(), video, processed)
+	if err != nil {
+		log.Printf("Couldn't save suggested chapters for video %s: %v", video.ID, err)
+	}
+
+	for _, previousURL := range previousURLs {
+		err = cfg.releaseObjectURL(r.Context(), previousURL)
+		if err != nil {
+			log.Printf("Couldn't remove previous rendition for video %s: %v", video.ID, err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerWatermark(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	cfg.assetsRoot = t.TempDir()
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(fields map[string]string, image []byte) (int, database.Watermark) {
+		t.Helper()
+		// Without an image the file goes in a field the handler ignores.
+		fileField := "image"
+		if image == nil {
+			fileField = "notes"
+		}
+		req := newFormFileRequest(t, cfg, "/api/watermark", owner.ID, fields, fileField, "image/png", image)
+		req.Method = http.MethodPut
+		rec := httptest.NewRecorder()
+		cfg.handlerWatermarkUpdate(rec, req)
+
+		var watermark database.Watermark
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &watermark); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, watermark
+	}
+	get := func(userID uuid.UUID) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerWatermarkGet(rec, newAuthedRequest(t, cfg, http.MethodGet, "/api/watermark", userID))
+		return rec.Code
+	}
+
+	if code := get(owner.ID); code != http.StatusNotFound {
+		t.Errorf("get before any upload = %d", code)
+	}
+	if code, _ := put(map[string]string{"position": "top-left"}, nil); code != http.StatusBadRequest {
+		t.Errorf("first upload without an image = %d", code)
+	}
+
+	code, watermark := put(map[string]string{"position": "top-left", "opacity": "0.8", "retain_source": "true"}, []byte("logo"))
+	if code != http.StatusOK {
+		t.Fatalf("upload = %d", code)
+	}
+	if watermark.Position != "top-left" || watermark.Opacity != 0.8 || watermark.Scale != defaultWatermarkScale || !watermark.Enabled || !watermark.RetainSource {
+		t.Errorf("watermark = %+v", watermark)
+	}
+	stored, err := cfg.db.GetWatermark(ctx, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(stored.FilePath); err != nil || string(data) != "logo" {
+		t.Errorf("stored image = %q, %v", data, err)
+	}
+
+	for _, fields := range []map[string]string{
+		{"position": "middle"},
+		{"opacity": "0"},
+		{"scale": "2"},
+		{"enabled": "maybe"},
+	} {
+		if code, _ := put(fields, nil); code != http.StatusBadRequest {
+			t.Errorf("%v = %d", fields, code)
+		}
+	}
+
+	// Settings can change without re-uploading the image.
+	code, watermark = put(map[string]string{"scale": "0.3"}, nil)
+	if code != http.StatusOK || watermark.Scale != 0.3 || watermark.Position != "top-left" || watermark.ImageURL != stored.ImageURL {
+		t.Errorf("update without image = %d %+v", code, watermark)
+	}
+
+	code, _ = put(nil, []byte("new logo"))
+	if code != http.StatusOK {
+		t.Fatalf("replacing the image = %d", code)
+	}
+	if _, err := os.Stat(stored.FilePath); !os.IsNotExist(err) {
+		t.Errorf("replaced image left behind: %v", err)
+	}
+	stored, err = cfg.db.GetWatermark(ctx, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := get(owner.ID); code != http.StatusOK {
+		t.Errorf("get = %d", code)
+	}
+	if code := get(uuid.New()); code != http.StatusNotFound {
+		t.Errorf("someone else's get = %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerWatermarkDelete(rec, newAuthedRequest(t, cfg, http.MethodDelete, "/api/watermark", owner.ID))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d", rec.Code)
+	}
+	if _, err := os.Stat(stored.FilePath); !os.IsNotExist(err) {
+		t.Errorf("deleted image left behind: %v", err)
+	}
+	if code := get(owner.ID); code != http.StatusNotFound {
+		t.Errorf("get after delete = %d", code)
+	}
+}
+
+func TestHandlerUploadVideoWatermark(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	bucket := useFakeBucket(t, cfg)
+	runner := newFakeMediaRunner()
+	cfg.ffmpeg = runner
+	cfg.defaultWatermark = &watermarkSettings{
+		FilePath:     "/srv/watermark.png",
+		Position:     defaultWatermarkPosition,
+		Opacity:      defaultWatermarkOpacity,
+		Scale:        defaultWatermarkScale,
+		RetainSource: true,
+	}
+
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(content string) {
+		t.Helper()
+		req := newMultipartRequest(t, "video", []byte(content))
+		authed := newAuthedRequest(t, cfg, http.MethodPost, "/api/video_upload/"+video.ID.String(), owner.ID)
+		req.Header.Set("Authorization", authed.Header.Get("Authorization"))
+		req.SetPathValue("videoID", video.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerUploadVideo(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("upload = %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	upload("raw footage")
+	calls := runner.Calls()
+	overlay := "[1:v][0:v]scale2ref=w=main_w*0.15:h=ow/a[wm][base];[wm]format=rgba,colorchannelmixer=aa=0.5[wmo];[base][wmo]overlay=main_w-overlay_w-10:main_h-overlay_h-10[out]"
+	call, ok := findCall(calls, "ffmpeg", "-i", "-i", "/srv/watermark.png", "-filter_complex", overlay, "-map", "[out]", "-c:v", "libx264")
+	if !ok {
+		t.Fatalf("no watermark overlay in:\n%s", formatCalls(calls))
+	}
+	// Watermarking is the first stage; everything after works on its output.
+	fastStart, _ := findCall(calls, "ffmpeg", "-movflags", "faststart")
+	if calls[0].Args[2] != call.Args[2] || fastStart.Args[2] != call.Args[len(call.Args)-1] {
+		t.Errorf("watermark isn't the first stage:\n%s", formatCalls(calls))
+	}
+
+	video, err = cfg.db.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.SourceKey == nil {
+		t.Fatalf("the un-watermarked source wasn't retained: %+v", video)
+	}
+	if source, ok := bucket.object(*video.SourceKey); !ok || string(source) != "raw footage" {
+		t.Errorf("retained source = %q, %v", source, ok)
+	}
+
+	// A user's own disabled watermark turns the default off.
+	_, err = cfg.db.UpsertWatermark(ctx, database.UpsertWatermarkParams{
+		UserID:   owner.ID,
+		Position: "center",
+		Opacity:  1,
+		Scale:    0.5,
+		Enabled:  false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(runner.Calls())
+	upload("more footage")
+	if _, ok := findCall(runner.Calls()[before:], "ffmpeg", "-filter_complex"); ok {
+		t.Errorf("disabled watermark was applied:\n%s", formatCalls(runner.Calls()[before:]))
+	}
+	video, err = cfg.db.GetVideo(ctx, video.ID)
+	if err != nil || video.SourceKey != nil {
+		t.Errorf("source retained without a watermark: %+v, %v", video, err)
+	}
+}
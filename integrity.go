@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// verifyObjectIntegrity checks that the object stored for a blob is still
+// there with the size and SHA-256 we recorded when uploading it.
+func (cfg *apiConfig) verifyObjectIntegrity(ctx context.Context, blob database.Blob) error {
+	expected, err := sha256HexToBase64(blob.Hash)
+	if err != nil {
+		return err
+	}
+
+	output, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       &cfg.s3Bucket,
+		Key:          &blob.ObjectKey,
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return errors.New("object is missing from the bucket")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to head object: %w", err)
+	}
+
+	if output.ContentLength != nil && *output.ContentLength != blob.Size {
+		return fmt.Errorf("size is %d bytes, expected %d", *output.ContentLength, blob.Size)
+	}
+	if output.ChecksumSHA256 == nil {
+		return errors.New("bucket has no SHA-256 checksum for the object")
+	}
+	if *output.ChecksumSHA256 != expected {
+		return fmt.Errorf("checksum is %s, expected %s", *output.ChecksumSHA256, expected)
+	}
+	return nil
+}
+
+// runVerifyIntegrity HeadObjects every stored object and reports the ones that
+// don't match the database. Videos uploaded before checksums were recorded
+// have no blob row, so for those all that can be checked is that the object
+// is there: a missing one fails and one that is there is reported as
+// unverified.
+func (cfg *apiConfig) runVerifyIntegrity(ctx context.Context, out io.Writer) error {
+	blobs, err := cfg.db.GetBlobs(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list stored objects: %w", err)
+	}
+	videoURLs, err := cfg.db.GetVideoURLs(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list video URLs: %w", err)
+	}
+
+	objects, failed := len(blobs), 0
+	checked := map[string]bool{}
+	for _, blob := range blobs {
+		checked[blob.ObjectKey] = true
+		err := cfg.verifyObjectIntegrity(ctx, blob)
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %v\n", blob.ObjectKey, err)
+		}
+	}
+
+	unverified := 0
+	for _, videoURL := range videoURLs {
+		key, ok := cfg.getObjectKey(videoURL)
+		if !ok {
+			objects++
+			unverified++
+			fmt.Fprintf(out, "UNVERIFIED %s: not served from the bucket\n", videoURL)
+			continue
+		}
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		objects++
+
+		exists, err := cfg.objectExists(ctx, key)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %v\n", key, err)
+		case !exists:
+			failed++
+			fmt.Fprintf(out, "FAIL %s: object is missing from the bucket\n", key)
+		default:
+			unverified++
+			fmt.Fprintf(out, "UNVERIFIED %s: no checksum was recorded\n", key)
+		}
+	}
+
+	fmt.Fprintf(out, "checked %d objects, %d failed, %d unverified\n", objects, failed, unverified)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects failed verification", failed, objects)
+	}
+	return nil
+}
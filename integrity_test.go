@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func newTestS3Config(t *testing.T, handler http.HandlerFunc) *apiConfig {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	return &apiConfig{s3Client: client, s3Bucket: "tubely-test"}
+}
+
+func TestVerifyObjectIntegrity(t *testing.T) {
+	content := []byte("processed video")
+	sum := sha256.Sum256(content)
+	blob := database.Blob{CreateBlobParams: database.CreateBlobParams{
+		Hash:      hex.EncodeToString(sum[:]),
+		ObjectKey: "landscape/" + hex.EncodeToString(sum[:]) + ".mp4",
+		Size:      int64(len(content)),
+	}}
+
+	tests := []struct {
+		name     string
+		status   int
+		checksum string
+		size     int
+		wantErr  string
+	}{
+		{name: "match", status: http.StatusOK, checksum: base64.StdEncoding.EncodeToString(sum[:]), size: len(content)},
+		{name: "missing", status: http.StatusNotFound, wantErr: "missing"},
+		{name: "wrong size", status: http.StatusOK, checksum: base64.StdEncoding.EncodeToString(sum[:]), size: 3, wantErr: "size"},
+		{name: "no checksum", status: http.StatusOK, size: len(content), wantErr: "no SHA-256"},
+		{name: "mismatch", status: http.StatusOK, checksum: base64.StdEncoding.EncodeToString(make([]byte, 32)), size: len(content), wantErr: "checksum is"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newTestS3Config(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead || r.Header.Get("X-Amz-Checksum-Mode") != "ENABLED" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				}
+				if tc.checksum != "" {
+					w.Header().Set("X-Amz-Checksum-Sha256", tc.checksum)
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(tc.size))
+				w.WriteHeader(tc.status)
+			})
+
+			err := cfg.verifyObjectIntegrity(context.Background(), blob)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunVerifyIntegrity(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("processed video")
+	sum := sha256.Sum256(content)
+	blobKey := "landscape/" + hex.EncodeToString(sum[:]) + ".mp4"
+
+	heads := map[string]int{}
+	cfg := newTestS3Config(t, func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/tubely-test/")
+		heads[key]++
+		switch key {
+		case blobKey:
+			w.Header().Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sum[:]))
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		case "landscape/legacy.mp4":
+			w.Header().Set("Content-Length", "10")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	cfg.db = database.NewMemoryStore()
+	cfg.s3CfDistribution = "https://cdn.example.com"
+
+	_, _, err := cfg.db.AddBlobReference(ctx, database.CreateBlobParams{Hash: hex.EncodeToString(sum[:]), ObjectKey: blobKey, Size: int64(len(content))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Boots", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first version predates checksums and is gone, the second predates
+	// them and is still there, and the current one has a blob row.
+	for _, key := range []string{"landscape/missing.mp4", "landscape/legacy.mp4", blobKey} {
+		_, err := cfg.db.CreateVideoVersion(ctx, database.CreateVideoVersionParams{VideoID: video.ID, UploadedBy: user.ID, Source: database.VideoVersionSourceUpload, VideoURL: cfg.getObjectURL(key)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	videoURL := cfg.getObjectURL(blobKey)
+	video.VideoURL = &videoURL
+	if err := cfg.db.UpdateVideo(ctx, video); err != nil {
+		t.Fatal(err)
+	}
+	other, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{Title: "Elsewhere", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elsewhere := "https://old-cdn.example.com/landscape/elsewhere.mp4"
+	other.VideoURL = &elsewhere
+	if err := cfg.db.UpdateVideo(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	err = cfg.runVerifyIntegrity(ctx, &out)
+	if err == nil || !strings.Contains(err.Error(), "1 of 4 objects") {
+		t.Errorf("runVerifyIntegrity = %v", err)
+	}
+	for _, want := range []string{
+		"FAIL landscape/missing.mp4: object is missing",
+		"UNVERIFIED landscape/legacy.mp4: no checksum",
+		"UNVERIFIED " + elsewhere + ": not served from the bucket",
+		"checked 4 objects, 1 failed, 2 unverified",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, out.String())
+		}
+	}
+	if heads[blobKey] != 1 {
+		t.Errorf("blob object was checked %d times", heads[blobKey])
+	}
+}
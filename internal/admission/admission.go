@@ -0,0 +1,125 @@
+// Package admission decides whether a new processing job may start, queueing
+// it briefly when the server is busy and refusing it outright when it isn't
+// worth waiting.
+package admission
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUserLimit means the caller already has as many jobs running or queued
+	// as they're allowed.
+	ErrUserLimit = errors.New("too many processing jobs for this user")
+	// ErrQueueFull means every slot is taken and the wait queue is full.
+	ErrQueueFull = errors.New("processing queue is full")
+	// ErrWaitTimeout means the job queued but no slot freed up in time.
+	ErrWaitTimeout = errors.New("timed out waiting for a processing slot")
+	// ErrDiskSpaceUnsupported is returned by FreeDiskSpace on platforms where
+	// free space can't be queried.
+	ErrDiskSpaceUnsupported = errors.New("free disk space is not available on this platform")
+)
+
+type Config struct {
+	MaxJobs        int
+	MaxJobsPerUser int
+	MaxQueued      int
+	MaxWait        time.Duration
+}
+
+type Limiter struct {
+	cfg   Config
+	slots chan struct{}
+
+	mu      sync.Mutex
+	queued  int
+	perUser map[string]int
+}
+
+func NewLimiter(cfg Config) *Limiter {
+	if cfg.MaxJobs < 1 {
+		cfg.MaxJobs = 1
+	}
+	return &Limiter{
+		cfg:     cfg,
+		slots:   make(chan struct{}, cfg.MaxJobs),
+		perUser: map[string]int{},
+	}
+}
+
+// Acquire reserves a job slot for key, waiting in the queue if needed. The
+// returned release func must be called once the job is done.
+func (l *Limiter) Acquire(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	if l.cfg.MaxJobsPerUser > 0 && l.perUser[key] >= l.cfg.MaxJobsPerUser {
+		l.mu.Unlock()
+		return nil, ErrUserLimit
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.perUser[key]++
+		l.mu.Unlock()
+		return l.releaseFunc(key), nil
+	default:
+	}
+
+	if l.queued >= l.cfg.MaxQueued {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	l.queued++
+	l.perUser[key]++
+	l.mu.Unlock()
+
+	dequeue := func(acquired bool) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.queued--
+		if !acquired {
+			l.decrementUser(key)
+		}
+	}
+
+	var timeout <-chan time.Time
+	if l.cfg.MaxWait > 0 {
+		timer := time.NewTimer(l.cfg.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		dequeue(true)
+		return l.releaseFunc(key), nil
+	case <-timeout:
+		dequeue(false)
+		return nil, ErrWaitTimeout
+	case <-ctx.Done():
+		dequeue(false)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *Limiter) releaseFunc(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+			l.mu.Lock()
+			l.decrementUser(key)
+			l.mu.Unlock()
+		})
+	}
+}
+
+// decrementUser must be called with mu held.
+func (l *Limiter) decrementUser(key string) {
+	l.perUser[key]--
+	if l.perUser[key] <= 0 {
+		delete(l.perUser, key)
+	}
+}
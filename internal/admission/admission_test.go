@@ -0,0 +1,128 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLimiter_PerUserLimit(t *testing.T) {
+	limiter := NewLimiter(Config{MaxJobs: 4, MaxJobsPerUser: 1, MaxQueued: 4})
+
+	release, err := limiter.Acquire(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = limiter.Acquire(context.Background(), "alice")
+	if !errors.Is(err, ErrUserLimit) {
+		t.Fatalf("expected ErrUserLimit, got %v", err)
+	}
+
+	otherRelease, err := limiter.Acquire(context.Background(), "bob")
+	if err != nil {
+		t.Fatalf("other users shouldn't be limited: %v", err)
+	}
+	otherRelease()
+
+	release()
+	release()
+	release, err = limiter.Acquire(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("expected a slot after release, got %v", err)
+	}
+	release()
+}
+
+func TestLimiter_QueueFull(t *testing.T) {
+	limiter := NewLimiter(Config{MaxJobs: 1, MaxQueued: 0})
+
+	release, err := limiter.Acquire(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	_, err = limiter.Acquire(context.Background(), "bob")
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestLimiter_QueuedJobGetsFreedSlot(t *testing.T) {
+	limiter := NewLimiter(Config{MaxJobs: 1, MaxQueued: 1, MaxWait: time.Second})
+
+	release, err := limiter.Acquire(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		queuedRelease, err := limiter.Acquire(context.Background(), "bob")
+		if err == nil {
+			queuedRelease()
+		}
+		acquired <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	release()
+
+	if err := <-acquired; err != nil {
+		t.Fatalf("expected the queued job to get the slot, got %v", err)
+	}
+}
+
+func TestLimiter_WaitTimeout(t *testing.T) {
+	limiter := NewLimiter(Config{MaxJobs: 1, MaxJobsPerUser: 1, MaxQueued: 1, MaxWait: 20 * time.Millisecond})
+
+	release, err := limiter.Acquire(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	_, err = limiter.Acquire(context.Background(), "bob")
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Fatalf("expected ErrWaitTimeout, got %v", err)
+	}
+
+	// The timed out job must not keep counting against bob or the queue.
+	_, err = limiter.Acquire(context.Background(), "bob")
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Fatalf("expected ErrWaitTimeout again, got %v", err)
+	}
+}
+
+func TestLimiter_ContextCancelled(t *testing.T) {
+	limiter := NewLimiter(Config{MaxJobs: 1, MaxQueued: 1})
+
+	release, err := limiter.Acquire(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Acquire(ctx, "bob")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestFreeDiskSpace(t *testing.T) {
+	free, err := FreeDiskSpace(os.TempDir())
+	if errors.Is(err, ErrDiskSpaceUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if free == 0 {
+		t.Fatalf("expected some free space in %s", os.TempDir())
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package admission
+
+// FreeDiskSpace isn't implemented on this platform; callers should treat
+// ErrDiskSpaceUnsupported as "unknown" rather than "full".
+func FreeDiskSpace(path string) (uint64, error) {
+	return 0, ErrDiskSpaceUnsupported
+}
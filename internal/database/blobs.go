@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Blob is a bucket object addressed by the SHA-256 of its contents. RefCount
+// counts the video fields pointing at it; the object can go once it hits zero.
+type Blob struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	RefCount  int       `json:"ref_count"`
+	CreateBlobParams
+}
+
+type CreateBlobParams struct {
+	Hash      string `json:"hash"`
+	ObjectKey string `json:"object_key"`
+	Size      int64  `json:"size"`
+}
+
+func (c Client) GetBlob(ctx context.Context, hash string) (Blob, error) {
+	query := `
+	SELECT
+		hash,
+		created_at,
+		updated_at,
+		object_key,
+		size,
+		ref_count
+	FROM blobs
+	WHERE hash = ?
+	`
+
+	var blob Blob
+	err := c.db.QueryRowContext(ctx, query, hash).Scan(
+		&blob.Hash,
+		&blob.CreatedAt,
+		&blob.UpdatedAt,
+		&blob.ObjectKey,
+		&blob.Size,
+		&blob.RefCount,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Blob{}, ErrNotFound
+		}
+		return Blob{}, err
+	}
+
+	return blob, nil
+}
+
+func (c Client) GetBlobs(ctx context.Context) ([]Blob, error) {
+	query := `
+	SELECT
+		hash,
+		created_at,
+		updated_at,
+		object_key,
+		size,
+		ref_count
+	FROM blobs
+	ORDER BY created_at
+	`
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blobs := []Blob{}
+	for rows.Next() {
+		var blob Blob
+		if err := rows.Scan(
+			&blob.Hash,
+			&blob.CreatedAt,
+			&blob.UpdatedAt,
+			&blob.ObjectKey,
+			&blob.Size,
+			&blob.RefCount,
+		); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blobs, nil
+}
+
+// AddBlobReference takes a reference on the blob for params.Hash, recording
+// it with one reference if there is none yet. created reports whether this
+// call made the row, in which case the caller still has to upload the object;
+// otherwise the returned ObjectKey may differ from params.ObjectKey.
+func (c Client) AddBlobReference(ctx context.Context, params CreateBlobParams) (Blob, bool, error) {
+	insert := `
+	INSERT INTO blobs (
+		hash,
+		created_at,
+		updated_at,
+		object_key,
+		size,
+		ref_count
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, 1)
+	ON CONFLICT(hash) DO NOTHING
+	`
+	update := `
+	UPDATE blobs
+	SET ref_count = ref_count + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE hash = ?
+	`
+
+	var blob Blob
+	var created bool
+	err := c.inTx(ctx, func(tx Client) error {
+		// The row can be released between the insert finding it and the
+		// update, so go around again until one of them sticks.
+		for {
+			result, err := tx.db.ExecContext(ctx, insert, params.Hash, params.ObjectKey, params.Size)
+			if err != nil {
+				return err
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rows > 0 {
+				created = true
+				break
+			}
+
+			err = requireRow(tx.db.ExecContext(ctx, update, params.Hash))
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+
+		var err error
+		blob, err = tx.GetBlob(ctx, params.Hash)
+		return err
+	})
+	if err != nil {
+		return Blob{}, false, err
+	}
+	return blob, created, nil
+}
+
+// ReleaseBlob drops one reference to the blob stored under objectKey and
+// returns how many are left. When none are, deleteObject runs while the row is
+// still locked, so a concurrent AddBlobReference waits for the object to go and
+// then records it afresh. The row is removed even if deleteObject fails, and
+// its error is returned. Keys with no blob row (objects stored before
+// deduplication) report zero and are deleted as well.
+func (c Client) ReleaseBlob(ctx context.Context, objectKey string, deleteObject func(ctx context.Context, key string) error) (int, error) {
+	query := `
+	UPDATE blobs
+	SET ref_count = ref_count - 1, updated_at = CURRENT_TIMESTAMP
+	WHERE object_key = ?
+	RETURNING ref_count
+	`
+
+	var refCount int
+	var deleteErr error
+	err := c.inTx(ctx, func(tx Client) error {
+		err := tx.db.QueryRowContext(ctx, query, objectKey).Scan(&refCount)
+		if errors.Is(err, sql.ErrNoRows) {
+			refCount = 0
+			deleteErr = deleteObject(ctx, objectKey)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if refCount > 0 {
+			return nil
+		}
+
+		deleteErr = deleteObject(ctx, objectKey)
+		_, err = tx.db.ExecContext(ctx, "DELETE FROM blobs WHERE object_key = ?", objectKey)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return refCount, deleteErr
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ChapterSourceManual    = "manual"
+	ChapterSourceSuggested = "suggested"
+)
+
+type Chapter struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	CreateChapterParams
+}
+
+type CreateChapterParams struct {
+	Title        string  `json:"title"`
+	StartSeconds float64 `json:"start_seconds"`
+	Source       string  `json:"source"`
+}
+
+func (c Client) GetChapters(ctx context.Context, videoID uuid.UUID) ([]Chapter, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		title,
+		start_seconds,
+		source
+	FROM chapters
+	WHERE video_id = ?
+	ORDER BY start_seconds
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := []Chapter{}
+	for rows.Next() {
+		var chapter Chapter
+		if err := rows.Scan(
+			&chapter.ID,
+			&chapter.CreatedAt,
+			&chapter.UpdatedAt,
+			&chapter.VideoID,
+			&chapter.Title,
+			&chapter.StartSeconds,
+			&chapter.Source,
+		); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	return chapters, rows.Err()
+}
+
+// ReplaceChapters swaps out every chapter on a video in one transaction so
+// readers never see a half-written list.
+func (c Client) ReplaceChapters(ctx context.Context, videoID uuid.UUID, params []CreateChapterParams) ([]Chapter, error) {
+	err := c.inTx(ctx, func(tx Client) error {
+		_, err := tx.db.ExecContext(ctx, "DELETE FROM chapters WHERE video_id = ?", videoID)
+		if err != nil {
+			return err
+		}
+
+		query := `
+		INSERT INTO chapters (
+			id,
+			created_at,
+			updated_at,
+			video_id,
+			title,
+			start_seconds,
+			source
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+		`
+		for _, chapter := range params {
+			_, err = tx.db.ExecContext(ctx, query, uuid.New(), videoID, chapter.Title, chapter.StartSeconds, chapter.Source)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetChapters(ctx, videoID)
+}
+
+func (c Client) DeleteChapter(ctx context.Context, id uuid.UUID) error {
+	query := `
+	DELETE FROM chapters
+	WHERE id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, id)
+	return err
+}
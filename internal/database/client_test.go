@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSQLiteClient opens an empty SQLite database without migrating it.
+func newSQLiteClient(t *testing.T) Client {
+	t.Helper()
+	c, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// newPostgresClient opens an empty schema of its own in the database at
+// TEST_POSTGRES_URL, and skips the test when that isn't set.
+func newPostgresClient(t *testing.T) Client {
+	t.Helper()
+	testURL := os.Getenv("TEST_POSTGRES_URL")
+	if testURL == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", testURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "tubely_test_" + hex.EncodeToString(suffix)
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatalf("unable to create test schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	u, err := url.Parse(testURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	c, err := NewClient(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// forEachBackend runs test against a freshly migrated database on SQLite and,
+// when one is configured, PostgreSQL.
+func forEachBackend(t *testing.T, test func(t *testing.T, c Client)) {
+	backends := map[string]func(t *testing.T) Client{
+		"sqlite":   newSQLiteClient,
+		"postgres": newPostgresClient,
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			c := open(t)
+			_, err := c.Migrate(context.Background())
+			if err != nil {
+				t.Fatalf("unable to migrate: %v", err)
+			}
+			test(t, c)
+		})
+	}
+}
+
+func TestParseDatabaseURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		dialect    dialect
+		dataSource string
+		wantErr    bool
+	}{
+		{url: "./tubely.db", dialect: sqliteDialect, dataSource: "./tubely.db?_txlock=immediate"},
+		{url: "sqlite://./tubely.db", dialect: sqliteDialect, dataSource: "./tubely.db?_txlock=immediate"},
+		{url: "sqlite://./tubely.db?_txlock=exclusive", dialect: sqliteDialect, dataSource: "./tubely.db?_txlock=exclusive"},
+		{url: "postgres://u:p@localhost/tubely", dialect: postgresDialect, dataSource: "postgres://u:p@localhost/tubely?timezone=UTC"},
+		{url: "postgresql://localhost/tubely?timezone=Europe%2FParis", dialect: postgresDialect, dataSource: "postgresql://localhost/tubely?timezone=Europe%2FParis"},
+		{url: "mysql://localhost/tubely", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		d, dataSource, err := parseDatabaseURL(tc.url)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.url)
+			}
+			continue
+		}
+		if err != nil || d != tc.dialect || dataSource != tc.dataSource {
+			t.Errorf("%s: got %s %q %v", tc.url, d.name, dataSource, err)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT '?' FROM videos WHERE id = ? AND user_id = ?"
+	if got := sqliteDialect.rebind(query); got != query {
+		t.Errorf("sqlite rebind changed the query: %s", got)
+	}
+	want := "SELECT '?' FROM videos WHERE id = $1 AND user_id = $2"
+	if got := postgresDialect.rebind(query); got != want {
+		t.Errorf("postgres rebind = %s", got)
+	}
+}
@@ -1,89 +1,188 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
-	db *sql.DB
+	db           conn
+	defaultQuota Quota
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+var (
+	// ErrNotFound is returned when the row asked for doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrModified is returned by conditional updates when the row has changed
+	// since the caller read it.
+	ErrModified = errors.New("modified since read")
+)
+
+// sqliteTimestampFormat matches what CURRENT_TIMESTAMP stores, so timestamps
+// passed as parameters compare correctly against it.
+const sqliteTimestampFormat = "2006-01-02 15:04:05"
+
+// NewClient opens the database named by dbURL. postgres:// and postgresql://
+// URLs open PostgreSQL; anything else is a SQLite path, optionally prefixed
+// with sqlite://. Call Migrate before using it so the schema is current.
+func NewClient(dbURL string) (Client, error) {
+	d, dataSource, err := parseDatabaseURL(dbURL)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	db, err := sql.Open(d.driver, dataSource)
 	if err != nil {
 		return Client{}, err
 	}
-	return c, nil
+	return Client{db: conn{db: db, dialect: d}}, nil
+}
+
+func parseDatabaseURL(dbURL string) (dialect, string, error) {
+	scheme, rest, ok := strings.Cut(dbURL, "://")
+	if !ok {
+		return sqliteDataSource(dbURL)
+	}
 
+	switch scheme {
+	case "sqlite", "sqlite3":
+		return sqliteDataSource(rest)
+	case "postgres", "postgresql":
+		u, err := url.Parse(dbURL)
+		if err != nil {
+			return dialect{}, "", fmt.Errorf("invalid database URL: %w", err)
+		}
+		// Sessions run in UTC so timestamps read back match SQLite's.
+		query := u.Query()
+		if query.Get("timezone") == "" {
+			query.Set("timezone", "UTC")
+		}
+		u.RawQuery = query.Encode()
+		return postgresDialect, u.String(), nil
+	default:
+		return dialect{}, "", fmt.Errorf("unsupported database scheme %q", scheme)
+	}
+}
+
+// sqliteDataSource has transactions take SQLite's write lock when they begin.
+// Deferred transactions that read and then write fail with "database is
+// locked" when two run at once, rather than waiting on the busy timeout.
+func sqliteDataSource(path string) (dialect, string, error) {
+	file, rawQuery, _ := strings.Cut(path, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return dialect{}, "", fmt.Errorf("invalid database URL: %w", err)
+	}
+	if query.Get("_txlock") == "" {
+		query.Set("_txlock", "immediate")
+	}
+	return sqliteDialect, file + "?" + query.Encode(), nil
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
+// requireRow turns a write that matched no rows into ErrNotFound.
+func requireRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close releases the connection pool.
+func (c Client) Close() error {
+	return c.db.db.Close()
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise. Everything done through the Store passed to fn is part of
+// the transaction, including nested WithTx calls.
+func (c Client) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return c.inTx(ctx, func(tx Client) error {
+		return fn(tx)
+	})
+}
+
+// inTx runs fn on a Client bound to a transaction, joining the current one if
+// c is already in a transaction.
+func (c Client) inTx(ctx context.Context, fn func(tx Client) error) error {
+	if c.db.tx != nil {
+		return fn(c)
+	}
+
+	sqlTx, err := c.db.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer sqlTx.Rollback()
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
+	tx := c
+	tx.db.tx = sqlTx
+	err = fn(tx)
 	if err != nil {
 		return err
 	}
-	return nil
+	return sqlTx.Commit()
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
+func (c Client) Reset(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM user_usage"); err != nil {
+		return fmt.Errorf("failed to reset table user_usage: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM user_quotas"); err != nil {
+		return fmt.Errorf("failed to reset table user_quotas: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM watermarks"); err != nil {
+		return fmt.Errorf("failed to reset table watermarks: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM chapters"); err != nil {
+		return fmt.Errorf("failed to reset table chapters: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM subtitle_tracks"); err != nil {
+		return fmt.Errorf("failed to reset table subtitle_tracks: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM playlist_entries"); err != nil {
+		return fmt.Errorf("failed to reset table playlist_entries: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM playlists"); err != nil {
+		return fmt.Errorf("failed to reset table playlists: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_tags"); err != nil {
+		return fmt.Errorf("failed to reset table video_tags: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM tags"); err != nil {
+		return fmt.Errorf("failed to reset table tags: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_versions"); err != nil {
+		return fmt.Errorf("failed to reset table video_versions: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
+	if c.usesFTS5() {
+		if _, err := c.db.ExecContext(ctx, "DELETE FROM videos_fts"); err != nil {
+			return fmt.Errorf("failed to reset table videos_fts: %w", err)
+		}
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM blobs"); err != nil {
+		return fmt.Errorf("failed to reset table blobs: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM users"); err != nil {
+		return fmt.Errorf("failed to reset table users: %w", err)
+	}
 	return nil
 }
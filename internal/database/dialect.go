@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect covers the differences between the databases Client runs on.
+// Queries are written for SQLite, with ? placeholders, and rebound for the
+// others.
+type dialect struct {
+	// name selects dialect-specific migrations, e.g. 0001_baseline.up.postgres.sql.
+	name   string
+	driver string
+	// numberedPlaceholders means the driver wants $1, $2, ... instead of ?.
+	numberedPlaceholders bool
+	// greatest is the scalar function returning the larger of its arguments.
+	greatest string
+}
+
+var (
+	sqliteDialect = dialect{
+		name:     "sqlite",
+		driver:   "sqlite3",
+		greatest: "MAX",
+	}
+	postgresDialect = dialect{
+		name:                 "postgres",
+		driver:               "postgres",
+		numberedPlaceholders: true,
+		greatest:             "GREATEST",
+	}
+)
+
+// rebind rewrites ? placeholders for the dialect. Question marks inside
+// quoted strings are left alone.
+func (d dialect) rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// timestamp converts t into a parameter that compares correctly against
+// columns filled with CURRENT_TIMESTAMP. SQLite stores those as UTC text.
+func (d dialect) timestamp(t time.Time) any {
+	if d == sqliteDialect {
+		return t.UTC().Format(sqliteTimestampFormat)
+	}
+	return t.UTC()
+}
+
+// parseTimestamp reads a timestamp an aggregate like MIN returned. SQLite
+// can't tell the driver the type of an aggregate, so there it arrives as the
+// UTC text CURRENT_TIMESTAMP stored.
+func parseTimestamp(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return time.Parse(sqliteTimestampFormat, v)
+	case []byte:
+		return time.Parse(sqliteTimestampFormat, string(v))
+	}
+	return time.Time{}, fmt.Errorf("unexpected timestamp %T", value)
+}
+
+// conn runs queries written with ? placeholders against any dialect, on the
+// connection pool or, inside WithTx, on a transaction.
+type conn struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if c.tx != nil {
+		return c.tx.ExecContext(ctx, c.dialect.rebind(query), args...)
+	}
+	return c.db.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if c.tx != nil {
+		return c.tx.QueryContext(ctx, c.dialect.rebind(query), args...)
+	}
+	return c.db.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if c.tx != nil {
+		return c.tx.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+	}
+	return c.db.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
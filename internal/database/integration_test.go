@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// The conformance tests in store_test.go cover each operation on SQLite and
+// PostgreSQL as well as the memory store. The cases here only mean something
+// against a real database: concurrent writers racing on the same rows.
+
+func TestConcurrentUsageStaysWithinQuota(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		c = c.WithDefaultQuota(Quota{MaxBytes: 100})
+		user := createTestUser(t, c, "a@example.com")
+
+		videos := []Video{}
+		for i := range 10 {
+			video, err := c.CreateVideo(ctx, CreateVideoParams{Title: fmt.Sprintf("Video %d", i), UserID: user.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			videos = append(videos, video)
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(videos))
+		for i, video := range videos {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				video.VideoBytes = 20
+				errs[i] = c.UpdateVideo(ctx, video)
+			}()
+		}
+		wg.Wait()
+
+		stored := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				stored++
+			case !errors.Is(err, ErrStorageQuotaExceeded):
+				t.Fatalf("UpdateVideo: %v", err)
+			}
+		}
+		usage, err := c.GetUserUsage(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != 5 || usage.BytesUsed != 100 {
+			t.Errorf("%d updates went through for %d bytes used, expected 5 for 100", stored, usage.BytesUsed)
+		}
+	})
+}
+
+func TestConcurrentBlobReferences(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		params := CreateBlobParams{Hash: "abc", ObjectKey: "landscape/abc.mp4", Size: 1}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		created := 0
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, ok, err := c.AddBlobReference(ctx, params)
+				if err != nil {
+					t.Errorf("AddBlobReference: %v", err)
+					return
+				}
+				if ok {
+					mu.Lock()
+					created++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		blob, err := c.GetBlob(ctx, "abc")
+		if err != nil || blob.RefCount != 10 || created != 1 {
+			t.Fatalf("blob = %+v, %v after %d creations", blob, err, created)
+		}
+
+		deletes := 0
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.ReleaseBlob(ctx, params.ObjectKey, func(ctx context.Context, key string) error {
+					mu.Lock()
+					deletes++
+					mu.Unlock()
+					return nil
+				})
+				if err != nil {
+					t.Errorf("ReleaseBlob: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if _, err := c.GetBlob(ctx, "abc"); !errors.Is(err, ErrNotFound) || deletes != 1 {
+			t.Errorf("after releasing every reference: %v, %d deletes", err, deletes)
+		}
+	})
+}
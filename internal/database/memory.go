@@ -0,0 +1,1704 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps everything in maps, for tests that don't need a real
+// database. It behaves like Client, and the conformance tests hold the two to
+// that. Transactions hold the store's lock throughout, so they are isolated
+// from everything else, and roll back by restoring a snapshot.
+type MemoryStore struct {
+	mu *sync.Mutex
+	// inTx is set on the Store handed to a WithTx callback, which already
+	// holds mu.
+	inTx bool
+	// defaultQuota is enforced for users without an override.
+	defaultQuota Quota
+	*memoryData
+}
+
+type memoryData struct {
+	users         map[uuid.UUID]User
+	refreshTokens map[string]RefreshToken
+	videos        map[uuid.UUID]Video
+	versions      map[uuid.UUID]VideoVersion
+	subtitles     map[uuid.UUID]SubtitleTrack
+	chapters      map[uuid.UUID]Chapter
+	watermarks    map[uuid.UUID]Watermark
+	usage         map[uuid.UUID]UserUsage
+	quotas        map[uuid.UUID]UserQuota
+	blobs         map[string]Blob
+	tags          map[uuid.UUID]memoryTag
+	videoTags     map[videoTag]bool
+	playlists     map[uuid.UUID]Playlist
+	entries       map[uuid.UUID]PlaylistEntry
+}
+
+type memoryTag struct {
+	UserID uuid.UUID
+	Name   string
+}
+
+type videoTag struct {
+	VideoID uuid.UUID
+	TagID   uuid.UUID
+}
+
+func newMemoryData() memoryData {
+	return memoryData{
+		users:         map[uuid.UUID]User{},
+		refreshTokens: map[string]RefreshToken{},
+		videos:        map[uuid.UUID]Video{},
+		versions:      map[uuid.UUID]VideoVersion{},
+		subtitles:     map[uuid.UUID]SubtitleTrack{},
+		chapters:      map[uuid.UUID]Chapter{},
+		watermarks:    map[uuid.UUID]Watermark{},
+		usage:         map[uuid.UUID]UserUsage{},
+		quotas:        map[uuid.UUID]UserQuota{},
+		blobs:         map[string]Blob{},
+		tags:          map[uuid.UUID]memoryTag{},
+		videoTags:     map[videoTag]bool{},
+		playlists:     map[uuid.UUID]Playlist{},
+		entries:       map[uuid.UUID]PlaylistEntry{},
+	}
+}
+
+func (d memoryData) clone() memoryData {
+	return memoryData{
+		users:         maps.Clone(d.users),
+		refreshTokens: maps.Clone(d.refreshTokens),
+		videos:        maps.Clone(d.videos),
+		versions:      maps.Clone(d.versions),
+		subtitles:     maps.Clone(d.subtitles),
+		chapters:      maps.Clone(d.chapters),
+		watermarks:    maps.Clone(d.watermarks),
+		usage:         maps.Clone(d.usage),
+		quotas:        maps.Clone(d.quotas),
+		blobs:         maps.Clone(d.blobs),
+		tags:          maps.Clone(d.tags),
+		videoTags:     maps.Clone(d.videoTags),
+		playlists:     maps.Clone(d.playlists),
+		entries:       maps.Clone(d.entries),
+	}
+}
+
+func NewMemoryStore() *MemoryStore {
+	data := newMemoryData()
+	return &MemoryStore{mu: &sync.Mutex{}, memoryData: &data}
+}
+
+// WithDefaultQuota returns a view of the store that enforces quota for users
+// without an override.
+func (s *MemoryStore) WithDefaultQuota(quota Quota) *MemoryStore {
+	store := *s
+	store.defaultQuota = quota
+	return &store
+}
+
+// lock takes the store's lock unless the caller is inside WithTx, and fails
+// like a database call would once ctx is done.
+func (s *MemoryStore) lock(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.inTx {
+		return func() {}, nil
+	}
+	s.mu.Lock()
+	return s.mu.Unlock, nil
+}
+
+func (s *MemoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.memoryData.clone()
+	err := fn(&MemoryStore{mu: s.mu, inTx: true, defaultQuota: s.defaultQuota, memoryData: s.memoryData})
+	if err != nil {
+		*s.memoryData = snapshot
+	}
+	return err
+}
+
+func (s *MemoryStore) Reset(ctx context.Context) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	*s.memoryData = newMemoryData()
+	return nil
+}
+
+func memoryNow() time.Time {
+	return time.Now().UTC().Round(0)
+}
+
+// Users
+
+func (s *MemoryStore) GetUsers(ctx context.Context) ([]User, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Like Client, only the ID and email are filled in.
+	users := []User{}
+	for _, user := range s.users {
+		users = append(users, User{ID: user.ID, CreateUserParams: CreateUserParams{Email: user.Email}})
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	defer unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s *MemoryStore) GetUserByRefreshToken(ctx context.Context, token string) (*User, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rt, ok := s.refreshTokens[token]
+	if !ok || rt.RevokedAt != nil || !rt.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	user, ok := s.users[rt.UserID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	for _, user := range s.users {
+		if user.Email == params.Email {
+			return nil, fmt.Errorf("email %s is already in use", params.Email)
+		}
+	}
+
+	now := memoryNow()
+	user := User{
+		ID:               uuid.New(),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		CreateUserParams: params,
+	}
+	s.users[user.ID] = user
+	return &user, nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(s.users, id)
+	return nil
+}
+
+// Usage and quotas
+
+func (s *MemoryStore) GetUserUsage(ctx context.Context, userID uuid.UUID) (UserUsage, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return UserUsage{}, err
+	}
+	defer unlock()
+
+	usage, ok := s.usage[userID]
+	if !ok {
+		return UserUsage{UserID: userID}, nil
+	}
+	return usage, nil
+}
+
+func (s *MemoryStore) GetEffectiveQuota(ctx context.Context, userID uuid.UUID) (Quota, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Quota{}, err
+	}
+	defer unlock()
+
+	return s.effectiveQuota(userID), nil
+}
+
+func (s *MemoryStore) GetRemainingBytes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	quota := s.effectiveQuota(userID)
+	if quota.MaxBytes == 0 {
+		return -1, nil
+	}
+	return max(0, quota.MaxBytes-s.usage[userID].BytesUsed), nil
+}
+
+func (s *MemoryStore) effectiveQuota(userID uuid.UUID) Quota {
+	quota := s.defaultQuota
+	if override, ok := s.quotas[userID]; ok {
+		if override.MaxBytes != nil {
+			quota.MaxBytes = *override.MaxBytes
+		}
+		if override.MaxVideos != nil {
+			quota.MaxVideos = *override.MaxVideos
+		}
+	}
+	return quota
+}
+
+// adjustUsage mirrors the SQL version: counters never drop below zero, and
+// increases past the user's quota fail without changing anything.
+func (s *MemoryStore) adjustUsage(userID uuid.UUID, bytesDelta int64, videoDelta int) error {
+	if bytesDelta == 0 && videoDelta == 0 {
+		return nil
+	}
+
+	quota := s.effectiveQuota(userID)
+	usage := s.usage[userID]
+	if videoDelta > 0 && quota.MaxVideos > 0 && usage.VideoCount+videoDelta > quota.MaxVideos {
+		return ErrVideoQuotaExceeded
+	}
+	if bytesDelta > 0 && quota.MaxBytes > 0 && usage.BytesUsed+bytesDelta > quota.MaxBytes {
+		return ErrStorageQuotaExceeded
+	}
+
+	usage.UserID = userID
+	usage.UpdatedAt = memoryNow()
+	usage.BytesUsed = max(0, usage.BytesUsed+bytesDelta)
+	usage.VideoCount = max(0, usage.VideoCount+videoDelta)
+	s.usage[userID] = usage
+	return nil
+}
+
+func (s *MemoryStore) GetUserQuota(ctx context.Context, userID uuid.UUID) (UserQuota, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return UserQuota{}, err
+	}
+	defer unlock()
+
+	quota, ok := s.quotas[userID]
+	if !ok {
+		return UserQuota{}, ErrNotFound
+	}
+	return quota, nil
+}
+
+func (s *MemoryStore) SetUserQuota(ctx context.Context, params SetUserQuotaParams) (UserQuota, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return UserQuota{}, err
+	}
+	defer unlock()
+
+	now := memoryNow()
+	quota, ok := s.quotas[params.UserID]
+	if !ok {
+		quota.CreatedAt = now
+	}
+	quota.UpdatedAt = now
+	quota.SetUserQuotaParams = params
+	s.quotas[params.UserID] = quota
+	return quota, nil
+}
+
+// Watermarks
+
+func (s *MemoryStore) UpsertWatermark(ctx context.Context, params UpsertWatermarkParams) (Watermark, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Watermark{}, err
+	}
+	defer unlock()
+
+	now := memoryNow()
+	watermark, ok := s.watermarks[params.UserID]
+	if !ok {
+		watermark.CreatedAt = now
+	}
+	watermark.UpdatedAt = now
+	watermark.UpsertWatermarkParams = params
+	s.watermarks[params.UserID] = watermark
+	return watermark, nil
+}
+
+func (s *MemoryStore) GetWatermark(ctx context.Context, userID uuid.UUID) (Watermark, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Watermark{}, err
+	}
+	defer unlock()
+
+	watermark, ok := s.watermarks[userID]
+	if !ok {
+		return Watermark{}, ErrNotFound
+	}
+	return watermark, nil
+}
+
+func (s *MemoryStore) DeleteWatermark(ctx context.Context, userID uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(s.watermarks, userID)
+	return nil
+}
+
+// Refresh tokens
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer unlock()
+
+	if _, ok := s.refreshTokens[params.Token]; ok {
+		return RefreshToken{}, fmt.Errorf("refresh token already exists")
+	}
+
+	now := memoryNow()
+	params.ExpiresAt = params.ExpiresAt.UTC()
+	if params.FamilyID == uuid.Nil {
+		params.FamilyID = uuid.New()
+	}
+	rt := RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+		LastUsedAt:               now,
+	}
+	s.refreshTokens[params.Token] = rt
+	return rt, nil
+}
+
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, token string) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	rt, ok := s.refreshTokens[token]
+	if !ok {
+		return ErrNotFound
+	}
+	now := memoryNow()
+	rt.RevokedAt = &now
+	s.refreshTokens[token] = rt
+	return nil
+}
+
+func (s *MemoryStore) RotateRefreshToken(ctx context.Context, token string, params CreateRefreshTokenParams) (RefreshToken, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer unlock()
+
+	current, ok := s.refreshTokens[token]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	now := memoryNow()
+	if current.RevokedAt != nil {
+		s.revokeRefreshTokens(func(rt RefreshToken) bool { return rt.FamilyID == current.FamilyID })
+		return RefreshToken{}, ErrRefreshTokenReused
+	}
+	if !current.ExpiresAt.After(time.Now()) {
+		return RefreshToken{}, ErrRefreshTokenExpired
+	}
+	if _, ok := s.refreshTokens[params.Token]; ok {
+		return RefreshToken{}, fmt.Errorf("refresh token already exists")
+	}
+
+	current.RevokedAt = &now
+	current.UpdatedAt = now
+	current.LastUsedAt = now
+	s.refreshTokens[token] = current
+
+	params.UserID = current.UserID
+	params.FamilyID = current.FamilyID
+	params.ExpiresAt = params.ExpiresAt.UTC()
+	rt := RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+		LastUsedAt:               now,
+	}
+	s.refreshTokens[params.Token] = rt
+	return rt, nil
+}
+
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer unlock()
+
+	rt, ok := s.refreshTokens[token]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	return rt, nil
+}
+
+func (s *MemoryStore) DeleteRefreshToken(ctx context.Context, token string) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(s.refreshTokens, token)
+	return nil
+}
+
+func (s *MemoryStore) GetSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	started := map[uuid.UUID]time.Time{}
+	for _, rt := range s.refreshTokens {
+		if first, ok := started[rt.FamilyID]; !ok || rt.CreatedAt.Before(first) {
+			started[rt.FamilyID] = rt.CreatedAt
+		}
+	}
+
+	sessions := []Session{}
+	now := time.Now()
+	for _, rt := range s.refreshTokens {
+		if rt.UserID != userID || rt.RevokedAt != nil || !rt.ExpiresAt.After(now) {
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:         rt.FamilyID,
+			CreatedAt:  started[rt.FamilyID],
+			LastUsedAt: rt.LastUsedAt,
+			ExpiresAt:  rt.ExpiresAt,
+			UserAgent:  rt.UserAgent,
+			IPAddress:  rt.IPAddress,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return sessions[i].ID.String() < sessions[j].ID.String()
+	})
+	return sessions, nil
+}
+
+func (s *MemoryStore) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if s.revokeRefreshTokens(func(rt RefreshToken) bool { return rt.UserID == userID && rt.FamilyID == sessionID }) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return s.revokeRefreshTokens(func(rt RefreshToken) bool { return rt.UserID == userID }), nil
+}
+
+// revokeRefreshTokens revokes the live tokens matching keep and returns how
+// many there were.
+func (s *MemoryStore) revokeRefreshTokens(keep func(RefreshToken) bool) int {
+	now := memoryNow()
+	revoked := 0
+	for key, rt := range s.refreshTokens {
+		if rt.RevokedAt == nil && keep(rt) {
+			rt.RevokedAt = &now
+			rt.UpdatedAt = now
+			s.refreshTokens[key] = rt
+			revoked++
+		}
+	}
+	return revoked
+}
+
+// Videos
+
+// withDetails returns a copy of video with its subtitle tracks and tags
+// attached, as Client does for every video it reads.
+func (s *MemoryStore) withDetails(video Video) Video {
+	video.Subtitles = s.subtitleTracks(video.ID)
+	video.Tags = s.videoTagNames(video.ID)
+	return video
+}
+
+func (s *MemoryStore) filterVideos(keep func(Video) bool, less func(a, b Video) bool) []Video {
+	videos := []Video{}
+	for _, video := range s.videos {
+		if keep(video) {
+			videos = append(videos, s.withDetails(video))
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return less(videos[i], videos[j])
+	})
+	return videos
+}
+
+func (s *MemoryStore) GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.filterVideos(
+		func(v Video) bool { return v.UserID == userID && v.DeletedAt == nil },
+		func(a, b Video) bool { return a.CreatedAt.After(b.CreatedAt) },
+	), nil
+}
+
+func (s *MemoryStore) GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.filterVideos(
+		func(v Video) bool { return v.UserID == userID && v.DeletedAt != nil },
+		func(a, b Video) bool { return a.DeletedAt.After(*b.DeletedAt) },
+	), nil
+}
+
+func (s *MemoryStore) ListVideos(ctx context.Context, params ListVideosParams) (VideoPage, error) {
+	err := validateListVideosParams(params)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	var after *Video
+	if params.After != nil {
+		probe, err := videoAtCursor(*params.After)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		after = &probe
+	}
+
+	tags, err := normalizeTags(params.Tags)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	tags = slices.Compact(slices.Sorted(slices.Values(tags)))
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer unlock()
+
+	compare := func(a, b Video) int {
+		order := compareVideos(params.Sort, a, b)
+		if params.Descending {
+			return -order
+		}
+		return order
+	}
+	videos := s.filterVideos(
+		func(v Video) bool {
+			if v.UserID != params.UserID || v.DeletedAt != nil {
+				return false
+			}
+			if params.AspectRatio != "" {
+				if v.CurrentVersionID == nil || s.versions[*v.CurrentVersionID].AspectRatio != params.AspectRatio {
+					return false
+				}
+			}
+			if (params.Status == VideoStatusDraft && v.VideoURL != nil) || (params.Status == VideoStatusReady && v.VideoURL == nil) {
+				return false
+			}
+			if params.CreatedAfter != nil && v.CreatedAt.Before(*params.CreatedAfter) {
+				return false
+			}
+			if params.CreatedBefore != nil && !v.CreatedAt.Before(*params.CreatedBefore) {
+				return false
+			}
+			if len(tags) > 0 {
+				matched := 0
+				for _, name := range s.videoTagNames(v.ID) {
+					if slices.Contains(tags, name) {
+						matched++
+					}
+				}
+				if matched == 0 || (params.MatchAllTags && matched < len(tags)) {
+					return false
+				}
+			}
+			return after == nil || compare(v, *after) > 0
+		},
+		func(a, b Video) bool { return compare(a, b) < 0 },
+	)
+	if len(videos) > params.Limit+1 {
+		videos = videos[:params.Limit+1]
+	}
+	return newVideoPage(videos, params), nil
+}
+
+// SearchVideos matches and ranks like Client's LIKE fallback.
+func (s *MemoryStore) SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	terms := searchTerms(params.Query)
+	results := []VideoSearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+	for _, video := range s.videos {
+		if video.DeletedAt != nil {
+			continue
+		}
+		if video.UserID != params.UserID && (params.OwnOnly || video.Visibility != VideoVisibilityPublic) {
+			continue
+		}
+		rank, ok := searchRank(video, terms)
+		if !ok {
+			continue
+		}
+		results = append(results, VideoSearchResult{
+			Video:   s.withDetails(video),
+			Rank:    rank,
+			Snippet: highlightSnippet(video, terms),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	if len(results) > params.Limit {
+		results = results[:max(0, params.Limit)]
+	}
+	return results, nil
+}
+
+// compareVideos orders videos the way ListVideos does in SQL.
+func compareVideos(sort string, a, b Video) int {
+	order := 0
+	switch sort {
+	case VideoSortCreatedAt:
+		order = a.CreatedAt.Compare(b.CreatedAt)
+	case VideoSortUpdatedAt:
+		order = a.UpdatedAt.Compare(b.UpdatedAt)
+	case VideoSortTitle:
+		order = strings.Compare(a.Title, b.Title)
+	case VideoSortDuration:
+		order = cmp.Compare(durationOrZero(a), durationOrZero(b))
+	}
+	if order != 0 {
+		return order
+	}
+	return strings.Compare(a.ID.String(), b.ID.String())
+}
+
+func durationOrZero(video Video) float64 {
+	if video.Duration == nil {
+		return 0
+	}
+	return *video.Duration
+}
+
+// videoAtCursor builds a video that sorts exactly where the cursor points.
+func videoAtCursor(cursor VideoCursor) (Video, error) {
+	video := Video{ID: cursor.ID}
+	switch cursor.Sort {
+	case VideoSortCreatedAt, VideoSortUpdatedAt:
+		t, err := time.Parse(time.RFC3339Nano, cursor.Key)
+		if err != nil {
+			return Video{}, fmt.Errorf("invalid cursor: %w", err)
+		}
+		video.CreatedAt, video.UpdatedAt = t, t
+	case VideoSortTitle:
+		video.Title = cursor.Key
+	case VideoSortDuration:
+		duration, err := strconv.ParseFloat(cursor.Key, 64)
+		if err != nil {
+			return Video{}, fmt.Errorf("invalid cursor: %w", err)
+		}
+		video.Duration = &duration
+	}
+	return video, nil
+}
+
+func (s *MemoryStore) GetVideosTrashedBefore(ctx context.Context, cutoff time.Time) ([]Video, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.filterVideos(
+		func(v Video) bool { return v.DeletedAt != nil && !v.DeletedAt.After(cutoff) },
+		func(a, b Video) bool { return a.DeletedAt.Before(*b.DeletedAt) },
+	), nil
+}
+
+func (s *MemoryStore) TrashVideo(ctx context.Context, id uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	video, ok := s.videos[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := memoryNow()
+	video.DeletedAt = &now
+	s.videos[id] = video
+	return nil
+}
+
+func (s *MemoryStore) RestoreVideo(ctx context.Context, id uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	video, ok := s.videos[id]
+	if !ok {
+		return ErrNotFound
+	}
+	video.DeletedAt = nil
+	s.videos[id] = video
+	return nil
+}
+
+func (s *MemoryStore) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Video{}, err
+	}
+	defer unlock()
+
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPrivate
+	}
+	now := memoryNow()
+	video := Video{
+		ID:                uuid.New(),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+		CreateVideoParams: params,
+	}
+	err = s.adjustUsage(params.UserID, 0, 1)
+	if err != nil {
+		return Video{}, err
+	}
+	s.videos[video.ID] = video
+	return s.withDetails(video), nil
+}
+
+func (s *MemoryStore) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Video{}, err
+	}
+	defer unlock()
+
+	video, ok := s.videos[id]
+	if !ok {
+		return Video{}, ErrNotFound
+	}
+	return s.withDetails(video), nil
+}
+
+func (s *MemoryStore) UpdateVideo(ctx context.Context, video Video) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	previous, ok := s.videos[video.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	// The new owner's usage goes first: it's the adjustment that can fail.
+	previousBytes := previous.VideoBytes + previous.ThumbnailBytes
+	bytes := video.VideoBytes + video.ThumbnailBytes
+	if previous.UserID == video.UserID {
+		err = s.adjustUsage(video.UserID, bytes-previousBytes, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = s.adjustUsage(video.UserID, bytes, 1)
+		if err != nil {
+			return err
+		}
+		s.adjustUsage(previous.UserID, -previousBytes, -1)
+	}
+
+	// Like the UPDATE in Client, creation time and trash state aren't touched.
+	updated := video
+	updated.CreatedAt = previous.CreatedAt
+	updated.UpdatedAt = memoryNow()
+	updated.DeletedAt = previous.DeletedAt
+	updated.Subtitles = nil
+	updated.Tags = nil
+	s.videos[video.ID] = updated
+	return nil
+}
+
+func (s *MemoryStore) UpdateVideoMetadata(ctx context.Context, params UpdateVideoMetadataParams) (Video, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Video{}, err
+	}
+	defer unlock()
+
+	video, ok := s.videos[params.ID]
+	if !ok {
+		return Video{}, ErrNotFound
+	}
+	if expected := params.IfMatch; expected != nil {
+		if !video.UpdatedAt.Equal(expected.UpdatedAt) || video.Title != expected.Title || video.Description != expected.Description || video.Visibility != expected.Visibility {
+			return Video{}, ErrModified
+		}
+	}
+	video.UpdatedAt = memoryNow()
+	video.Title = params.Title
+	video.Description = params.Description
+	video.Visibility = params.Visibility
+	s.videos[params.ID] = video
+	return s.withDetails(video), nil
+}
+
+func (s *MemoryStore) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok := s.videos[id]; !ok {
+		return nil
+	}
+	return s.deleteVideo(id)
+}
+
+func (s *MemoryStore) PurgeTrashedVideo(ctx context.Context, id uuid.UUID, cutoff time.Time) (Video, []VideoVersion, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Video{}, nil, err
+	}
+	defer unlock()
+
+	video, ok := s.videos[id]
+	if !ok || video.DeletedAt == nil || video.DeletedAt.After(cutoff) {
+		return Video{}, nil, ErrNotFound
+	}
+	video = s.withDetails(video)
+	versions := s.videoVersions(id)
+	if err := s.deleteVideo(id); err != nil {
+		return Video{}, nil, err
+	}
+	return video, versions, nil
+}
+
+func (s *MemoryStore) deleteVideo(id uuid.UUID) error {
+	video := s.videos[id]
+	for trackID, track := range s.subtitles {
+		if track.VideoID == id {
+			delete(s.subtitles, trackID)
+		}
+	}
+	for chapterID, chapter := range s.chapters {
+		if chapter.VideoID == id {
+			delete(s.chapters, chapterID)
+		}
+	}
+	for versionID, version := range s.versions {
+		if version.VideoID == id {
+			delete(s.versions, versionID)
+		}
+	}
+	for key := range s.videoTags {
+		if key.VideoID == id {
+			delete(s.videoTags, key)
+		}
+	}
+	for entryID, entry := range s.entries {
+		if entry.VideoID == id {
+			s.removeEntry(entry.PlaylistID, entryID)
+		}
+	}
+	delete(s.videos, id)
+	return s.adjustUsage(video.UserID, -(video.VideoBytes + video.ThumbnailBytes), -1)
+}
+
+// Tags
+
+func (s *MemoryStore) videoTagNames(videoID uuid.UUID) []string {
+	names := []string{}
+	for key := range s.videoTags {
+		if key.VideoID == videoID {
+			names = append(names, s.tags[key.TagID].Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *MemoryStore) GetVideoTags(ctx context.Context, videoID uuid.UUID) ([]string, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.videoTagNames(videoID), nil
+}
+
+func (s *MemoryStore) AddVideoTags(ctx context.Context, videoID uuid.UUID, names []string) ([]string, error) {
+	names, err := normalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	video, ok := s.videos[videoID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for _, name := range names {
+		tag := memoryTag{UserID: video.UserID, Name: name}
+		tagID := uuid.Nil
+		for id, existing := range s.tags {
+			if existing == tag {
+				tagID = id
+				break
+			}
+		}
+		if tagID == uuid.Nil {
+			tagID = uuid.New()
+			s.tags[tagID] = tag
+		}
+		s.videoTags[videoTag{VideoID: videoID, TagID: tagID}] = true
+	}
+	return s.videoTagNames(videoID), nil
+}
+
+func (s *MemoryStore) RemoveVideoTag(ctx context.Context, videoID uuid.UUID, name string) error {
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for key := range s.videoTags {
+		if key.VideoID == videoID && s.tags[key.TagID].Name == name {
+			delete(s.videoTags, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetUserTags(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]TagCount, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	prefix = strings.ToLower(strings.TrimLeft(prefix, " "))
+	counts := map[string]int{}
+	for key := range s.videoTags {
+		tag := s.tags[key.TagID]
+		video := s.videos[key.VideoID]
+		if tag.UserID == userID && strings.HasPrefix(tag.Name, prefix) && video.DeletedAt == nil {
+			counts[tag.Name]++
+		}
+	}
+
+	tags := []TagCount{}
+	for name, count := range counts {
+		tags = append(tags, TagCount{Name: name, VideoCount: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].VideoCount != tags[j].VideoCount {
+			return tags[i].VideoCount > tags[j].VideoCount
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	if len(tags) > limit {
+		tags = tags[:max(0, limit)]
+	}
+	return tags, nil
+}
+
+// Playlists
+
+func (s *MemoryStore) CreatePlaylist(ctx context.Context, params CreatePlaylistParams) (Playlist, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Playlist{}, err
+	}
+	defer unlock()
+
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPrivate
+	}
+	now := memoryNow()
+	playlist := Playlist{
+		ID:                   uuid.New(),
+		CreatedAt:            now,
+		UpdatedAt:            now,
+		CreatePlaylistParams: params,
+	}
+	s.playlists[playlist.ID] = playlist
+	return playlist, nil
+}
+
+func (s *MemoryStore) GetPlaylist(ctx context.Context, id uuid.UUID) (Playlist, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Playlist{}, err
+	}
+	defer unlock()
+
+	playlist, ok := s.playlists[id]
+	if !ok {
+		return Playlist{}, ErrNotFound
+	}
+	return playlist, nil
+}
+
+func (s *MemoryStore) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	playlists := []Playlist{}
+	for _, playlist := range s.playlists {
+		if playlist.UserID == userID {
+			playlists = append(playlists, playlist)
+		}
+	}
+	sort.Slice(playlists, func(i, j int) bool {
+		if !playlists[i].CreatedAt.Equal(playlists[j].CreatedAt) {
+			return playlists[i].CreatedAt.Before(playlists[j].CreatedAt)
+		}
+		return playlists[i].ID.String() < playlists[j].ID.String()
+	})
+	return playlists, nil
+}
+
+func (s *MemoryStore) UpdatePlaylist(ctx context.Context, playlist Playlist) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	updated, ok := s.playlists[playlist.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated.UpdatedAt = memoryNow()
+	updated.Title = playlist.Title
+	updated.Description = playlist.Description
+	updated.Visibility = playlist.Visibility
+	s.playlists[playlist.ID] = updated
+	return nil
+}
+
+func (s *MemoryStore) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for entryID, entry := range s.entries {
+		if entry.PlaylistID == id {
+			delete(s.entries, entryID)
+		}
+	}
+	delete(s.playlists, id)
+	return nil
+}
+
+func (s *MemoryStore) playlistEntries(playlistID uuid.UUID) []PlaylistEntry {
+	entries := []PlaylistEntry{}
+	for _, entry := range s.entries {
+		if entry.PlaylistID == playlistID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Position < entries[j].Position
+	})
+	return entries
+}
+
+// touchPlaylist bumps the playlist's UpdatedAt as Client.lockPlaylist does.
+func (s *MemoryStore) touchPlaylist(id uuid.UUID) bool {
+	playlist, ok := s.playlists[id]
+	if !ok {
+		return false
+	}
+	playlist.UpdatedAt = memoryNow()
+	s.playlists[id] = playlist
+	return true
+}
+
+// shiftEntries moves the playlist's entries with positions in [from, to) by
+// delta.
+func (s *MemoryStore) shiftEntries(playlistID uuid.UUID, from, to, delta int) {
+	for id, entry := range s.entries {
+		if entry.PlaylistID == playlistID && entry.Position >= from && entry.Position < to {
+			entry.Position += delta
+			s.entries[id] = entry
+		}
+	}
+}
+
+func (s *MemoryStore) removeEntry(playlistID, entryID uuid.UUID) {
+	entry, ok := s.entries[entryID]
+	if !ok || entry.PlaylistID != playlistID || !s.touchPlaylist(playlistID) {
+		return
+	}
+	delete(s.entries, entryID)
+	s.shiftEntries(playlistID, entry.Position+1, math.MaxInt, -1)
+}
+
+func (s *MemoryStore) GetPlaylistEntries(ctx context.Context, playlistID uuid.UUID) ([]PlaylistEntry, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.playlistEntries(playlistID), nil
+}
+
+func (s *MemoryStore) GetVideoPlaylistEntries(ctx context.Context, videoID uuid.UUID) ([]PlaylistEntry, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries := []PlaylistEntry{}
+	for _, entry := range s.entries {
+		if entry.VideoID == videoID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].PlaylistID != entries[j].PlaylistID {
+			return entries[i].PlaylistID.String() < entries[j].PlaylistID.String()
+		}
+		return entries[i].Position < entries[j].Position
+	})
+	return entries, nil
+}
+
+func (s *MemoryStore) AddPlaylistEntry(ctx context.Context, params AddPlaylistEntryParams) (PlaylistEntry, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return PlaylistEntry{}, err
+	}
+	defer unlock()
+
+	if !s.touchPlaylist(params.PlaylistID) {
+		return PlaylistEntry{}, ErrNotFound
+	}
+	count := len(s.playlistEntries(params.PlaylistID))
+	position := count
+	if params.Position != nil {
+		position = min(max(0, *params.Position), count)
+	}
+	s.shiftEntries(params.PlaylistID, position, math.MaxInt, 1)
+
+	entry := PlaylistEntry{
+		ID:         uuid.New(),
+		CreatedAt:  memoryNow(),
+		PlaylistID: params.PlaylistID,
+		VideoID:    params.VideoID,
+		Position:   position,
+	}
+	s.entries[entry.ID] = entry
+	return entry, nil
+}
+
+func (s *MemoryStore) MovePlaylistEntry(ctx context.Context, playlistID, entryID uuid.UUID, position int) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if !s.touchPlaylist(playlistID) {
+		return ErrNotFound
+	}
+	entry, ok := s.entries[entryID]
+	if !ok || entry.PlaylistID != playlistID {
+		return ErrNotFound
+	}
+	to := min(max(0, position), len(s.playlistEntries(playlistID))-1)
+	switch {
+	case to < entry.Position:
+		s.shiftEntries(playlistID, to, entry.Position, 1)
+	case to > entry.Position:
+		s.shiftEntries(playlistID, entry.Position+1, to+1, -1)
+	}
+	entry.Position = to
+	s.entries[entryID] = entry
+	return nil
+}
+
+func (s *MemoryStore) RemovePlaylistEntry(ctx context.Context, playlistID, entryID uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.removeEntry(playlistID, entryID)
+	return nil
+}
+
+// Versions
+
+func (s *MemoryStore) GetVideoVersions(ctx context.Context, videoID uuid.UUID) ([]VideoVersion, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.videoVersions(videoID), nil
+}
+
+// videoVersions returns the video's versions, newest first.
+func (s *MemoryStore) videoVersions(videoID uuid.UUID) []VideoVersion {
+	versions := []VideoVersion{}
+	for _, version := range s.versions {
+		if version.VideoID == videoID {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+	return versions
+}
+
+func (s *MemoryStore) GetVideoVersion(ctx context.Context, id uuid.UUID) (VideoVersion, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	defer unlock()
+
+	version, ok := s.versions[id]
+	if !ok {
+		return VideoVersion{}, ErrNotFound
+	}
+	return version, nil
+}
+
+func (s *MemoryStore) GetVideoURLs(ctx context.Context) ([]string, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	seen := map[string]bool{}
+	for _, video := range s.videos {
+		if video.VideoURL != nil {
+			seen[*video.VideoURL] = true
+		}
+	}
+	for _, version := range s.versions {
+		seen[version.VideoURL] = true
+	}
+	return slices.Sorted(maps.Keys(seen)), nil
+}
+
+func (s *MemoryStore) CreateVideoVersion(ctx context.Context, params CreateVideoVersionParams) (VideoVersion, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	defer unlock()
+
+	latest := 0
+	for _, version := range s.versions {
+		if version.VideoID == params.VideoID {
+			latest = max(latest, version.Version)
+		}
+	}
+
+	now := memoryNow()
+	version := VideoVersion{
+		ID:                       uuid.New(),
+		CreatedAt:                now,
+		UpdatedAt:                now,
+		Version:                  latest + 1,
+		CreateVideoVersionParams: params,
+	}
+	s.versions[version.ID] = version
+	return version, nil
+}
+
+func (s *MemoryStore) UpdateVideoVersion(ctx context.Context, version VideoVersion) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	existing, ok := s.versions[version.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.UpdatedAt = memoryNow()
+	existing.Source = version.Source
+	existing.VideoURL = version.VideoURL
+	existing.AudioURL = version.AudioURL
+	existing.SourceKey = version.SourceKey
+	existing.Duration = version.Duration
+	existing.AspectRatio = version.AspectRatio
+	existing.StoredBytes = version.StoredBytes
+	existing.ContentSHA256 = version.ContentSHA256
+	s.versions[version.ID] = existing
+	return nil
+}
+
+// Subtitle tracks
+
+func (s *MemoryStore) subtitleTracks(videoID uuid.UUID) []SubtitleTrack {
+	tracks := []SubtitleTrack{}
+	for _, track := range s.subtitles {
+		if track.VideoID == videoID {
+			tracks = append(tracks, track)
+		}
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		if tracks[i].Language != tracks[j].Language {
+			return tracks[i].Language < tracks[j].Language
+		}
+		return tracks[i].Label < tracks[j].Label
+	})
+	return tracks
+}
+
+func (s *MemoryStore) GetSubtitleTracks(ctx context.Context, videoID uuid.UUID) ([]SubtitleTrack, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.subtitleTracks(videoID), nil
+}
+
+func (s *MemoryStore) CreateSubtitleTrack(ctx context.Context, params CreateSubtitleTrackParams) (SubtitleTrack, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return SubtitleTrack{}, err
+	}
+	defer unlock()
+
+	for _, track := range s.subtitles {
+		if track.VideoID == params.VideoID && track.Language == params.Language && track.Label == params.Label {
+			return SubtitleTrack{}, fmt.Errorf("video already has a %s subtitle track labelled %q", params.Language, params.Label)
+		}
+	}
+
+	now := memoryNow()
+	track := SubtitleTrack{
+		ID:                        uuid.New(),
+		CreatedAt:                 now,
+		UpdatedAt:                 now,
+		CreateSubtitleTrackParams: params,
+	}
+	s.subtitles[track.ID] = track
+	return track, nil
+}
+
+func (s *MemoryStore) GetSubtitleTrack(ctx context.Context, id uuid.UUID) (SubtitleTrack, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return SubtitleTrack{}, err
+	}
+	defer unlock()
+
+	track, ok := s.subtitles[id]
+	if !ok {
+		return SubtitleTrack{}, ErrNotFound
+	}
+	return track, nil
+}
+
+func (s *MemoryStore) DeleteSubtitleTrack(ctx context.Context, id uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(s.subtitles, id)
+	return nil
+}
+
+// Chapters
+
+func (s *MemoryStore) chapterList(videoID uuid.UUID) []Chapter {
+	chapters := []Chapter{}
+	for _, chapter := range s.chapters {
+		if chapter.VideoID == videoID {
+			chapters = append(chapters, chapter)
+		}
+	}
+	sort.Slice(chapters, func(i, j int) bool {
+		return chapters[i].StartSeconds < chapters[j].StartSeconds
+	})
+	return chapters
+}
+
+func (s *MemoryStore) GetChapters(ctx context.Context, videoID uuid.UUID) ([]Chapter, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return s.chapterList(videoID), nil
+}
+
+func (s *MemoryStore) ReplaceChapters(ctx context.Context, videoID uuid.UUID, params []CreateChapterParams) ([]Chapter, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	for id, chapter := range s.chapters {
+		if chapter.VideoID == videoID {
+			delete(s.chapters, id)
+		}
+	}
+
+	now := memoryNow()
+	for _, chapterParams := range params {
+		chapter := Chapter{
+			ID:                  uuid.New(),
+			CreatedAt:           now,
+			UpdatedAt:           now,
+			VideoID:             videoID,
+			CreateChapterParams: chapterParams,
+		}
+		s.chapters[chapter.ID] = chapter
+	}
+	return s.chapterList(videoID), nil
+}
+
+func (s *MemoryStore) DeleteChapter(ctx context.Context, id uuid.UUID) error {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	delete(s.chapters, id)
+	return nil
+}
+
+// Blobs
+
+func (s *MemoryStore) GetBlob(ctx context.Context, hash string) (Blob, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Blob{}, err
+	}
+	defer unlock()
+
+	blob, ok := s.blobs[hash]
+	if !ok {
+		return Blob{}, ErrNotFound
+	}
+	return blob, nil
+}
+
+func (s *MemoryStore) GetBlobs(ctx context.Context) ([]Blob, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	blobs := []Blob{}
+	for _, blob := range s.blobs {
+		blobs = append(blobs, blob)
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		if !blobs[i].CreatedAt.Equal(blobs[j].CreatedAt) {
+			return blobs[i].CreatedAt.Before(blobs[j].CreatedAt)
+		}
+		return blobs[i].Hash < blobs[j].Hash
+	})
+	return blobs, nil
+}
+
+func (s *MemoryStore) AddBlobReference(ctx context.Context, params CreateBlobParams) (Blob, bool, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return Blob{}, false, err
+	}
+	defer unlock()
+
+	now := memoryNow()
+	blob, ok := s.blobs[params.Hash]
+	if ok {
+		blob.RefCount++
+		blob.UpdatedAt = now
+		s.blobs[params.Hash] = blob
+		return blob, false, nil
+	}
+
+	for _, other := range s.blobs {
+		if other.ObjectKey == params.ObjectKey {
+			return Blob{}, false, fmt.Errorf("object key %s is already in use", params.ObjectKey)
+		}
+	}
+	blob = Blob{
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		RefCount:         1,
+		CreateBlobParams: params,
+	}
+	s.blobs[params.Hash] = blob
+	return blob, true, nil
+}
+
+func (s *MemoryStore) ReleaseBlob(ctx context.Context, objectKey string, deleteObject func(ctx context.Context, key string) error) (int, error) {
+	unlock, err := s.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	for hash, blob := range s.blobs {
+		if blob.ObjectKey != objectKey {
+			continue
+		}
+		blob.RefCount--
+		if blob.RefCount > 0 {
+			blob.UpdatedAt = memoryNow()
+			s.blobs[hash] = blob
+			return blob.RefCount, nil
+		}
+		delete(s.blobs, hash)
+		return 0, deleteObject(ctx, objectKey)
+	}
+	return 0, deleteObject(ctx, objectKey)
+}
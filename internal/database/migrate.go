@@ -0,0 +1,334 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one numbered change to the schema. Files are named
+// NNNN_name.up.sql and NNNN_name.down.sql. A dialect that can't run those
+// gets its own, e.g. NNNN_name.up.postgres.sql.
+type migration struct {
+	Version int
+	Name    string
+	// up and down are keyed by dialect name, with "" for the shared files.
+	up   map[string]string
+	down map[string]string
+}
+
+func (m migration) Up(d dialect) string {
+	if statements, ok := m.up[d.name]; ok {
+		return statements
+	}
+	return m.up[""]
+}
+
+func (m migration) Down(d dialect) string {
+	if statements, ok := m.down[d.name]; ok {
+		return statements
+	}
+	return m.down[""]
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		parts := strings.Split(strings.TrimSuffix(fileName, ".sql"), ".")
+		if len(parts) < 2 || len(parts) > 3 || (parts[1] != "up" && parts[1] != "down") {
+			return nil, fmt.Errorf("migration %s should be named NNNN_name.up.sql or NNNN_name.down.sql", fileName)
+		}
+		base, direction, dialectName := parts[0], parts[1], ""
+		if len(parts) == 3 {
+			dialectName = parts[2]
+		}
+		rawVersion, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(rawVersion)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s has no version number", fileName)
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name, up: map[string]string{}, down: map[string]string{}}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up[dialectName] = string(contents)
+		} else {
+			m.down[dialectName] = string(contents)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up[""] == "" || m.down[""] == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (c Client) ensureMigrationsTable(ctx context.Context) error {
+	_, err := c.db.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	return err
+}
+
+func (c Client) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	err := c.ensureMigrationsTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies every pending migration in order, each in its own
+// transaction, and returns how many ran. It also creates the SQLite search
+// index, which depends on how the driver was built.
+func (c Client) Migrate(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if m.Version == 1 {
+			err := c.adoptLegacySchema(ctx)
+			if err != nil {
+				return count, fmt.Errorf("unable to adopt existing schema: %w", err)
+			}
+		}
+		err := c.runMigration(ctx, m.Version, m.Up(c.db.dialect), func(tx Client) error {
+			_, err := tx.db.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, CURRENT_TIMESTAMP)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	err = c.ensureSearchIndex(ctx)
+	if err != nil {
+		return count, fmt.Errorf("unable to build search index: %w", err)
+	}
+	return count, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, newest first.
+func (c Client) MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := c.runMigration(ctx, m.Version, m.Down(c.db.dialect), func(tx Client) error {
+			_, err := tx.db.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (c Client) runMigration(ctx context.Context, version int, statements string, record func(tx Client) error) error {
+	return c.inTx(ctx, func(tx Client) error {
+		// Migrations take no parameters, so they skip rebinding.
+		_, err := tx.db.tx.ExecContext(ctx, statements)
+		if err != nil {
+			return fmt.Errorf("migration %04d failed: %w", version, err)
+		}
+		return record(tx)
+	})
+}
+
+// MigrationStatus lists every known migration and when it was applied, if it
+// has been.
+func (c Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// PendingMigrations counts the migrations that haven't been applied yet.
+func (c Client) PendingMigrations(ctx context.Context) (int, error) {
+	statuses, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// adoptLegacySchema brings a videos table created by an older build, before
+// migrations were tracked, up to the shape the baseline migration expects.
+// Columns were added to it over time with ALTER TABLE, which CREATE TABLE IF
+// NOT EXISTS in the baseline can't do. Only SQLite databases predate
+// migrations.
+func (c Client) adoptLegacySchema(ctx context.Context) error {
+	if c.db.dialect != sqliteDialect {
+		return nil
+	}
+
+	var count int
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'videos'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"source_key", "TEXT"},
+		{"audio_url", "TEXT"},
+		{"duration_seconds", "REAL"},
+		{"video_bytes", "INTEGER NOT NULL DEFAULT 0"},
+		{"thumbnail_bytes", "INTEGER NOT NULL DEFAULT 0"},
+		{"current_version_id", "TEXT"},
+		{"deleted_at", "TIMESTAMP"},
+	}
+	for _, column := range columns {
+		err := c.addColumnIfMissing(ctx, "videos", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing is only needed to adopt databases created before
+// migrations existed.
+func (c Client) addColumnIfMissing(ctx context.Context, table, column, definition string) error {
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name         string
+			columnType   string
+			notNull      bool
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = c.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func columnType(t *testing.T, c Client, table, column string) string {
+	t.Helper()
+	var columnType string
+	err := c.db.QueryRowContext(context.Background(), "SELECT type FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&columnType)
+	if err != nil {
+		t.Fatalf("unable to read %s.%s: %v", table, column, err)
+	}
+	return columnType
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, c Client) {
+		migrations, err := loadMigrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending, err := c.PendingMigrations(context.Background())
+		if err != nil || pending != 0 {
+			t.Fatalf("%d migrations pending after migrating: %v", pending, err)
+		}
+
+		applied, err := c.Migrate(context.Background())
+		if err != nil || applied != 0 {
+			t.Fatalf("second run applied %d migrations: %v", applied, err)
+		}
+
+		reverted, err := c.MigrateDown(context.Background(), len(migrations))
+		if err != nil || reverted != len(migrations) {
+			t.Fatalf("reverted %d migrations: %v", reverted, err)
+		}
+		pending, err = c.PendingMigrations(context.Background())
+		if err != nil || pending != len(migrations) {
+			t.Fatalf("%d migrations pending after reverting: %v", pending, err)
+		}
+
+		applied, err = c.Migrate(context.Background())
+		if err != nil || applied != len(migrations) {
+			t.Fatalf("applied %d of %d migrations after reverting: %v", applied, len(migrations), err)
+		}
+	})
+}
+
+func TestMigrateFixesVideoColumnTypes(t *testing.T) {
+	c := newSQLiteClient(t)
+	_, err := c.Migrate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := columnType(t, c, "videos", "user_id"); got != "TEXT" {
+		t.Errorf("videos.user_id is %s", got)
+	}
+	if got := columnType(t, c, "videos", "video_url"); got != "TEXT" {
+		t.Errorf("videos.video_url is %s", got)
+	}
+}
+
+func TestMigrateAdoptsLegacySchema(t *testing.T) {
+	c := newSQLiteClient(t)
+
+	// The schema the first releases created, before videos grew any columns.
+	_, err := c.db.ExecContext(context.Background(), `
+	CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		password TEXT NOT NULL,
+		email TEXT UNIQUE NOT NULL
+	);
+	CREATE TABLE videos (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		title TEXT NOT NULL,
+		description TEXT,
+		thumbnail_url TEXT,
+		video_url TEXT TEXT,
+		user_id INTEGER,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	INSERT INTO users (id, password, email) VALUES ('2b0cf1a4-7d5e-4a53-9d0c-3a1f2f4f7a10', 'hash', 'a@example.com');
+	INSERT INTO videos (id, title, description, video_url, user_id)
+	VALUES ('8f7c3c1e-96a4-4e55-b7a5-0a7d0f6f2f11', 'Legacy', '', 'https://cdn.example.com/landscape/a.mp4', '2b0cf1a4-7d5e-4a53-9d0c-3a1f2f4f7a10');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Migrate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := columnType(t, c, "videos", "user_id"); got != "TEXT" {
+		t.Errorf("videos.user_id is %s", got)
+	}
+	videos, err := c.GetVideos(context.Background(), uuid.MustParse("2b0cf1a4-7d5e-4a53-9d0c-3a1f2f4f7a10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 1 || videos[0].CurrentVersionID == nil {
+		t.Fatalf("legacy video wasn't carried over with a version: %+v", videos)
+	}
+	version, err := c.GetVideoVersion(context.Background(), *videos[0].CurrentVersionID)
+	if err != nil || version.Version != 1 || version.VideoURL != "https://cdn.example.com/landscape/a.mp4" {
+		t.Fatalf("unexpected backfilled version %+v: %v", version, err)
+	}
+	usage, err := c.GetUserUsage(context.Background(), videos[0].UserID)
+	if err != nil || usage.VideoCount != 1 {
+		t.Fatalf("unexpected usage %+v: %v", usage, err)
+	}
+}
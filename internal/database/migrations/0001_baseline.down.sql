@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS user_quotas;
+DROP TABLE IF EXISTS user_usage;
+DROP TABLE IF EXISTS video_versions;
+DROP TABLE IF EXISTS blobs;
+DROP TABLE IF EXISTS chapters;
+DROP TABLE IF EXISTS watermarks;
+DROP TABLE IF EXISTS subtitle_tracks;
+DROP TABLE IF EXISTS videos;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,126 @@
+-- The baseline schema for PostgreSQL. There are no PostgreSQL databases from
+-- before migrations, so unlike the SQLite baseline nothing needs backfilling,
+-- and columns get their proper types from the start: TIMESTAMPTZ so instants
+-- survive any session time zone, BIGINT for byte counts and DOUBLE PRECISION
+-- where SQLite's REAL is 8 bytes.
+
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT,
+	source_key TEXT,
+	audio_url TEXT,
+	duration_seconds DOUBLE PRECISION,
+	video_bytes BIGINT NOT NULL DEFAULT 0,
+	thumbnail_bytes BIGINT NOT NULL DEFAULT 0,
+	current_version_id TEXT,
+	deleted_at TIMESTAMPTZ,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE subtitle_tracks (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	language TEXT NOT NULL,
+	label TEXT NOT NULL,
+	url TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	UNIQUE(video_id, language, label),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE watermarks (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	image_url TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	position TEXT NOT NULL,
+	opacity DOUBLE PRECISION NOT NULL,
+	scale DOUBLE PRECISION NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	retain_source BOOLEAN NOT NULL DEFAULT FALSE,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE chapters (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	start_seconds DOUBLE PRECISION NOT NULL,
+	source TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE blobs (
+	hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	object_key TEXT UNIQUE NOT NULL,
+	size BIGINT NOT NULL,
+	ref_count INTEGER NOT NULL
+);
+
+CREATE TABLE video_versions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	uploaded_by TEXT NOT NULL,
+	source TEXT NOT NULL,
+	video_url TEXT NOT NULL,
+	audio_url TEXT,
+	source_key TEXT,
+	duration_seconds DOUBLE PRECISION,
+	aspect_ratio TEXT NOT NULL DEFAULT '',
+	stored_bytes BIGINT NOT NULL DEFAULT 0,
+	content_sha256 TEXT,
+	UNIQUE(video_id, version),
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(uploaded_by) REFERENCES users(id)
+);
+
+CREATE TABLE user_usage (
+	user_id TEXT PRIMARY KEY,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	bytes_used BIGINT NOT NULL DEFAULT 0,
+	video_count INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE user_quotas (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	max_bytes BIGINT,
+	max_videos INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
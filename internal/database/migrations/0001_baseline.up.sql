@@ -0,0 +1,174 @@
+-- The schema as autoMigrate left it. Every statement tolerates an existing
+-- database so ones created before migrations existed can adopt this as their
+-- starting point.
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	source_key TEXT,
+	audio_url TEXT,
+	duration_seconds REAL,
+	video_bytes INTEGER NOT NULL DEFAULT 0,
+	thumbnail_bytes INTEGER NOT NULL DEFAULT 0,
+	current_version_id TEXT,
+	deleted_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS subtitle_tracks (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	language TEXT NOT NULL,
+	label TEXT NOT NULL,
+	url TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	UNIQUE(video_id, language, label),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS watermarks (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	image_url TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	position TEXT NOT NULL,
+	opacity REAL NOT NULL,
+	scale REAL NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	retain_source BOOLEAN NOT NULL DEFAULT FALSE,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS chapters (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	start_seconds REAL NOT NULL,
+	source TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE IF NOT EXISTS blobs (
+	hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	object_key TEXT UNIQUE NOT NULL,
+	size INTEGER NOT NULL,
+	ref_count INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS video_versions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	uploaded_by TEXT NOT NULL,
+	source TEXT NOT NULL,
+	video_url TEXT NOT NULL,
+	audio_url TEXT,
+	source_key TEXT,
+	duration_seconds REAL,
+	aspect_ratio TEXT NOT NULL DEFAULT '',
+	stored_bytes INTEGER NOT NULL DEFAULT 0,
+	content_sha256 TEXT,
+	UNIQUE(video_id, version),
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(uploaded_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_usage (
+	user_id TEXT PRIMARY KEY,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	bytes_used INTEGER NOT NULL DEFAULT 0,
+	video_count INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_quotas (
+	user_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	max_bytes INTEGER,
+	max_videos INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- Videos uploaded before versioning get a first version built from the
+-- video row. The id is a random version 4 UUID.
+INSERT INTO video_versions (
+	id,
+	created_at,
+	updated_at,
+	video_id,
+	version,
+	uploaded_by,
+	source,
+	video_url,
+	audio_url,
+	source_key,
+	duration_seconds,
+	stored_bytes
+)
+SELECT
+	lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' ||
+		substr(lower(hex(randomblob(2))), 2) || '-' ||
+		substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' ||
+		lower(hex(randomblob(6))),
+	CURRENT_TIMESTAMP,
+	CURRENT_TIMESTAMP,
+	id,
+	1,
+	user_id,
+	'upload',
+	video_url,
+	audio_url,
+	source_key,
+	duration_seconds,
+	video_bytes
+FROM videos
+WHERE video_url IS NOT NULL AND current_version_id IS NULL;
+
+UPDATE videos
+SET current_version_id = (
+	SELECT video_versions.id
+	FROM video_versions
+	WHERE video_versions.video_id = videos.id AND video_versions.version = 1
+)
+WHERE video_url IS NOT NULL AND current_version_id IS NULL;
+
+-- Users who had videos before usage was tracked start from what they have.
+INSERT OR IGNORE INTO user_usage (user_id, updated_at, bytes_used, video_count)
+SELECT user_id, CURRENT_TIMESTAMP, SUM(video_bytes + thumbnail_bytes), COUNT(*)
+FROM videos
+WHERE user_id IS NOT NULL
+GROUP BY user_id;
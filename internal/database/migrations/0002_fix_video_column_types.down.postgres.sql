@@ -0,0 +1,3 @@
+DROP INDEX videos_user_id;
+
+ALTER TABLE videos ALTER COLUMN user_id DROP NOT NULL;
@@ -0,0 +1,56 @@
+CREATE TABLE videos_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	source_key TEXT,
+	audio_url TEXT,
+	duration_seconds REAL,
+	video_bytes INTEGER NOT NULL DEFAULT 0,
+	thumbnail_bytes INTEGER NOT NULL DEFAULT 0,
+	current_version_id TEXT,
+	deleted_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_old (
+	id,
+	created_at,
+	updated_at,
+	title,
+	description,
+	thumbnail_url,
+	video_url,
+	user_id,
+	source_key,
+	audio_url,
+	duration_seconds,
+	video_bytes,
+	thumbnail_bytes,
+	current_version_id,
+	deleted_at
+)
+SELECT
+	id,
+	created_at,
+	updated_at,
+	title,
+	description,
+	thumbnail_url,
+	video_url,
+	user_id,
+	source_key,
+	audio_url,
+	duration_seconds,
+	video_bytes,
+	thumbnail_bytes,
+	current_version_id,
+	deleted_at
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_old RENAME TO videos;
@@ -0,0 +1,6 @@
+-- The PostgreSQL baseline already declares videos.user_id as TEXT; what's left
+-- is making it required and indexing it like SQLite.
+
+ALTER TABLE videos ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX videos_user_id ON videos(user_id);
@@ -0,0 +1,62 @@
+-- videos.user_id was declared INTEGER although it has always held UUID
+-- strings, and video_url had a doubled type. SQLite can't change a column's
+-- type, so the table is rebuilt.
+
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	audio_url TEXT,
+	duration_seconds REAL,
+	source_key TEXT,
+	current_version_id TEXT,
+	video_bytes INTEGER NOT NULL DEFAULT 0,
+	thumbnail_bytes INTEGER NOT NULL DEFAULT 0,
+	deleted_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_new (
+	id,
+	created_at,
+	updated_at,
+	title,
+	description,
+	thumbnail_url,
+	video_url,
+	audio_url,
+	duration_seconds,
+	source_key,
+	current_version_id,
+	video_bytes,
+	thumbnail_bytes,
+	deleted_at,
+	user_id
+)
+SELECT
+	id,
+	created_at,
+	updated_at,
+	title,
+	description,
+	thumbnail_url,
+	video_url,
+	audio_url,
+	duration_seconds,
+	source_key,
+	current_version_id,
+	video_bytes,
+	thumbnail_bytes,
+	deleted_at,
+	CAST(user_id AS TEXT)
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE INDEX videos_user_id ON videos(user_id);
@@ -0,0 +1,2 @@
+-- Listing pages a user's videos newest first by default.
+CREATE INDEX videos_user_id_created_at ON videos(user_id, created_at, id);
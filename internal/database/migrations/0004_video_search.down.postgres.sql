@@ -0,0 +1,5 @@
+DROP INDEX videos_search_vector;
+
+ALTER TABLE videos DROP COLUMN search_vector;
+
+ALTER TABLE videos DROP COLUMN visibility;
@@ -0,0 +1,8 @@
+ALTER TABLE videos ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private';
+
+ALTER TABLE videos ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(description, '')), 'B')
+) STORED;
+
+CREATE INDEX videos_search_vector ON videos USING GIN (search_vector);
@@ -0,0 +1,3 @@
+-- The SQLite search index lives in videos_fts, which Migrate creates when the
+-- driver is built with FTS5, since the module can't be assumed here.
+ALTER TABLE videos ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private';
@@ -0,0 +1,20 @@
+-- Tags belong to a user, who applies them to their own videos.
+CREATE TABLE tags (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	UNIQUE(user_id, name),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE video_tags (
+	video_id TEXT NOT NULL,
+	tag_id TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, tag_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX video_tags_tag_id ON video_tags(tag_id);
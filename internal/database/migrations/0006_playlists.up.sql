@@ -0,0 +1,27 @@
+-- Entries are numbered 0, 1, 2... within a playlist. The same video can
+-- appear more than once.
+CREATE TABLE playlists (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	visibility TEXT NOT NULL DEFAULT 'private',
+	user_id TEXT NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX playlists_user_id ON playlists(user_id, created_at);
+
+CREATE TABLE playlist_entries (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	playlist_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	FOREIGN KEY(playlist_id) REFERENCES playlists(id),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE INDEX playlist_entries_playlist_id ON playlist_entries(playlist_id, position);
+CREATE INDEX playlist_entries_video_id ON playlist_entries(video_id);
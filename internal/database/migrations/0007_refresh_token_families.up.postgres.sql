@@ -0,0 +1,7 @@
+-- Every refresh replaces the token with a new one in the same family, which
+-- stands for one login. Tokens issued before this get a family of their own.
+ALTER TABLE refresh_tokens ADD COLUMN family_id TEXT;
+
+UPDATE refresh_tokens SET family_id = gen_random_uuid()::text;
+
+CREATE INDEX refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,8 @@
+-- Where and when a login was last used, shown to the user as their sessions.
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN last_used_at TIMESTAMP;
+
+UPDATE refresh_tokens SET last_used_at = updated_at;
+
+CREATE INDEX refresh_tokens_user_id ON refresh_tokens(user_id);
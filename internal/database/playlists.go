@@ -0,0 +1,338 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Playlist struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Visibility defaults to private and means the same as a video's.
+	Visibility string    `json:"visibility"`
+	UserID     uuid.UUID `json:"user_id"`
+}
+
+// PlaylistEntry is a video's place in a playlist. Positions run from 0 with
+// no gaps.
+type PlaylistEntry struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	PlaylistID uuid.UUID `json:"playlist_id"`
+	VideoID    uuid.UUID `json:"video_id"`
+	Position   int       `json:"position"`
+}
+
+type AddPlaylistEntryParams struct {
+	PlaylistID uuid.UUID
+	VideoID    uuid.UUID
+	// Position is where the entry goes, moving the ones from there on down.
+	// Nil, or anything past the end, appends it.
+	Position *int
+}
+
+const playlistColumns = `
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		visibility,
+		user_id
+`
+
+func scanPlaylist(row rowScanner) (Playlist, error) {
+	var playlist Playlist
+	err := row.Scan(
+		&playlist.ID,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.Title,
+		&playlist.Description,
+		&playlist.Visibility,
+		&playlist.UserID,
+	)
+	return playlist, err
+}
+
+func (c Client) CreatePlaylist(ctx context.Context, params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPrivate
+	}
+	query := `
+	INSERT INTO playlists (
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		visibility,
+		user_id
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query, id, params.Title, params.Description, params.Visibility, params.UserID)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	return c.GetPlaylist(ctx, id)
+}
+
+func (c Client) GetPlaylist(ctx context.Context, id uuid.UUID) (Playlist, error) {
+	query := `SELECT` + playlistColumns + `
+	FROM playlists
+	WHERE id = ?
+	`
+	playlist, err := scanPlaylist(c.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Playlist{}, ErrNotFound
+	}
+	return playlist, err
+}
+
+// GetPlaylists lists a user's playlists, oldest first.
+func (c Client) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error) {
+	query := `SELECT` + playlistColumns + `
+	FROM playlists
+	WHERE user_id = ?
+	ORDER BY created_at, id
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		playlist, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, rows.Err()
+}
+
+func (c Client) UpdatePlaylist(ctx context.Context, playlist Playlist) error {
+	query := `
+	UPDATE playlists
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		title = ?,
+		description = ?,
+		visibility = ?
+	WHERE id = ?
+	`
+	return requireRow(c.db.ExecContext(ctx, query, playlist.Title, playlist.Description, playlist.Visibility, playlist.ID))
+}
+
+// DeletePlaylist removes the playlist and its entries, but not the videos in
+// it. Deleting a playlist that doesn't exist is not an error.
+func (c Client) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
+	return c.inTx(ctx, func(tx Client) error {
+		_, err := tx.db.ExecContext(ctx, "DELETE FROM playlist_entries WHERE playlist_id = ?", id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, "DELETE FROM playlists WHERE id = ?", id)
+		return err
+	})
+}
+
+// GetPlaylistEntries returns the playlist's entries in order.
+func (c Client) GetPlaylistEntries(ctx context.Context, playlistID uuid.UUID) ([]PlaylistEntry, error) {
+	return c.queryPlaylistEntries(ctx, "WHERE playlist_id = ? ORDER BY position", playlistID)
+}
+
+// GetVideoPlaylistEntries returns every entry for the video, whoever's
+// playlist it is in.
+func (c Client) GetVideoPlaylistEntries(ctx context.Context, videoID uuid.UUID) ([]PlaylistEntry, error) {
+	return c.queryPlaylistEntries(ctx, "WHERE video_id = ? ORDER BY playlist_id, position", videoID)
+}
+
+func (c Client) queryPlaylistEntries(ctx context.Context, where string, args ...any) ([]PlaylistEntry, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		playlist_id,
+		video_id,
+		position
+	FROM playlist_entries
+	` + where
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []PlaylistEntry{}
+	for rows.Next() {
+		var entry PlaylistEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.PlaylistID,
+			&entry.VideoID,
+			&entry.Position,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// lockPlaylist bumps the playlist's updated_at, which also makes concurrent
+// changes to its entries wait for this transaction so positions can't
+// collide. It returns how many entries the playlist has.
+func (c Client) lockPlaylist(ctx context.Context, playlistID uuid.UUID) (int, error) {
+	err := requireRow(c.db.ExecContext(ctx, "UPDATE playlists SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", playlistID))
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM playlist_entries WHERE playlist_id = ?", playlistID).Scan(&count)
+	return count, err
+}
+
+// entryPosition finds where an entry is in the playlist.
+func (c Client) entryPosition(ctx context.Context, playlistID, entryID uuid.UUID) (int, error) {
+	var position int
+	err := c.db.QueryRowContext(ctx, "SELECT position FROM playlist_entries WHERE id = ? AND playlist_id = ?", entryID, playlistID).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return position, err
+}
+
+func (c Client) AddPlaylistEntry(ctx context.Context, params AddPlaylistEntryParams) (PlaylistEntry, error) {
+	id := uuid.New()
+	err := c.inTx(ctx, func(tx Client) error {
+		count, err := tx.lockPlaylist(ctx, params.PlaylistID)
+		if err != nil {
+			return err
+		}
+		position := count
+		if params.Position != nil {
+			position = min(max(0, *params.Position), count)
+		}
+
+		_, err = tx.db.ExecContext(ctx, "UPDATE playlist_entries SET position = position + 1 WHERE playlist_id = ? AND position >= ?", params.PlaylistID, position)
+		if err != nil {
+			return err
+		}
+		query := `
+		INSERT INTO playlist_entries (
+			id,
+			created_at,
+			playlist_id,
+			video_id,
+			position
+		) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+		`
+		_, err = tx.db.ExecContext(ctx, query, id, params.PlaylistID, params.VideoID, position)
+		return err
+	})
+	if err != nil {
+		return PlaylistEntry{}, err
+	}
+
+	entries, err := c.GetPlaylistEntries(ctx, params.PlaylistID)
+	if err != nil {
+		return PlaylistEntry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return PlaylistEntry{}, ErrNotFound
+}
+
+// MovePlaylistEntry moves an entry to position, shifting the entries between
+// its old and new places to make room. Positions past the end move it last.
+func (c Client) MovePlaylistEntry(ctx context.Context, playlistID, entryID uuid.UUID, position int) error {
+	return c.inTx(ctx, func(tx Client) error {
+		count, err := tx.lockPlaylist(ctx, playlistID)
+		if err != nil {
+			return err
+		}
+		from, err := tx.entryPosition(ctx, playlistID, entryID)
+		if err != nil {
+			return err
+		}
+		to := min(max(0, position), count-1)
+
+		switch {
+		case to < from:
+			_, err = tx.db.ExecContext(ctx, "UPDATE playlist_entries SET position = position + 1 WHERE playlist_id = ? AND position >= ? AND position < ?", playlistID, to, from)
+		case to > from:
+			_, err = tx.db.ExecContext(ctx, "UPDATE playlist_entries SET position = position - 1 WHERE playlist_id = ? AND position > ? AND position <= ?", playlistID, from, to)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, "UPDATE playlist_entries SET position = ? WHERE id = ?", to, entryID)
+		return err
+	})
+}
+
+// RemovePlaylistEntry takes an entry out of the playlist and closes the gap
+// it leaves. Removing an entry that isn't there is not an error.
+func (c Client) RemovePlaylistEntry(ctx context.Context, playlistID, entryID uuid.UUID) error {
+	err := c.inTx(ctx, func(tx Client) error {
+		_, err := tx.lockPlaylist(ctx, playlistID)
+		if err != nil {
+			return err
+		}
+		position, err := tx.entryPosition(ctx, playlistID, entryID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.db.ExecContext(ctx, "DELETE FROM playlist_entries WHERE id = ?", entryID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, "UPDATE playlist_entries SET position = position - 1 WHERE playlist_id = ? AND position > ?", playlistID, position)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// removeVideoFromPlaylists deletes every entry for the video, renumbering the
+// playlists it was in. Call it inside a transaction.
+func (c Client) removeVideoFromPlaylists(ctx context.Context, videoID uuid.UUID) error {
+	entries, err := c.GetVideoPlaylistEntries(ctx, videoID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := c.RemovePlaylistEntry(ctx, entry.PlaylistID, entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,58 +11,158 @@ import (
 
 type RefreshToken struct {
 	CreateRefreshTokenParams
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// LastUsedAt is when the token was issued or, once it has been swapped
+	// for a new one, when that happened.
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
 }
 
 type CreateRefreshTokenParams struct {
-	Token     string    `json:"token"`
-	UserID    uuid.UUID `json:"user_id"`
+	Token  string    `json:"token"`
+	UserID uuid.UUID `json:"user_id"`
+	// FamilyID links the tokens that replaced each other since a login. A
+	// new family is started if it is unset.
+	FamilyID  uuid.UUID `json:"family_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// UserAgent and IPAddress describe the client that was given the token.
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
 }
 
-func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+// Session is a login as the user sees it: a token family with a live token,
+// described by that token. LastUsedAt is when the session last logged in or
+// refreshed; access tokens are checked without the database, so requests
+// made with them don't move it.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+var (
+	// ErrRefreshTokenExpired is returned when rotating a token past its
+	// expiry.
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	// ErrRefreshTokenReused is returned when a token that was already
+	// replaced or revoked is presented again. Someone may have stolen it, so
+	// every token in its family has been revoked by then.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+func (c Client) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
+	if params.FamilyID == uuid.Nil {
+		params.FamilyID = uuid.New()
+	}
 	query := `
 		INSERT INTO refresh_tokens (
 			token,
 			created_at,
 			updated_at,
+			last_used_at,
 			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+			family_id,
+			expires_at,
+			user_agent,
+			ip_address
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	_, err := c.db.ExecContext(ctx, query, params.Token, params.UserID.String(), params.FamilyID, c.db.dialect.timestamp(params.ExpiresAt), params.UserAgent, params.IPAddress)
 	if err != nil {
 		return RefreshToken{}, err
 	}
 
-	return c.GetRefreshToken(params.Token)
+	return c.GetRefreshToken(ctx, params.Token)
 }
 
-func (c Client) RevokeRefreshToken(token string) error {
+func (c Client) RevokeRefreshToken(ctx context.Context, token string) error {
 	query := `
 		UPDATE refresh_tokens
 		SET revoked_at = CURRENT_TIMESTAMP
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
-	return err
+	return requireRow(c.db.ExecContext(ctx, query, token))
 }
 
-func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
+// RotateRefreshToken swaps a live token for a new one, created from params, in
+// the same family. Presenting a token that is already revoked revokes its
+// whole family and returns ErrRefreshTokenReused.
+func (c Client) RotateRefreshToken(ctx context.Context, token string, params CreateRefreshTokenParams) (RefreshToken, error) {
+	var (
+		rotated RefreshToken
+		reused  bool
+	)
+	err := c.inTx(ctx, func(tx Client) error {
+		current, err := tx.GetRefreshToken(ctx, token)
+		if err != nil {
+			return err
+		}
+
+		// Revoking only if nobody else has means that of two refreshes racing
+		// with the same token, one is treated as reuse.
+		err = requireRow(tx.db.ExecContext(ctx, `
+			UPDATE refresh_tokens
+			SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, last_used_at = CURRENT_TIMESTAMP
+			WHERE token = ? AND revoked_at IS NULL
+		`, token))
+		if errors.Is(err, ErrNotFound) {
+			reused = true
+			_, err = tx.db.ExecContext(ctx, `
+				UPDATE refresh_tokens
+				SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+				WHERE family_id = ? AND revoked_at IS NULL
+			`, current.FamilyID)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if !current.ExpiresAt.After(time.Now()) {
+			return ErrRefreshTokenExpired
+		}
+
+		params.UserID = current.UserID
+		params.FamilyID = current.FamilyID
+		rotated, err = tx.CreateRefreshToken(ctx, params)
+		return err
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if reused {
+		return RefreshToken{}, ErrRefreshTokenReused
+	}
+	return rotated, nil
+}
+
+func (c Client) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT
+			token,
+			created_at,
+			updated_at,
+			last_used_at,
+			user_id,
+			family_id,
+			expires_at,
+			user_agent,
+			ip_address,
+			revoked_at
 		FROM refresh_tokens
 		WHERE token = ?
 	`
 	var rt RefreshToken
 	var userID string
-	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+	var lastUsedAt *time.Time
+	err := c.db.QueryRowContext(ctx, query, token).
+		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &lastUsedAt, &userID, &rt.FamilyID, &rt.ExpiresAt, &rt.UserAgent, &rt.IPAddress, &rt.RevokedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return RefreshToken{}, nil
+		if errors.Is(err, sql.ErrNoRows) {
+			return RefreshToken{}, ErrNotFound
 		}
 		return RefreshToken{}, err
 	}
@@ -69,15 +171,107 @@ func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	if err != nil {
 		return RefreshToken{}, err
 	}
+	rt.LastUsedAt = rt.CreatedAt
+	if lastUsedAt != nil {
+		rt.LastUsedAt = *lastUsedAt
+	}
 
 	return rt, nil
 }
 
-func (c Client) DeleteRefreshToken(token string) error {
+func (c Client) DeleteRefreshToken(ctx context.Context, token string) error {
 	query := `
 		DELETE FROM refresh_tokens
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.db.ExecContext(ctx, query, token)
 	return err
 }
+
+// GetSessions lists the user's logins that can still be refreshed, most
+// recently used first.
+func (c Client) GetSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	// A session started when the first token in its family was issued.
+	query := `
+		SELECT
+			t.family_id,
+			f.started_at,
+			t.created_at,
+			t.last_used_at,
+			t.expires_at,
+			t.user_agent,
+			t.ip_address
+		FROM refresh_tokens t
+		JOIN (
+			SELECT family_id, MIN(created_at) AS started_at
+			FROM refresh_tokens
+			WHERE user_id = ?
+			GROUP BY family_id
+		) f ON f.family_id = t.family_id
+		WHERE t.user_id = ? AND t.revoked_at IS NULL AND t.expires_at > ?
+		ORDER BY COALESCE(t.last_used_at, t.created_at) DESC, t.family_id
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID.String(), userID.String(), c.db.dialect.timestamp(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var (
+			session    Session
+			startedAt  any
+			issuedAt   time.Time
+			lastUsedAt *time.Time
+		)
+		if err := rows.Scan(
+			&session.ID,
+			&startedAt,
+			&issuedAt,
+			&lastUsedAt,
+			&session.ExpiresAt,
+			&session.UserAgent,
+			&session.IPAddress,
+		); err != nil {
+			return nil, err
+		}
+		session.CreatedAt, err = parseTimestamp(startedAt)
+		if err != nil {
+			return nil, err
+		}
+		session.LastUsedAt = issuedAt
+		if lastUsedAt != nil {
+			session.LastUsedAt = *lastUsedAt
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes the user's tokens in the family, returning
+// ErrNotFound if none of them were live.
+func (c Client) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL
+	`
+	return requireRow(c.db.ExecContext(ctx, query, userID.String(), sessionID))
+}
+
+// RevokeUserRefreshTokens logs the user out everywhere and returns how many
+// tokens it revoked.
+func (c Client) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND revoked_at IS NULL
+	`
+	result, err := c.db.ExecContext(ctx, query, userID.String())
+	if err != nil {
+		return 0, err
+	}
+	revoked, err := result.RowsAffected()
+	return int(revoked), err
+}
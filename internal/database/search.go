@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// VideoSearchResult is a video that matched a search. Snippet is an HTML
+// excerpt of its title or description: the text is escaped and the matching
+// words are wrapped in <mark>.
+type VideoSearchResult struct {
+	Video
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchVideosParams scopes a search to the user's own videos and, unless
+// OwnOnly is set, everyone's public ones. Trashed videos never match.
+type SearchVideosParams struct {
+	Query   string
+	UserID  uuid.UUID
+	OwnOnly bool
+	Limit   int
+}
+
+const (
+	snippetMarkStart = "<mark>"
+	snippetMarkEnd   = "</mark>"
+	snippetEllipsis  = "…"
+	// The database marks matches with these control characters, so the
+	// snippet can be escaped before they become tags.
+	snippetSentinelStart = "\x02"
+	snippetSentinelEnd   = "\x03"
+	snippetWords         = 16
+
+	// A word matching in the title counts this many times more than one in
+	// the description.
+	titleSearchWeight = 10
+)
+
+// searchTerms splits a query into lowercase words. Everything else is
+// dropped, so user input can't inject query syntax. A video matches when it
+// contains every term.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// usesFTS5 reports whether search runs on the videos_fts index rather than
+// LIKE.
+func (c Client) usesFTS5() bool {
+	return sqliteFTS5 && c.db.dialect == sqliteDialect
+}
+
+// FullTextSearch reports whether SearchVideos runs on a full-text index. On
+// SQLite that takes a driver built with FTS5; without it, search falls back to
+// LIKE matching.
+func (c Client) FullTextSearch() bool {
+	return c.db.dialect == postgresDialect || c.usesFTS5()
+}
+
+// ensureSearchIndex creates the SQLite full-text index and fills it if it is
+// out of step with videos, e.g. because it was just created. PostgreSQL keeps
+// its index in a generated column instead.
+func (c Client) ensureSearchIndex(ctx context.Context) error {
+	if !c.usesFTS5() {
+		return nil
+	}
+
+	_, err := c.db.ExecContext(ctx, "CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(video_id UNINDEXED, title, description, tokenize = 'porter unicode61')")
+	if err != nil {
+		return err
+	}
+
+	var videos, indexed int
+	err = c.db.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM videos), (SELECT COUNT(*) FROM videos_fts)").Scan(&videos, &indexed)
+	if err != nil {
+		return err
+	}
+	if videos == indexed {
+		return nil
+	}
+
+	return c.inTx(ctx, func(tx Client) error {
+		_, err := tx.db.ExecContext(ctx, "DELETE FROM videos_fts")
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, "INSERT INTO videos_fts (video_id, title, description) SELECT id, title, COALESCE(description, '') FROM videos")
+		return err
+	})
+}
+
+// indexVideo brings the video's entry in the full-text index up to date.
+func (c Client) indexVideo(ctx context.Context, id uuid.UUID, title, description string) error {
+	if !c.usesFTS5() {
+		return nil
+	}
+	err := c.unindexVideo(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.ExecContext(ctx, "INSERT INTO videos_fts (video_id, title, description) VALUES (?, ?, ?)", id, title, description)
+	return err
+}
+
+func (c Client) unindexVideo(ctx context.Context, id uuid.UUID) error {
+	if !c.usesFTS5() {
+		return nil
+	}
+	_, err := c.db.ExecContext(ctx, "DELETE FROM videos_fts WHERE video_id = ?", id)
+	return err
+}
+
+// SearchVideos finds videos whose title or description contain every word
+// of the query, best matches first.
+func (c Client) SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error) {
+	terms := searchTerms(params.Query)
+	if len(terms) == 0 || params.Limit <= 0 {
+		return []VideoSearchResult{}, nil
+	}
+
+	scope := "user_id = ? OR visibility = 'public'"
+	if params.OwnOnly {
+		scope = "user_id = ?"
+	}
+
+	var (
+		query string
+		args  []any
+	)
+	switch {
+	case c.usesFTS5():
+		match := make([]string, len(terms))
+		for i, term := range terms {
+			match[i] = `"` + term + `"*`
+		}
+		query = `SELECT` + videoColumns + `, matches.rank, matches.snippet
+		FROM videos
+		JOIN (
+			SELECT
+				video_id,
+				-bm25(videos_fts, 0, ?, 1) AS rank,
+				snippet(videos_fts, -1, ?, ?, ?, ?) AS snippet
+			FROM videos_fts
+			WHERE videos_fts MATCH ?
+		) AS matches ON matches.video_id = videos.id
+		WHERE deleted_at IS NULL AND (` + scope + `)
+		ORDER BY matches.rank DESC, created_at DESC
+		LIMIT ?
+		`
+		args = []any{titleSearchWeight, snippetSentinelStart, snippetSentinelEnd, snippetEllipsis, snippetWords, strings.Join(match, " "), params.UserID, params.Limit}
+	case c.db.dialect == postgresDialect:
+		match := make([]string, len(terms))
+		for i, term := range terms {
+			match[i] = term + ":*"
+		}
+		options := fmt.Sprintf(`StartSel="%s", StopSel="%s", FragmentDelimiter=%s, MaxFragments=1, MaxWords=%d, MinWords=4`, snippetSentinelStart, snippetSentinelEnd, snippetEllipsis, snippetWords)
+		query = `SELECT` + videoColumns + `,
+			ts_rank(search_vector, search_query) AS rank,
+			ts_headline('english', title || ' ' || COALESCE(description, ''), search_query, ?) AS snippet
+		FROM videos, to_tsquery('english', ?) AS search_query
+		WHERE search_vector @@ search_query AND deleted_at IS NULL AND (` + scope + `)
+		ORDER BY rank DESC, created_at DESC
+		LIMIT ?
+		`
+		args = []any{options, strings.Join(match, " & "), params.UserID, params.Limit}
+	default:
+		// Without a full-text index every term has to appear somewhere,
+		// and videos rank by where.
+		rank := make([]string, 0, len(terms))
+		conditions := make([]string, 0, len(terms))
+		var rankArgs, conditionArgs []any
+		for _, term := range terms {
+			pattern := "%" + term + "%"
+			rank = append(rank, fmt.Sprintf("(CASE WHEN title LIKE ? THEN %d ELSE 0 END) + (CASE WHEN description LIKE ? THEN 1 ELSE 0 END)", titleSearchWeight))
+			rankArgs = append(rankArgs, pattern, pattern)
+			conditions = append(conditions, "(title LIKE ? OR description LIKE ?)")
+			conditionArgs = append(conditionArgs, pattern, pattern)
+		}
+		query = `SELECT` + videoColumns + `, ` + strings.Join(rank, " + ") + ` AS rank, '' AS snippet
+		FROM videos
+		WHERE ` + strings.Join(conditions, " AND ") + ` AND deleted_at IS NULL AND (` + scope + `)
+		ORDER BY rank DESC, created_at DESC
+		LIMIT ?
+		`
+		args = append(append(rankArgs, conditionArgs...), params.UserID, params.Limit)
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var result VideoSearchResult
+		result.Video, err = scanVideo(extendedScanner{rows, []any{&result.Rank, &result.Snippet}})
+		if err != nil {
+			return nil, err
+		}
+		if result.Snippet == "" {
+			result.Snippet = highlightSnippet(result.Video, terms)
+		} else {
+			result.Snippet = markSnippet(result.Snippet)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range results {
+		if err := c.attachVideoDetails(ctx, &results[i].Video); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// extendedScanner scans extra columns selected after the ones a scan function
+// knows about.
+type extendedScanner struct {
+	rowScanner
+	extra []any
+}
+
+func (s extendedScanner) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+// searchRank scores a video the way the LIKE fallback does, or returns false
+// if it doesn't contain every term.
+func searchRank(video Video, terms []string) (float64, bool) {
+	title := strings.ToLower(video.Title)
+	description := strings.ToLower(video.Description)
+	rank := 0.0
+	for _, term := range terms {
+		inTitle := strings.Contains(title, term)
+		inDescription := strings.Contains(description, term)
+		if !inTitle && !inDescription {
+			return 0, false
+		}
+		if inTitle {
+			rank += titleSearchWeight
+		}
+		if inDescription {
+			rank++
+		}
+	}
+	return rank, true
+}
+
+// markSnippet escapes a snippet the database delimited with the sentinels and
+// turns the sentinels into <mark> tags.
+func markSnippet(snippet string) string {
+	return strings.NewReplacer(
+		snippetSentinelStart, snippetMarkStart,
+		snippetSentinelEnd, snippetMarkEnd,
+	).Replace(html.EscapeString(snippet))
+}
+
+// highlightSnippet marks the terms in the description, or the title if the
+// description doesn't mention any, and trims it to the words around the
+// first match. The words are HTML-escaped.
+func highlightSnippet(video Video, terms []string) string {
+	matches := func(word string) bool {
+		word = strings.ToLower(word)
+		for _, term := range terms {
+			if strings.Contains(word, term) {
+				return true
+			}
+		}
+		return false
+	}
+
+	words := strings.Fields(video.Description)
+	first := slices.IndexFunc(words, matches)
+	if first < 0 {
+		words = strings.Fields(video.Title)
+		first = max(0, slices.IndexFunc(words, matches))
+	}
+
+	start := max(0, first-snippetWords/4)
+	end := min(len(words), start+snippetWords)
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(snippetEllipsis)
+	}
+	for i, word := range words[start:end] {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		marked := matches(word)
+		word = html.EscapeString(word)
+		if marked {
+			word = snippetMarkStart + word + snippetMarkEnd
+		}
+		b.WriteString(word)
+	}
+	if end < len(words) {
+		b.WriteString(snippetEllipsis)
+	}
+	return b.String()
+}
@@ -0,0 +1,7 @@
+//go:build sqlite_fts5 || fts5
+
+package database
+
+// sqliteFTS5 reports whether the SQLite driver was built with FTS5, which
+// takes the sqlite_fts5 build tag. Without it, search falls back to LIKE.
+const sqliteFTS5 = true
@@ -0,0 +1,69 @@
+//go:build sqlite_fts5 || fts5
+
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSearchVideosFTS5(t *testing.T) {
+	ctx := context.Background()
+	c := newSQLiteClient(t)
+	if _, err := c.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !c.FullTextSearch() {
+		t.Fatal("built with FTS5 but search doesn't use it")
+	}
+	user := createTestUser(t, c, "a@example.com")
+
+	alps, err := c.CreateVideo(ctx, CreateVideoParams{Title: "Hiking in the Alps", Description: "Three days above the tree line", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateVideo(ctx, CreateVideoParams{Title: "Kitchen tour", Description: "Where the hiking snacks get made", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query string) []VideoSearchResult {
+		t.Helper()
+		results, err := c.SearchVideos(ctx, SearchVideosParams{Query: query, UserID: user.ID, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	// The porter stemmer matches other forms of a word, which LIKE can't,
+	// and bm25 puts title matches first.
+	results := search("hikes")
+	if len(results) != 2 || results[0].ID != alps.ID || results[0].Rank <= results[1].Rank {
+		t.Fatalf("search = %+v", results)
+	}
+	if !strings.Contains(results[0].Snippet, "<mark>Hiking</mark>") {
+		t.Errorf("snippet = %q", results[0].Snippet)
+	}
+
+	// The text around the marks is escaped.
+	_, err = c.CreateVideo(ctx, CreateVideoParams{Title: "<script>alert(1)</script> hiking", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := search("alert"); len(results) != 1 || results[0].Snippet != "&lt;script&gt;<mark>alert</mark>(1)&lt;/script&gt; hiking" {
+		t.Errorf("search = %+v", results)
+	}
+
+	// Migrate rebuilds an index that has fallen out of step with the videos.
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM videos_fts"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if results := search("alps"); len(results) != 1 || results[0].ID != alps.ID {
+		t.Errorf("search after rebuilding the index = %+v", results)
+	}
+}
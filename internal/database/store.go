@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoStore holds videos and what belongs to them: versions, subtitle tracks,
+// tags and chapters.
+type VideoStore interface {
+	GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	ListVideos(ctx context.Context, params ListVideosParams) (VideoPage, error)
+	SearchVideos(ctx context.Context, params SearchVideosParams) ([]VideoSearchResult, error)
+	GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	GetVideosTrashedBefore(ctx context.Context, cutoff time.Time) ([]Video, error)
+	TrashVideo(ctx context.Context, id uuid.UUID) error
+	RestoreVideo(ctx context.Context, id uuid.UUID) error
+	CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error)
+	GetVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	UpdateVideo(ctx context.Context, video Video) error
+	UpdateVideoMetadata(ctx context.Context, params UpdateVideoMetadataParams) (Video, error)
+	DeleteVideo(ctx context.Context, id uuid.UUID) error
+	PurgeTrashedVideo(ctx context.Context, id uuid.UUID, cutoff time.Time) (Video, []VideoVersion, error)
+
+	GetVideoVersions(ctx context.Context, videoID uuid.UUID) ([]VideoVersion, error)
+	GetVideoVersion(ctx context.Context, id uuid.UUID) (VideoVersion, error)
+	GetVideoURLs(ctx context.Context) ([]string, error)
+	CreateVideoVersion(ctx context.Context, params CreateVideoVersionParams) (VideoVersion, error)
+	UpdateVideoVersion(ctx context.Context, version VideoVersion) error
+
+	GetSubtitleTracks(ctx context.Context, videoID uuid.UUID) ([]SubtitleTrack, error)
+	CreateSubtitleTrack(ctx context.Context, params CreateSubtitleTrackParams) (SubtitleTrack, error)
+	GetSubtitleTrack(ctx context.Context, id uuid.UUID) (SubtitleTrack, error)
+	DeleteSubtitleTrack(ctx context.Context, id uuid.UUID) error
+
+	GetVideoTags(ctx context.Context, videoID uuid.UUID) ([]string, error)
+	AddVideoTags(ctx context.Context, videoID uuid.UUID, names []string) ([]string, error)
+	RemoveVideoTag(ctx context.Context, videoID uuid.UUID, name string) error
+	GetUserTags(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]TagCount, error)
+
+	GetChapters(ctx context.Context, videoID uuid.UUID) ([]Chapter, error)
+	ReplaceChapters(ctx context.Context, videoID uuid.UUID, params []CreateChapterParams) ([]Chapter, error)
+	DeleteChapter(ctx context.Context, id uuid.UUID) error
+}
+
+// UserStore holds users along with their storage usage, quota overrides and
+// watermark.
+type UserStore interface {
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByRefreshToken(ctx context.Context, token string) (*User, error)
+	CreateUser(ctx context.Context, params CreateUserParams) (*User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+
+	GetUserUsage(ctx context.Context, userID uuid.UUID) (UserUsage, error)
+	GetUserQuota(ctx context.Context, userID uuid.UUID) (UserQuota, error)
+	GetEffectiveQuota(ctx context.Context, userID uuid.UUID) (Quota, error)
+	GetRemainingBytes(ctx context.Context, userID uuid.UUID) (int64, error)
+	SetUserQuota(ctx context.Context, params SetUserQuotaParams) (UserQuota, error)
+
+	UpsertWatermark(ctx context.Context, params UpsertWatermarkParams) (Watermark, error)
+	GetWatermark(ctx context.Context, userID uuid.UUID) (Watermark, error)
+	DeleteWatermark(ctx context.Context, userID uuid.UUID) error
+}
+
+// PlaylistStore holds playlists and their ordered entries.
+type PlaylistStore interface {
+	CreatePlaylist(ctx context.Context, params CreatePlaylistParams) (Playlist, error)
+	GetPlaylist(ctx context.Context, id uuid.UUID) (Playlist, error)
+	GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error)
+	UpdatePlaylist(ctx context.Context, playlist Playlist) error
+	DeletePlaylist(ctx context.Context, id uuid.UUID) error
+
+	GetPlaylistEntries(ctx context.Context, playlistID uuid.UUID) ([]PlaylistEntry, error)
+	GetVideoPlaylistEntries(ctx context.Context, videoID uuid.UUID) ([]PlaylistEntry, error)
+	AddPlaylistEntry(ctx context.Context, params AddPlaylistEntryParams) (PlaylistEntry, error)
+	MovePlaylistEntry(ctx context.Context, playlistID, entryID uuid.UUID, position int) error
+	RemovePlaylistEntry(ctx context.Context, playlistID, entryID uuid.UUID) error
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	RotateRefreshToken(ctx context.Context, token string, params CreateRefreshTokenParams) (RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	DeleteRefreshToken(ctx context.Context, token string) error
+
+	GetSessions(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+// BlobStore reference-counts the deduplicated objects in the bucket.
+type BlobStore interface {
+	GetBlob(ctx context.Context, hash string) (Blob, error)
+	GetBlobs(ctx context.Context) ([]Blob, error)
+	AddBlobReference(ctx context.Context, params CreateBlobParams) (Blob, bool, error)
+	ReleaseBlob(ctx context.Context, objectKey string, deleteObject func(ctx context.Context, key string) error) (int, error)
+}
+
+// Store is everything the API persists. Client implements it on SQL
+// databases and MemoryStore in memory.
+type Store interface {
+	VideoStore
+	PlaylistStore
+	UserStore
+	RefreshTokenStore
+	BlobStore
+	Reset(ctx context.Context) error
+	// WithTx runs fn atomically: if it returns an error, nothing it did
+	// through tx is kept.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+var (
+	_ Store = Client{}
+	_ Store = (*MemoryStore)(nil)
+)
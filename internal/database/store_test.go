@@ -0,0 +1,1333 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// forEachStore runs test against every Store implementation, each starting
+// out empty, so they are held to the same behavior. The Client runs on SQLite
+// and, when TEST_POSTGRES_URL is set, PostgreSQL, so these cases are also the
+// database integration tests.
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+	forEachBackend(t, func(t *testing.T, c Client) {
+		test(t, c)
+	})
+}
+
+func createTestUser(t *testing.T, s Store, email string) *User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("unable to create user: %v", err)
+	}
+	return user
+}
+
+func TestUsersAndRefreshTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		user := createTestUser(t, s, "a@example.com")
+
+		byEmail, err := s.GetUserByEmail(context.Background(), "a@example.com")
+		if err != nil || byEmail.ID != user.ID {
+			t.Fatalf("GetUserByEmail = %+v, %v", byEmail, err)
+		}
+		missing, err := s.GetUserByEmail(context.Background(), "nobody@example.com")
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %+v, %v", missing, err)
+		}
+
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		_, err = s.CreateRefreshToken(context.Background(), CreateRefreshTokenParams{Token: "token", UserID: user.ID, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		owner, err := s.GetUserByRefreshToken(context.Background(), "token")
+		if err != nil || owner == nil || owner.ID != user.ID {
+			t.Fatalf("GetUserByRefreshToken = %+v, %v", owner, err)
+		}
+
+		err = s.RevokeRefreshToken(context.Background(), "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := s.GetRefreshToken(context.Background(), "token")
+		if err != nil || token.RevokedAt == nil {
+			t.Fatalf("token wasn't revoked: %+v, %v", token, err)
+		}
+		if !token.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("expires_at is %v, expected %v", token.ExpiresAt, expiresAt)
+		}
+	})
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+		expiresAt := time.Now().Add(time.Hour)
+
+		first, err := s.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "first", UserID: user.ID, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := s.RotateRefreshToken(ctx, "first", CreateRefreshTokenParams{Token: "second", ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.UserID != user.ID || second.FamilyID != first.FamilyID || first.FamilyID == uuid.Nil {
+			t.Errorf("rotated token = %+v, want user %s and family %s", second, user.ID, first.FamilyID)
+		}
+		if _, err := s.GetUserByRefreshToken(ctx, "first"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("replaced token still works: %v", err)
+		}
+		if owner, err := s.GetUserByRefreshToken(ctx, "second"); err != nil || owner.ID != user.ID {
+			t.Errorf("GetUserByRefreshToken = %+v, %v", owner, err)
+		}
+
+		other, err := s.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "other login", UserID: user.ID, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other.FamilyID == first.FamilyID {
+			t.Error("a new login joined an existing family")
+		}
+
+		if _, err := s.RotateRefreshToken(ctx, "first", CreateRefreshTokenParams{Token: "stolen", ExpiresAt: expiresAt}); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("reusing a replaced token = %v", err)
+		}
+		if rt, err := s.GetRefreshToken(ctx, "second"); err != nil || rt.RevokedAt == nil {
+			t.Errorf("token wasn't revoked with its family: %+v, %v", rt, err)
+		}
+		if rt, err := s.GetRefreshToken(ctx, "other login"); err != nil || rt.RevokedAt != nil {
+			t.Errorf("another family was revoked: %+v, %v", rt, err)
+		}
+		if _, err := s.GetRefreshToken(ctx, "stolen"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("reuse issued a new token: %v", err)
+		}
+		if _, err := s.RotateRefreshToken(ctx, "second", CreateRefreshTokenParams{Token: "third", ExpiresAt: expiresAt}); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Errorf("rotating a token revoked with its family = %v", err)
+		}
+
+		_, err = s.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "expired", UserID: user.ID, ExpiresAt: time.Now().Add(-time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.RotateRefreshToken(ctx, "expired", CreateRefreshTokenParams{Token: "fourth", ExpiresAt: expiresAt}); !errors.Is(err, ErrRefreshTokenExpired) {
+			t.Errorf("rotating an expired token = %v", err)
+		}
+		if _, err := s.GetUserByRefreshToken(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expired token still works: %v", err)
+		}
+		if _, err := s.RotateRefreshToken(ctx, "missing", CreateRefreshTokenParams{Token: "fifth", ExpiresAt: expiresAt}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("rotating a missing token = %v", err)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+		other := createTestUser(t, s, "b@example.com")
+		expiresAt := time.Now().Add(time.Hour)
+
+		login := func(userID uuid.UUID, token, userAgent string) RefreshToken {
+			t.Helper()
+			rt, err := s.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: token, UserID: userID, ExpiresAt: expiresAt, UserAgent: userAgent, IPAddress: "192.0.2.1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return rt
+		}
+		laptop := login(user.ID, "laptop", "Firefox")
+		phone := login(user.ID, "phone", "Safari")
+		login(other.ID, "theirs", "Chrome")
+		_, err := s.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "expired", UserID: user.ID, ExpiresAt: time.Now().Add(-time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotated, err := s.RotateRefreshToken(ctx, "laptop", CreateRefreshTokenParams{Token: "laptop 2", ExpiresAt: expiresAt, UserAgent: "Firefox 2", IPAddress: "192.0.2.2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := s.GetSessions(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 2 {
+			t.Fatalf("GetSessions = %+v", sessions)
+		}
+		for _, session := range sessions {
+			switch session.ID {
+			case laptop.FamilyID:
+				if session.UserAgent != "Firefox 2" || session.IPAddress != "192.0.2.2" || !session.CreatedAt.Equal(laptop.CreatedAt) || session.LastUsedAt.Before(rotated.CreatedAt) {
+					t.Errorf("rotated session = %+v", session)
+				}
+			case phone.FamilyID:
+				if session.UserAgent != "Safari" || session.IPAddress != "192.0.2.1" {
+					t.Errorf("phone session = %+v", session)
+				}
+			default:
+				t.Errorf("unexpected session %+v", session)
+			}
+		}
+
+		if err := s.RevokeSession(ctx, other.ID, phone.FamilyID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revoking someone else's session = %v", err)
+		}
+		if err := s.RevokeSession(ctx, user.ID, phone.FamilyID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RevokeSession(ctx, user.ID, phone.FamilyID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revoking a session twice = %v", err)
+		}
+		if _, err := s.GetUserByRefreshToken(ctx, "phone"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revoked session's token still works: %v", err)
+		}
+
+		revoked, err := s.RevokeUserRefreshTokens(ctx, user.ID)
+		if err != nil || revoked != 2 {
+			t.Errorf("RevokeUserRefreshTokens = %d, %v", revoked, err)
+		}
+		if sessions, err := s.GetSessions(ctx, user.ID); err != nil || len(sessions) != 0 {
+			t.Errorf("sessions after logging out everywhere = %+v, %v", sessions, err)
+		}
+		if sessions, err := s.GetSessions(ctx, other.ID); err != nil || len(sessions) != 1 {
+			t.Errorf("other user's sessions = %+v, %v", sessions, err)
+		}
+	})
+}
+
+// CURRENT_TIMESTAMP only has second precision on SQLite, so the login is
+// backdated an hour to see the refresh move last_used_at forward.
+func TestSessionLastUsedAt(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		user := createTestUser(t, c, "a@example.com")
+		_, err := c.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "laptop", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		loggedInAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+		_, err = c.db.ExecContext(ctx, "UPDATE refresh_tokens SET created_at = ?, updated_at = ?, last_used_at = ?", c.db.dialect.timestamp(loggedInAt), c.db.dialect.timestamp(loggedInAt), c.db.dialect.timestamp(loggedInAt))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := c.RotateRefreshToken(ctx, "laptop", CreateRefreshTokenParams{Token: "laptop 2", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+		used, err := c.GetRefreshToken(ctx, "laptop")
+		if err != nil || !used.LastUsedAt.After(loggedInAt) {
+			t.Errorf("rotated token = %+v, %v", used, err)
+		}
+		sessions, err := c.GetSessions(ctx, user.ID)
+		if err != nil || len(sessions) != 1 || !sessions[0].CreatedAt.Equal(loggedInAt) || !sessions[0].LastUsedAt.After(loggedInAt) {
+			t.Errorf("GetSessions = %+v, %v", sessions, err)
+		}
+	})
+}
+
+func TestVideoLifecycle(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		user := createTestUser(t, s, "a@example.com")
+
+		video, err := s.CreateVideo(context.Background(), CreateVideoParams{Title: "Boots", Description: "A video", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(video.CreatedAt).Abs() > time.Minute {
+			t.Errorf("created_at %v is not the current UTC time", video.CreatedAt)
+		}
+
+		videoURL := "https://cdn.example.com/landscape/a.mp4"
+		duration := 12.5
+		version, err := s.CreateVideoVersion(context.Background(), CreateVideoVersionParams{
+			VideoID:     video.ID,
+			UploadedBy:  user.ID,
+			Source:      VideoVersionSourceUpload,
+			VideoURL:    videoURL,
+			Duration:    &duration,
+			StoredBytes: 3 << 30,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		video.VideoURL = &videoURL
+		video.Duration = &duration
+		video.CurrentVersionID = &version.ID
+		video.VideoBytes = 3 << 30
+		err = s.UpdateVideo(context.Background(), video)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		usage, err := s.GetUserUsage(context.Background(), user.ID)
+		if err != nil || usage.BytesUsed != 3<<30 || usage.VideoCount != 1 {
+			t.Fatalf("unexpected usage %+v, %v", usage, err)
+		}
+
+		trimmedURL := "https://cdn.example.com/landscape/b.mp4"
+		second, err := s.CreateVideoVersion(context.Background(), CreateVideoVersionParams{VideoID: video.ID, UploadedBy: user.ID, Source: VideoVersionSourceTrim, VideoURL: trimmedURL})
+		if err != nil || second.Version != 2 {
+			t.Fatalf("second version = %+v, %v", second, err)
+		}
+		versions, err := s.GetVideoVersions(context.Background(), video.ID)
+		if err != nil || len(versions) != 2 || versions[0].Version != 2 {
+			t.Fatalf("unexpected versions %+v, %v", versions, err)
+		}
+
+		// The current URL is also the first version's, and is listed once.
+		videoURLs, err := s.GetVideoURLs(context.Background())
+		if err != nil || !slices.Equal(videoURLs, []string{videoURL, trimmedURL}) {
+			t.Fatalf("GetVideoURLs = %v, %v", videoURLs, err)
+		}
+
+		_, err = s.CreateSubtitleTrack(context.Background(), CreateSubtitleTrackParams{VideoID: video.ID, Language: "en", Label: "English", URL: "https://example.com/en.vtt", FilePath: "en.vtt"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.ReplaceChapters(context.Background(), video.ID, []CreateChapterParams{{Title: "Intro", StartSeconds: 0, Source: "manual"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetVideo(context.Background(), video.ID)
+		if err != nil || got.Duration == nil || *got.Duration != duration || len(got.Subtitles) != 1 {
+			t.Fatalf("unexpected video %+v, %v", got, err)
+		}
+
+		err = s.TrashVideo(context.Background(), video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		videos, err := s.GetVideos(context.Background(), user.ID)
+		if err != nil || len(videos) != 0 {
+			t.Fatalf("trashed video is still listed: %+v, %v", videos, err)
+		}
+		due, err := s.GetVideosTrashedBefore(context.Background(), time.Now().Add(time.Minute))
+		if err != nil || len(due) != 1 {
+			t.Fatalf("trashed video isn't due for purging: %+v, %v", due, err)
+		}
+		due, err = s.GetVideosTrashedBefore(context.Background(), time.Now().Add(-time.Hour))
+		if err != nil || len(due) != 0 {
+			t.Fatalf("trashed video is due too early: %+v, %v", due, err)
+		}
+
+		if videoURLs, err := s.GetVideoURLs(context.Background()); err != nil || len(videoURLs) != 2 {
+			t.Fatalf("trashed video's URLs = %v, %v", videoURLs, err)
+		}
+
+		if _, _, err := s.PurgeTrashedVideo(context.Background(), video.ID, time.Now().Add(-time.Hour)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("purging a video trashed after the cutoff = %v", err)
+		}
+
+		// A video restored after it was listed for purging stays.
+		err = s.RestoreVideo(context.Background(), video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.PurgeTrashedVideo(context.Background(), video.ID, time.Now().Add(time.Minute)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("purging a restored video = %v", err)
+		}
+		if _, err := s.GetVideo(context.Background(), video.ID); err != nil {
+			t.Fatalf("restored video was purged: %v", err)
+		}
+
+		err = s.TrashVideo(context.Background(), video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		purged, versions, err := s.PurgeTrashedVideo(context.Background(), video.ID, time.Now().Add(time.Minute))
+		if err != nil || purged.ID != video.ID || len(purged.Subtitles) != 1 || len(versions) != 2 {
+			t.Fatalf("PurgeTrashedVideo = %+v, %+v, %v", purged, versions, err)
+		}
+		if _, err := s.GetVideo(context.Background(), video.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("purged video is still there: %v", err)
+		}
+		if videoURLs, err := s.GetVideoURLs(context.Background()); err != nil || len(videoURLs) != 0 {
+			t.Fatalf("purged video's URLs = %v, %v", videoURLs, err)
+		}
+		err = s.DeleteVideo(context.Background(), video.ID)
+		if err != nil {
+			t.Fatalf("deleting a missing video = %v", err)
+		}
+		usage, err = s.GetUserUsage(context.Background(), user.ID)
+		if err != nil || usage.BytesUsed != 0 || usage.VideoCount != 0 {
+			t.Fatalf("usage wasn't given back: %+v, %v", usage, err)
+		}
+	})
+}
+
+func TestBlobReferences(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		deleted := []string{}
+		deleteObject := func(ctx context.Context, key string) error {
+			deleted = append(deleted, key)
+			return nil
+		}
+
+		params := CreateBlobParams{Hash: "abc", ObjectKey: "landscape/abc.mp4", Size: 5 << 30}
+		blob, created, err := s.AddBlobReference(ctx, params)
+		if err != nil || !created || blob.RefCount != 1 || blob.Size != 5<<30 {
+			t.Fatalf("AddBlobReference = %+v, %v, %v", blob, created, err)
+		}
+		// The same content under another prefix shares the first object.
+		blob, created, err = s.AddBlobReference(ctx, CreateBlobParams{Hash: "abc", ObjectKey: "source/abc.mp4", Size: 5 << 30})
+		if err != nil || created || blob.RefCount != 2 || blob.ObjectKey != "landscape/abc.mp4" {
+			t.Fatalf("AddBlobReference = %+v, %v, %v", blob, created, err)
+		}
+
+		for want := 1; want >= 0; want-- {
+			left, err := s.ReleaseBlob(ctx, "landscape/abc.mp4", deleteObject)
+			if err != nil || left != want {
+				t.Fatalf("ReleaseBlob = %d, %v; expected %d", left, err, want)
+			}
+			if want > 0 && len(deleted) != 0 {
+				t.Fatalf("object deleted with %d references left", want)
+			}
+		}
+		if len(deleted) != 1 || deleted[0] != "landscape/abc.mp4" {
+			t.Errorf("deleted = %v", deleted)
+		}
+		blob, err = s.GetBlob(ctx, "abc")
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("blob wasn't removed: %+v, %v", blob, err)
+		}
+
+		// The row goes even if the object can't be deleted.
+		_, _, err = s.AddBlobReference(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		failure := errors.New("bucket unavailable")
+		_, err = s.ReleaseBlob(ctx, params.ObjectKey, func(ctx context.Context, key string) error {
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Errorf("ReleaseBlob = %v", err)
+		}
+		if _, err := s.GetBlob(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("blob wasn't removed after a failed delete: %v", err)
+		}
+		blob, created, err = s.AddBlobReference(ctx, params)
+		if err != nil || !created || blob.RefCount != 1 {
+			t.Errorf("AddBlobReference after release = %+v, %v, %v", blob, created, err)
+		}
+	})
+}
+
+func TestQuotasAndWatermarks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		user := createTestUser(t, s, "a@example.com")
+
+		maxBytes := int64(50 << 30)
+		_, err := s.SetUserQuota(context.Background(), SetUserQuotaParams{UserID: user.ID, MaxBytes: &maxBytes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		quota, err := s.GetUserQuota(context.Background(), user.ID)
+		if err != nil || quota.MaxBytes == nil || *quota.MaxBytes != maxBytes || quota.MaxVideos != nil {
+			t.Fatalf("unexpected quota %+v, %v", quota, err)
+		}
+
+		_, err = s.UpsertWatermark(context.Background(), UpsertWatermarkParams{UserID: user.ID, ImageURL: "/assets/w.png", FilePath: "w.png", Position: "top-left", Opacity: 0.5, Scale: 0.2, Enabled: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		watermark, err := s.GetWatermark(context.Background(), user.ID)
+		if err != nil || !watermark.Enabled || watermark.RetainSource || watermark.Opacity != 0.5 {
+			t.Fatalf("unexpected watermark %+v, %v", watermark, err)
+		}
+
+		err = s.Reset(context.Background())
+		if err != nil {
+			t.Fatalf("unable to reset: %v", err)
+		}
+	})
+}
+
+func TestMissingRows(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		id := uuid.New()
+
+		lookups := map[string]func() error{
+			"GetUser": func() error {
+				_, err := s.GetUser(ctx, id)
+				return err
+			},
+			"GetUserByRefreshToken": func() error {
+				_, err := s.GetUserByRefreshToken(ctx, "missing")
+				return err
+			},
+			"GetRefreshToken": func() error {
+				_, err := s.GetRefreshToken(ctx, "missing")
+				return err
+			},
+			"RevokeRefreshToken": func() error {
+				return s.RevokeRefreshToken(ctx, "missing")
+			},
+			"GetVideo": func() error {
+				_, err := s.GetVideo(ctx, id)
+				return err
+			},
+			"UpdateVideo": func() error {
+				return s.UpdateVideo(ctx, Video{ID: id})
+			},
+			"TrashVideo": func() error {
+				return s.TrashVideo(ctx, id)
+			},
+			"RestoreVideo": func() error {
+				return s.RestoreVideo(ctx, id)
+			},
+			"GetVideoVersion": func() error {
+				_, err := s.GetVideoVersion(ctx, id)
+				return err
+			},
+			"UpdateVideoVersion": func() error {
+				return s.UpdateVideoVersion(ctx, VideoVersion{ID: id})
+			},
+			"GetSubtitleTrack": func() error {
+				_, err := s.GetSubtitleTrack(ctx, id)
+				return err
+			},
+			"GetWatermark": func() error {
+				_, err := s.GetWatermark(ctx, id)
+				return err
+			},
+			"GetUserQuota": func() error {
+				_, err := s.GetUserQuota(ctx, id)
+				return err
+			},
+			"GetBlob": func() error {
+				_, err := s.GetBlob(ctx, "missing")
+				return err
+			},
+		}
+		for name, lookup := range lookups {
+			if err := lookup(); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: expected ErrNotFound, got %v", name, err)
+			}
+		}
+
+		// Usage defaults to nothing used, and deleting what isn't there is a
+		// no-op.
+		if usage, err := s.GetUserUsage(ctx, id); err != nil || usage.UserID != id || usage.VideoCount != 0 {
+			t.Errorf("GetUserUsage = %+v, %v", usage, err)
+		}
+		// Keys with no blob row are deleted from the bucket outright.
+		var deleted []string
+		left, err := s.ReleaseBlob(ctx, "missing", func(ctx context.Context, key string) error {
+			deleted = append(deleted, key)
+			return nil
+		})
+		if err != nil || left != 0 || len(deleted) != 1 {
+			t.Errorf("ReleaseBlob = %d, %v, deleted %v", left, err, deleted)
+		}
+		if err := s.DeleteVideo(ctx, id); err != nil {
+			t.Errorf("DeleteVideo: %v", err)
+		}
+	})
+}
+
+func TestWithTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+		errRollback := errors.New("roll back")
+
+		var videoID uuid.UUID
+		err := s.WithTx(ctx, func(tx Store) error {
+			video, err := tx.CreateVideo(ctx, CreateVideoParams{Title: "Boots", UserID: user.ID})
+			if err != nil {
+				return err
+			}
+			videoID = video.ID
+			_, err = tx.CreateVideoVersion(ctx, CreateVideoVersionParams{VideoID: video.ID, UploadedBy: user.ID, Source: VideoVersionSourceUpload, VideoURL: "u"})
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("WithTx returned %v", err)
+		}
+		if _, err := s.GetVideo(ctx, videoID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("rolled back video still exists: %v", err)
+		}
+		if usage, err := s.GetUserUsage(ctx, user.ID); err != nil || usage.VideoCount != 0 {
+			t.Errorf("rolled back usage = %+v, %v", usage, err)
+		}
+
+		err = s.WithTx(ctx, func(tx Store) error {
+			video, err := tx.CreateVideo(ctx, CreateVideoParams{Title: "Boots", UserID: user.ID})
+			videoID = video.ID
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetVideo(ctx, videoID); err != nil {
+			t.Errorf("committed video is missing: %v", err)
+		}
+	})
+}
+
+func TestCanceledContext(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.CreateUser(ctx, CreateUserParams{Email: "a@example.com", Password: "hash"})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestListVideos(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+		other := createTestUser(t, s, "b@example.com")
+
+		for i, title := range []string{"Delta", "Alpha", "Echo", "Charlie", "Bravo"} {
+			video, err := s.CreateVideo(ctx, CreateVideoParams{Title: title, UserID: user.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i%2 == 1 {
+				continue
+			}
+			aspectRatio := "16:9"
+			if i == 4 {
+				aspectRatio = "9:16"
+			}
+			duration := float64(10 * (i + 1))
+			version, err := s.CreateVideoVersion(ctx, CreateVideoVersionParams{VideoID: video.ID, UploadedBy: user.ID, Source: VideoVersionSourceUpload, VideoURL: "u", Duration: &duration, AspectRatio: aspectRatio})
+			if err != nil {
+				t.Fatal(err)
+			}
+			videoURL := "u"
+			video.VideoURL = &videoURL
+			video.Duration = &duration
+			video.CurrentVersionID = &version.ID
+			if err := s.UpdateVideo(ctx, video); err != nil {
+				t.Fatal(err)
+			}
+		}
+		trashed, err := s.CreateVideo(ctx, CreateVideoParams{Title: "Trashed", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.TrashVideo(ctx, trashed.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.CreateVideo(ctx, CreateVideoParams{Title: "Someone else's", UserID: other.ID}); err != nil {
+			t.Fatal(err)
+		}
+
+		titles := func(videos []Video) []string {
+			titles := []string{}
+			for _, video := range videos {
+				titles = append(titles, video.Title)
+			}
+			return titles
+		}
+		list := func(params ListVideosParams) []string {
+			t.Helper()
+			params.UserID = user.ID
+			if params.Sort == "" {
+				params.Sort = VideoSortTitle
+			}
+			params.Limit = 100
+			page, err := s.ListVideos(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Next != nil {
+				t.Errorf("unexpected next cursor %+v", page.Next)
+			}
+			return titles(page.Videos)
+		}
+
+		for _, test := range []struct {
+			params ListVideosParams
+			want   []string
+		}{
+			{ListVideosParams{}, []string{"Alpha", "Bravo", "Charlie", "Delta", "Echo"}},
+			{ListVideosParams{Descending: true}, []string{"Echo", "Delta", "Charlie", "Bravo", "Alpha"}},
+			{ListVideosParams{Sort: VideoSortDuration, Status: VideoStatusReady}, []string{"Delta", "Echo", "Bravo"}},
+			{ListVideosParams{AspectRatio: "16:9"}, []string{"Delta", "Echo"}},
+			{ListVideosParams{Status: VideoStatusReady}, []string{"Bravo", "Delta", "Echo"}},
+			{ListVideosParams{Status: VideoStatusDraft}, []string{"Alpha", "Charlie"}},
+		} {
+			got := list(test.params)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ListVideos(%+v) = %v, want %v", test.params, got, test.want)
+			}
+		}
+
+		future := time.Now().Add(time.Hour)
+		if got := list(ListVideosParams{CreatedAfter: &future}); len(got) != 0 {
+			t.Errorf("videos created in the future: %v", got)
+		}
+		if got := list(ListVideosParams{CreatedBefore: &future}); len(got) != 5 {
+			t.Errorf("videos created before now: %v", got)
+		}
+
+		// Paging through in twos gives the same order as one big page, for
+		// every sort, even where keys tie.
+		for sort := range videoSortColumns {
+			for _, descending := range []bool{false, true} {
+				params := ListVideosParams{UserID: user.ID, Sort: sort, Descending: descending, Limit: 100}
+				all, err := s.ListVideos(ctx, params)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				params.Limit = 2
+				paged := []Video{}
+				for pages := 0; ; pages++ {
+					if pages > 5 {
+						t.Fatalf("sort %s never ran out of pages", sort)
+					}
+					page, err := s.ListVideos(ctx, params)
+					if err != nil {
+						t.Fatal(err)
+					}
+					paged = append(paged, page.Videos...)
+					if page.Next == nil {
+						break
+					}
+					params.After = page.Next
+				}
+				if !slices.Equal(titles(paged), titles(all.Videos)) {
+					t.Errorf("sort %s desc=%v paged as %v, want %v", sort, descending, titles(paged), titles(all.Videos))
+				}
+			}
+		}
+
+		_, err = s.ListVideos(ctx, ListVideosParams{UserID: user.ID, Sort: VideoSortTitle, Limit: 1, After: &VideoCursor{Sort: VideoSortDuration}})
+		if err == nil {
+			t.Error("expected an error for a cursor from another sort")
+		}
+	})
+}
+
+func TestSearchVideos(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+		other := createTestUser(t, s, "b@example.com")
+
+		create := func(params CreateVideoParams) Video {
+			t.Helper()
+			video, err := s.CreateVideo(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return video
+		}
+		review := create(CreateVideoParams{Title: "Boots review", Description: "Trying on new hiking gear", UserID: user.ID})
+		hike := create(CreateVideoParams{Title: "Weekend hike", Description: "Wore my boots on the trail", UserID: user.ID})
+		unboxing := create(CreateVideoParams{Title: "Boots unboxing", Visibility: VideoVisibilityPublic, UserID: other.ID})
+		create(CreateVideoParams{Title: "Secret boots", UserID: other.ID})
+		create(CreateVideoParams{Title: "Unlisted boots", Visibility: VideoVisibilityUnlisted, UserID: other.ID})
+		trashed := create(CreateVideoParams{Title: "Trashed boots", UserID: user.ID})
+		if err := s.TrashVideo(ctx, trashed.ID); err != nil {
+			t.Fatal(err)
+		}
+		if review.Visibility != VideoVisibilityPrivate {
+			t.Errorf("visibility defaulted to %q", review.Visibility)
+		}
+
+		search := func(query string, ownOnly bool) []VideoSearchResult {
+			t.Helper()
+			results, err := s.SearchVideos(ctx, SearchVideosParams{Query: query, UserID: user.ID, OwnOnly: ownOnly, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, result := range results {
+				if !strings.Contains(result.Snippet, "<mark>") {
+					t.Errorf("snippet %q for %s doesn't highlight anything", result.Snippet, result.Title)
+				}
+			}
+			return results
+		}
+		ids := func(results []VideoSearchResult) []uuid.UUID {
+			ids := []uuid.UUID{}
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			return ids
+		}
+
+		for _, query := range []string{"boots", "BOOTS", "boot", `"boots*`} {
+			results := search(query, false)
+			if len(results) != 3 || results[2].ID != hike.ID {
+				t.Errorf("search %q = %v, want two title matches before %s", query, ids(results), hike.ID)
+			}
+			if !slices.Contains(ids(results), review.ID) || !slices.Contains(ids(results), unboxing.ID) {
+				t.Errorf("search %q = %v, missing a title match", query, ids(results))
+			}
+		}
+		if results := search("boots", true); len(results) != 2 || slices.Contains(ids(results), unboxing.ID) {
+			t.Errorf("own search = %v", ids(results))
+		}
+		if results := search("boots trail", false); len(results) != 1 || results[0].ID != hike.ID {
+			t.Errorf("every term should have to match: %v", ids(results))
+		}
+		if results := search("!!", false); len(results) != 0 {
+			t.Errorf("empty query matched %v", ids(results))
+		}
+
+		// Snippets are HTML, so other users' text is escaped around the marks.
+		create(CreateVideoParams{Title: `<script>alert("xss")</script>`, Description: `<img src=x onerror=alert(1)> sandals`, Visibility: VideoVisibilityPublic, UserID: other.ID})
+		for _, query := range []string{"script", "sandals"} {
+			results := search(query, false)
+			if len(results) != 1 || strings.Contains(results[0].Snippet, "<script") || strings.Contains(results[0].Snippet, "<img") || !strings.Contains(results[0].Snippet, "&lt;") {
+				t.Errorf("search %q = %+v, want an escaped snippet", query, results)
+			}
+		}
+
+		review.Title = "Sandals review"
+		if err := s.UpdateVideo(ctx, review); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeleteVideo(ctx, hike.ID); err != nil {
+			t.Fatal(err)
+		}
+		if results := search("boots", true); len(results) != 0 {
+			t.Errorf("search wasn't updated: %v", ids(results))
+		}
+		if results := search("sandals", true); len(results) != 1 || results[0].ID != review.ID {
+			t.Errorf("search wasn't updated: %v", ids(results))
+		}
+	})
+}
+
+func TestUpdateVideoMetadata(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+		video, err := s.CreateVideo(ctx, CreateVideoParams{Title: "Boots", Description: "Old", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		updated, err := s.UpdateVideoMetadata(ctx, UpdateVideoMetadataParams{
+			ID:          video.ID,
+			Title:       "Hiking boots",
+			Description: "New",
+			Visibility:  VideoVisibilityPublic,
+			IfMatch:     &video,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Title != "Hiking boots" || updated.Description != "New" || updated.Visibility != VideoVisibilityPublic || updated.UpdatedAt.Before(video.UpdatedAt) {
+			t.Errorf("UpdateVideoMetadata = %+v", updated)
+		}
+
+		_, err = s.UpdateVideoMetadata(ctx, UpdateVideoMetadataParams{ID: video.ID, Title: "Lost update", Visibility: VideoVisibilityPrivate, IfMatch: &video})
+		if !errors.Is(err, ErrModified) {
+			t.Errorf("update from a stale read = %v", err)
+		}
+		if got, err := s.GetVideo(ctx, video.ID); err != nil || got.Title != "Hiking boots" {
+			t.Errorf("stale update was saved: %+v, %v", got, err)
+		}
+
+		missing := Video{ID: uuid.New()}
+		if _, err := s.UpdateVideoMetadata(ctx, UpdateVideoMetadataParams{ID: missing.ID, Title: "x", IfMatch: &missing}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("updating a missing video = %v", err)
+		}
+
+		results, err := s.SearchVideos(ctx, SearchVideosParams{Query: "hiking", UserID: user.ID, OwnOnly: true, Limit: 10})
+		if err != nil || len(results) != 1 {
+			t.Errorf("search after update = %v, %v", results, err)
+		}
+	})
+}
+
+func TestTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+		other := createTestUser(t, s, "b@example.com")
+
+		create := func(userID uuid.UUID, title string, tags ...string) Video {
+			t.Helper()
+			video, err := s.CreateVideo(ctx, CreateVideoParams{Title: title, UserID: userID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tags) > 0 {
+				if _, err := s.AddVideoTags(ctx, video.ID, tags); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return video
+		}
+		hike := create(user.ID, "Hike", "Hiking", "outdoors")
+		climb := create(user.ID, "Climb", "climbing", "outdoors")
+		trashed := create(user.ID, "Old hike", "hiking")
+		create(other.ID, "Other hike", "hiking", "hills")
+		if err := s.TrashVideo(ctx, trashed.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		tags, err := s.AddVideoTags(ctx, hike.ID, []string{"  Outdoors ", "mountain   trails"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(tags, []string{"hiking", "mountain trails", "outdoors"}) {
+			t.Errorf("AddVideoTags = %v", tags)
+		}
+		video, err := s.GetVideo(ctx, hike.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(video.Tags, tags) {
+			t.Errorf("GetVideo tags = %v, want %v", video.Tags, tags)
+		}
+		if _, err := s.AddVideoTags(ctx, hike.ID, []string{"a,b"}); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("AddVideoTags with a comma = %v", err)
+		}
+		if _, err := s.AddVideoTags(ctx, uuid.New(), []string{"hiking"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("AddVideoTags on a missing video = %v", err)
+		}
+
+		if err := s.RemoveVideoTag(ctx, hike.ID, "Mountain Trails"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RemoveVideoTag(ctx, hike.ID, "never added"); err != nil {
+			t.Errorf("removing a missing tag = %v", err)
+		}
+		if tags, err := s.GetVideoTags(ctx, hike.ID); err != nil || !slices.Equal(tags, []string{"hiking", "outdoors"}) {
+			t.Errorf("GetVideoTags = %v, %v", tags, err)
+		}
+
+		counts, err := s.GetUserTags(ctx, user.ID, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []TagCount{{"outdoors", 2}, {"climbing", 1}, {"hiking", 1}}
+		if !slices.Equal(counts, want) {
+			t.Errorf("GetUserTags = %v, want %v", counts, want)
+		}
+		if counts, err := s.GetUserTags(ctx, user.ID, "H", 10); err != nil || !slices.Equal(counts, []TagCount{{"hiking", 1}}) {
+			t.Errorf("GetUserTags with prefix = %v, %v", counts, err)
+		}
+		if counts, err := s.GetUserTags(ctx, user.ID, "%", 10); err != nil || len(counts) != 0 {
+			t.Errorf("GetUserTags with a wildcard prefix = %v, %v", counts, err)
+		}
+		if counts, err := s.GetUserTags(ctx, user.ID, "", 1); err != nil || len(counts) != 1 {
+			t.Errorf("GetUserTags with limit = %v, %v", counts, err)
+		}
+
+		list := func(tags []string, all bool) []uuid.UUID {
+			t.Helper()
+			page, err := s.ListVideos(ctx, ListVideosParams{UserID: user.ID, Sort: VideoSortTitle, Tags: tags, MatchAllTags: all, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []uuid.UUID{}
+			for _, video := range page.Videos {
+				ids = append(ids, video.ID)
+			}
+			return ids
+		}
+		if got := list([]string{"hiking", "climbing"}, false); !slices.Equal(got, []uuid.UUID{climb.ID, hike.ID}) {
+			t.Errorf("any tag = %v", got)
+		}
+		if got := list([]string{"hiking", "Outdoors", "outdoors"}, true); !slices.Equal(got, []uuid.UUID{hike.ID}) {
+			t.Errorf("all tags = %v", got)
+		}
+		if got := list([]string{"hills"}, false); len(got) != 0 {
+			t.Errorf("another user's tag = %v", got)
+		}
+
+		if err := s.DeleteVideo(ctx, hike.ID); err != nil {
+			t.Fatal(err)
+		}
+		if counts, err := s.GetUserTags(ctx, user.ID, "hik", 10); err != nil || len(counts) != 0 {
+			t.Errorf("GetUserTags after delete = %v, %v", counts, err)
+		}
+	})
+}
+
+func TestPlaylists(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "a@example.com")
+
+		playlist, err := s.CreatePlaylist(ctx, CreatePlaylistParams{Title: "Go basics", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if playlist.Visibility != VideoVisibilityPrivate {
+			t.Errorf("visibility defaulted to %q", playlist.Visibility)
+		}
+		playlist.Title = "Go fundamentals"
+		playlist.Visibility = VideoVisibilityPublic
+		if err := s.UpdatePlaylist(ctx, playlist); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.GetPlaylist(ctx, playlist.ID); err != nil || got.Title != "Go fundamentals" || got.Visibility != VideoVisibilityPublic {
+			t.Errorf("GetPlaylist = %+v, %v", got, err)
+		}
+		if playlists, err := s.GetPlaylists(ctx, user.ID); err != nil || len(playlists) != 1 {
+			t.Errorf("GetPlaylists = %v, %v", playlists, err)
+		}
+
+		videos := map[string]uuid.UUID{}
+		for _, title := range []string{"a", "b", "c", "d"} {
+			video, err := s.CreateVideo(ctx, CreateVideoParams{Title: title, UserID: user.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			videos[title] = video.ID
+		}
+		entryIDs := map[string]uuid.UUID{}
+		add := func(title string, position *int) {
+			t.Helper()
+			entry, err := s.AddPlaylistEntry(ctx, AddPlaylistEntryParams{PlaylistID: playlist.ID, VideoID: videos[title], Position: position})
+			if err != nil {
+				t.Fatal(err)
+			}
+			entryIDs[title] = entry.ID
+		}
+		order := func() string {
+			t.Helper()
+			entries, err := s.GetPlaylistEntries(ctx, playlist.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			titles := ""
+			for i, entry := range entries {
+				if entry.Position != i {
+					t.Errorf("entry %d has position %d", i, entry.Position)
+				}
+				for title, id := range videos {
+					if id == entry.VideoID {
+						titles += title
+					}
+				}
+			}
+			return titles
+		}
+		position := func(p int) *int { return &p }
+
+		add("a", nil)
+		add("c", nil)
+		add("b", position(1))
+		add("d", position(99))
+		if got := order(); got != "abcd" {
+			t.Errorf("after adding = %q", got)
+		}
+
+		for _, move := range []struct {
+			title    string
+			position int
+			want     string
+		}{
+			{"d", 0, "dabc"},
+			{"d", 2, "abdc"},
+			{"a", 99, "bdca"},
+			{"c", -1, "cbda"},
+			{"c", 0, "cbda"},
+		} {
+			if err := s.MovePlaylistEntry(ctx, playlist.ID, entryIDs[move.title], move.position); err != nil {
+				t.Fatal(err)
+			}
+			if got := order(); got != move.want {
+				t.Errorf("after moving %s to %d = %q, want %q", move.title, move.position, got, move.want)
+			}
+		}
+		if err := s.MovePlaylistEntry(ctx, playlist.ID, uuid.New(), 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("moving a missing entry = %v", err)
+		}
+		if err := s.MovePlaylistEntry(ctx, uuid.New(), entryIDs["a"], 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("moving an entry of another playlist = %v", err)
+		}
+
+		if err := s.RemovePlaylistEntry(ctx, playlist.ID, entryIDs["b"]); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.RemovePlaylistEntry(ctx, playlist.ID, entryIDs["b"]); err != nil {
+			t.Errorf("removing an entry twice = %v", err)
+		}
+		if got := order(); got != "cda" {
+			t.Errorf("after removing = %q", got)
+		}
+		if entries, err := s.GetVideoPlaylistEntries(ctx, videos["d"]); err != nil || len(entries) != 1 || entries[0].ID != entryIDs["d"] || entries[0].Position != 1 {
+			t.Errorf("GetVideoPlaylistEntries = %+v, %v", entries, err)
+		}
+		if entries, err := s.GetVideoPlaylistEntries(ctx, videos["b"]); err != nil || len(entries) != 0 {
+			t.Errorf("GetVideoPlaylistEntries for a removed video = %+v, %v", entries, err)
+		}
+		if err := s.DeleteVideo(ctx, videos["d"]); err != nil {
+			t.Fatal(err)
+		}
+		if got := order(); got != "ca" {
+			t.Errorf("after deleting a video = %q", got)
+		}
+
+		if err := s.DeletePlaylist(ctx, playlist.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetPlaylist(ctx, playlist.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetPlaylist after delete = %v", err)
+		}
+		if entries, err := s.GetPlaylistEntries(ctx, playlist.ID); err != nil || len(entries) != 0 {
+			t.Errorf("entries after delete = %v, %v", entries, err)
+		}
+		if _, err := s.AddPlaylistEntry(ctx, AddPlaylistEntryParams{PlaylistID: playlist.ID, VideoID: videos["a"]}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("adding to a deleted playlist = %v", err)
+		}
+		if err := s.UpdatePlaylist(ctx, playlist); !errors.Is(err, ErrNotFound) {
+			t.Errorf("updating a deleted playlist = %v", err)
+		}
+	})
+}
+
+func TestUniqueConstraints(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		user := createTestUser(t, s, "a@example.com")
+		_, err := s.CreateUser(context.Background(), CreateUserParams{Email: "a@example.com", Password: "hash"})
+		if err == nil {
+			t.Error("expected an error creating a user with a taken email")
+		}
+
+		params := CreateRefreshTokenParams{Token: "token", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+		_, err = s.CreateRefreshToken(context.Background(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.CreateRefreshToken(context.Background(), params)
+		if err == nil {
+			t.Error("expected an error reusing a refresh token")
+		}
+
+		video, err := s.CreateVideo(context.Background(), CreateVideoParams{Title: "Boots", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		track := CreateSubtitleTrackParams{VideoID: video.ID, Language: "en", Label: "English", URL: "u", FilePath: "f"}
+		_, err = s.CreateSubtitleTrack(context.Background(), track)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.CreateSubtitleTrack(context.Background(), track)
+		if err == nil {
+			t.Error("expected an error adding a duplicate subtitle track")
+		}
+
+		_, _, err = s.AddBlobReference(context.Background(), CreateBlobParams{Hash: "a", ObjectKey: "key", Size: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = s.AddBlobReference(context.Background(), CreateBlobParams{Hash: "b", ObjectKey: "key", Size: 1})
+		if err == nil {
+			t.Error("expected an error storing two blobs under one key")
+		}
+	})
+}
+
+func TestOrdering(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		user := createTestUser(t, s, "a@example.com")
+		video, err := s.CreateVideo(context.Background(), CreateVideoParams{Title: "Boots", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, track := range []CreateSubtitleTrackParams{
+			{Language: "fr", Label: "French"},
+			{Language: "en", Label: "SDH"},
+			{Language: "en", Label: "English"},
+		} {
+			track.VideoID = video.ID
+			_, err := s.CreateSubtitleTrack(context.Background(), track)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		tracks, err := s.GetSubtitleTracks(context.Background(), video.ID)
+		if err != nil || len(tracks) != 3 || tracks[0].Label != "English" || tracks[1].Label != "SDH" || tracks[2].Language != "fr" {
+			t.Errorf("subtitle tracks out of order: %+v, %v", tracks, err)
+		}
+
+		chapters, err := s.ReplaceChapters(context.Background(), video.ID, []CreateChapterParams{
+			{Title: "End", StartSeconds: 90, Source: ChapterSourceManual},
+			{Title: "Intro", StartSeconds: 0, Source: ChapterSourceManual},
+		})
+		if err != nil || len(chapters) != 2 || chapters[0].Title != "Intro" {
+			t.Errorf("chapters out of order: %+v, %v", chapters, err)
+		}
+		chapters, err = s.ReplaceChapters(context.Background(), video.ID, []CreateChapterParams{{Title: "Only", Source: ChapterSourceSuggested}})
+		if err != nil || len(chapters) != 1 {
+			t.Errorf("chapters weren't replaced: %+v, %v", chapters, err)
+		}
+
+		users, err := s.GetUsers(context.Background())
+		if err != nil || len(users) != 1 || users[0].Email != "a@example.com" || !users[0].CreatedAt.IsZero() {
+			t.Errorf("GetUsers = %+v, %v", users, err)
+		}
+	})
+}
+
+func TestUsageFollowsOwner(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		alice := createTestUser(t, s, "alice@example.com")
+		bob := createTestUser(t, s, "bob@example.com")
+
+		video, err := s.CreateVideo(context.Background(), CreateVideoParams{Title: "Boots", UserID: alice.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		video.VideoBytes = 100
+		video.ThumbnailBytes = 10
+		err = s.UpdateVideo(context.Background(), video)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		video.UserID = bob.ID
+		err = s.UpdateVideo(context.Background(), video)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		aliceUsage, err := s.GetUserUsage(context.Background(), alice.ID)
+		if err != nil || aliceUsage.BytesUsed != 0 || aliceUsage.VideoCount != 0 {
+			t.Errorf("alice's usage = %+v, %v", aliceUsage, err)
+		}
+		bobUsage, err := s.GetUserUsage(context.Background(), bob.ID)
+		if err != nil || bobUsage.BytesUsed != 110 || bobUsage.VideoCount != 1 {
+			t.Errorf("bob's usage = %+v, %v", bobUsage, err)
+		}
+
+		got, err := s.GetVideo(context.Background(), video.ID)
+		if err != nil || got.Subtitles == nil || got.UpdatedAt.Before(got.CreatedAt) {
+			t.Errorf("unexpected video after update %+v, %v", got, err)
+		}
+	})
+}
+
+func TestQuotaEnforcement(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		quota := Quota{MaxBytes: 100, MaxVideos: 2}
+		switch store := s.(type) {
+		case *MemoryStore:
+			s = store.WithDefaultQuota(quota)
+		case Client:
+			s = store.WithDefaultQuota(quota)
+		}
+		user := createTestUser(t, s, "a@example.com")
+
+		first, err := s.CreateVideo(ctx, CreateVideoParams{Title: "One", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := s.CreateVideo(ctx, CreateVideoParams{Title: "Two", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.CreateVideo(ctx, CreateVideoParams{Title: "Three", UserID: user.ID})
+		if !errors.Is(err, ErrVideoQuotaExceeded) {
+			t.Fatalf("third video: expected ErrVideoQuotaExceeded, got %v", err)
+		}
+		videos, err := s.GetVideos(ctx, user.ID)
+		if err != nil || len(videos) != 2 {
+			t.Fatalf("the rejected video was kept: %d videos, %v", len(videos), err)
+		}
+
+		first.VideoBytes = 60
+		err = s.UpdateVideo(ctx, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second.VideoBytes = 50
+		err = s.UpdateVideo(ctx, second)
+		if !errors.Is(err, ErrStorageQuotaExceeded) {
+			t.Fatalf("expected ErrStorageQuotaExceeded, got %v", err)
+		}
+		got, err := s.GetVideo(ctx, second.ID)
+		if err != nil || got.VideoBytes != 0 {
+			t.Errorf("the rejected update was kept: %+v, %v", got, err)
+		}
+		usage, err := s.GetUserUsage(ctx, user.ID)
+		if err != nil || usage.BytesUsed != 60 || usage.VideoCount != 2 {
+			t.Errorf("usage = %+v, %v", usage, err)
+		}
+		if got, err := s.GetEffectiveQuota(ctx, user.ID); err != nil || got != quota {
+			t.Errorf("GetEffectiveQuota = %+v, %v", got, err)
+		}
+		if remaining, err := s.GetRemainingBytes(ctx, user.ID); err != nil || remaining != 40 {
+			t.Errorf("GetRemainingBytes = %d, %v", remaining, err)
+		}
+
+		// Freeing space is always allowed, even over a lowered limit.
+		maxBytes := int64(10)
+		_, err = s.SetUserQuota(ctx, SetUserQuotaParams{UserID: user.ID, MaxBytes: &maxBytes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.GetEffectiveQuota(ctx, user.ID); err != nil || got.MaxBytes != 10 || got.MaxVideos != 2 {
+			t.Errorf("GetEffectiveQuota with an override = %+v, %v", got, err)
+		}
+		if remaining, err := s.GetRemainingBytes(ctx, user.ID); err != nil || remaining != 0 {
+			t.Errorf("GetRemainingBytes over the limit = %d, %v", remaining, err)
+		}
+		first.VideoBytes = 30
+		err = s.UpdateVideo(ctx, first)
+		if err != nil {
+			t.Fatalf("shrinking a video over quota: %v", err)
+		}
+
+		// An override of zero lifts the limit.
+		unlimited := int64(0)
+		_, err = s.SetUserQuota(ctx, SetUserQuotaParams{UserID: user.ID, MaxBytes: &unlimited})
+		if err != nil {
+			t.Fatal(err)
+		}
+		second.VideoBytes = 1 << 40
+		err = s.UpdateVideo(ctx, second)
+		if err != nil {
+			t.Fatalf("update with unlimited bytes: %v", err)
+		}
+		if remaining, err := s.GetRemainingBytes(ctx, user.ID); err != nil || remaining != -1 {
+			t.Errorf("GetRemainingBytes without a limit = %d, %v", remaining, err)
+		}
+		usage, err = s.GetUserUsage(ctx, user.ID)
+		if err != nil || usage.BytesUsed != 30+1<<40 {
+			t.Errorf("usage = %+v, %v", usage, err)
+		}
+
+		// Deleting a video makes room for another.
+		err = s.DeleteVideo(ctx, first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.CreateVideo(ctx, CreateVideoParams{Title: "Three", UserID: user.ID})
+		if err != nil {
+			t.Errorf("creating a video after deleting one: %v", err)
+		}
+	})
+}
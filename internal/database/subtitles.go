@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SubtitleTrack struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreateSubtitleTrackParams
+}
+
+type CreateSubtitleTrackParams struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	Language string    `json:"language"`
+	Label    string    `json:"label"`
+	URL      string    `json:"url"`
+	FilePath string    `json:"-"`
+}
+
+func (c Client) GetSubtitleTracks(ctx context.Context, videoID uuid.UUID) ([]SubtitleTrack, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		language,
+		label,
+		url,
+		file_path
+	FROM subtitle_tracks
+	WHERE video_id = ?
+	ORDER BY language, label
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tracks := []SubtitleTrack{}
+	for rows.Next() {
+		var track SubtitleTrack
+		if err := rows.Scan(
+			&track.ID,
+			&track.CreatedAt,
+			&track.UpdatedAt,
+			&track.VideoID,
+			&track.Language,
+			&track.Label,
+			&track.URL,
+			&track.FilePath,
+		); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+
+	return tracks, rows.Err()
+}
+
+func (c Client) CreateSubtitleTrack(ctx context.Context, params CreateSubtitleTrackParams) (SubtitleTrack, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO subtitle_tracks (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		language,
+		label,
+		url,
+		file_path
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query, id, params.VideoID, params.Language, params.Label, params.URL, params.FilePath)
+	if err != nil {
+		return SubtitleTrack{}, err
+	}
+
+	return c.GetSubtitleTrack(ctx, id)
+}
+
+func (c Client) GetSubtitleTrack(ctx context.Context, id uuid.UUID) (SubtitleTrack, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		language,
+		label,
+		url,
+		file_path
+	FROM subtitle_tracks
+	WHERE id = ?
+	`
+
+	var track SubtitleTrack
+	err := c.db.QueryRowContext(ctx, query, id).Scan(
+		&track.ID,
+		&track.CreatedAt,
+		&track.UpdatedAt,
+		&track.VideoID,
+		&track.Language,
+		&track.Label,
+		&track.URL,
+		&track.FilePath,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SubtitleTrack{}, ErrNotFound
+		}
+		return SubtitleTrack{}, err
+	}
+
+	return track, nil
+}
+
+func (c Client) DeleteSubtitleTrack(ctx context.Context, id uuid.UUID) error {
+	query := `
+	DELETE FROM subtitle_tracks
+	WHERE id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (c Client) attachSubtitleTracks(ctx context.Context, video *Video) error {
+	tracks, err := c.GetSubtitleTracks(ctx, video.ID)
+	if err != nil {
+		return err
+	}
+	video.Subtitles = tracks
+	return nil
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// TagCount is one of a user's tags and how many of their videos outside the
+// trash carry it.
+type TagCount struct {
+	Name       string `json:"name"`
+	VideoCount int    `json:"video_count"`
+}
+
+const maxTagLength = 50
+
+var ErrInvalidTag = errors.New("invalid tag")
+
+// NormalizeTag lowercases a tag and collapses its whitespace, so "Hiking "
+// and "hiking" are the same tag.
+func NormalizeTag(name string) (string, error) {
+	name = strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if name == "" {
+		return "", fmt.Errorf("%w: tags can't be empty", ErrInvalidTag)
+	}
+	if utf8.RuneCountInString(name) > maxTagLength {
+		return "", fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidTag, name, maxTagLength)
+	}
+	if strings.Contains(name, ",") {
+		return "", fmt.Errorf("%w: %q contains a comma", ErrInvalidTag, name)
+	}
+	return name, nil
+}
+
+func normalizeTags(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// GetVideoTags returns the names of the video's tags in alphabetical order.
+func (c Client) GetVideoTags(ctx context.Context, videoID uuid.UUID) ([]string, error) {
+	query := `
+	SELECT tags.name
+	FROM video_tags
+	JOIN tags ON tags.id = video_tags.tag_id
+	WHERE video_tags.video_id = ?
+	ORDER BY tags.name
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// AddVideoTags tags a video, creating any of the owner's tags that don't exist
+// yet, and returns all of the video's tags. Tags it already has are left as
+// they are.
+func (c Client) AddVideoTags(ctx context.Context, videoID uuid.UUID, names []string) ([]string, error) {
+	names, err := normalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	err = c.inTx(ctx, func(tx Client) error {
+		var userID uuid.UUID
+		err := tx.db.QueryRowContext(ctx, "SELECT user_id FROM videos WHERE id = ?", videoID).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			_, err := tx.db.ExecContext(ctx, `
+			INSERT INTO tags (id, created_at, user_id, name)
+			VALUES (?, CURRENT_TIMESTAMP, ?, ?)
+			ON CONFLICT(user_id, name) DO NOTHING
+			`, uuid.New(), userID, name)
+			if err != nil {
+				return err
+			}
+
+			var tagID uuid.UUID
+			err = tx.db.QueryRowContext(ctx, "SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, name).Scan(&tagID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.db.ExecContext(ctx, `
+			INSERT INTO video_tags (video_id, tag_id, created_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(video_id, tag_id) DO NOTHING
+			`, videoID, tagID)
+			if err != nil {
+				return err
+			}
+		}
+
+		tags, err = tx.GetVideoTags(ctx, videoID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// RemoveVideoTag takes a tag off a video. Removing a tag the video doesn't
+// have is not an error.
+func (c Client) RemoveVideoTag(ctx context.Context, videoID uuid.UUID, name string) error {
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return err
+	}
+	query := `
+	DELETE FROM video_tags
+	WHERE video_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)
+	`
+	_, err = c.db.ExecContext(ctx, query, videoID, name)
+	return err
+}
+
+// GetUserTags lists the user's tags that start with prefix, most used first,
+// for autocomplete. Tags on no videos, or only on trashed ones, are left out.
+func (c Client) GetUserTags(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]TagCount, error) {
+	prefix = strings.ToLower(strings.TrimLeft(prefix, " "))
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+
+	query := `
+	SELECT tags.name, COUNT(*) AS video_count
+	FROM tags
+	JOIN video_tags ON video_tags.tag_id = tags.id
+	JOIN videos ON videos.id = video_tags.video_id
+	WHERE tags.user_id = ? AND tags.name LIKE ? ESCAPE '\' AND videos.deleted_at IS NULL
+	GROUP BY tags.name
+	ORDER BY video_count DESC, tags.name
+	LIMIT ?
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, userID, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.VideoCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (c Client) attachTags(ctx context.Context, video *Video) error {
+	tags, err := c.GetVideoTags(ctx, video.ID)
+	if err != nil {
+		return err
+	}
+	video.Tags = tags
+	return nil
+}
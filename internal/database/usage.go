@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserUsage is what a user currently has stored: the sum of their videos'
+// VideoBytes (video, audio and retained source) and ThumbnailBytes, and how
+// many videos they have. It is adjusted in the same transaction as the video
+// rows it summarizes.
+type UserUsage struct {
+	UserID     uuid.UUID `json:"user_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	BytesUsed  int64     `json:"bytes_used"`
+	VideoCount int       `json:"video_count"`
+}
+
+// UserQuota overrides the deployment defaults for one user. Nil limits fall
+// back to the defaults.
+type UserQuota struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	SetUserQuotaParams
+}
+
+// Quota limits what one user can store. Zero means unlimited.
+type Quota struct {
+	MaxBytes  int64 `json:"max_bytes"`
+	MaxVideos int   `json:"max_videos"`
+}
+
+var (
+	// ErrStorageQuotaExceeded is returned by writes that would take a user
+	// past their storage quota.
+	ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrVideoQuotaExceeded is returned by writes that would give a user
+	// more videos than their quota allows.
+	ErrVideoQuotaExceeded = errors.New("video quota exceeded")
+)
+
+type SetUserQuotaParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	MaxBytes  *int64    `json:"max_bytes"`
+	MaxVideos *int      `json:"max_videos"`
+}
+
+func (c Client) GetUserUsage(ctx context.Context, userID uuid.UUID) (UserUsage, error) {
+	query := `
+	SELECT
+		user_id,
+		updated_at,
+		bytes_used,
+		video_count
+	FROM user_usage
+	WHERE user_id = ?
+	`
+
+	var usage UserUsage
+	err := c.db.QueryRowContext(ctx, query, userID).Scan(
+		&usage.UserID,
+		&usage.UpdatedAt,
+		&usage.BytesUsed,
+		&usage.VideoCount,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserUsage{UserID: userID}, nil
+		}
+		return UserUsage{}, err
+	}
+
+	return usage, nil
+}
+
+// WithDefaultQuota returns a Client that enforces quota for users without an
+// override.
+func (c Client) WithDefaultQuota(quota Quota) Client {
+	c.defaultQuota = quota
+	return c
+}
+
+// GetEffectiveQuota is the quota the store enforces for the user: their
+// overrides on top of the default quota.
+func (c Client) GetEffectiveQuota(ctx context.Context, userID uuid.UUID) (Quota, error) {
+	override, err := c.GetUserQuota(ctx, userID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Quota{}, err
+	}
+
+	quota := c.defaultQuota
+	if override.MaxBytes != nil {
+		quota.MaxBytes = *override.MaxBytes
+	}
+	if override.MaxVideos != nil {
+		quota.MaxVideos = *override.MaxVideos
+	}
+	return quota, nil
+}
+
+// GetRemainingBytes is how many more bytes the user may store, or -1 when
+// bytes are unlimited.
+func (c Client) GetRemainingBytes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	quota, err := c.GetEffectiveQuota(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if quota.MaxBytes == 0 {
+		return -1, nil
+	}
+	usage, err := c.GetUserUsage(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return max(0, quota.MaxBytes-usage.BytesUsed), nil
+}
+
+// adjustUsage moves a user's usage by the given deltas, never letting either
+// counter drop below zero. Increases are checked against the user's quota in
+// the same UPDATE, so concurrent writes can't overshoot it together; going
+// over returns ErrStorageQuotaExceeded or ErrVideoQuotaExceeded. Call it in
+// the transaction that changed the videos.
+func (c Client) adjustUsage(ctx context.Context, userID uuid.UUID, bytesDelta int64, videoDelta int) error {
+	if bytesDelta == 0 && videoDelta == 0 {
+		return nil
+	}
+
+	quota, err := c.GetEffectiveQuota(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	insert := `
+	INSERT INTO user_usage (
+		user_id,
+		updated_at,
+		bytes_used,
+		video_count
+	) VALUES (?, CURRENT_TIMESTAMP, 0, 0)
+	ON CONFLICT(user_id) DO NOTHING
+	`
+	_, err = c.db.ExecContext(ctx, insert, userID)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE user_usage
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		bytes_used = %[1]s(0, bytes_used + CAST(? AS BIGINT)),
+		video_count = %[1]s(0, video_count + CAST(? AS INTEGER))
+	WHERE user_id = ?
+	`, c.db.dialect.greatest)
+	args := []any{bytesDelta, videoDelta, userID}
+	checkBytes := bytesDelta > 0 && quota.MaxBytes > 0
+	if checkBytes {
+		query += "AND bytes_used + CAST(? AS BIGINT) <= CAST(? AS BIGINT)\n"
+		args = append(args, bytesDelta, quota.MaxBytes)
+	}
+	checkVideos := videoDelta > 0 && quota.MaxVideos > 0
+	if checkVideos {
+		query += "AND video_count + CAST(? AS INTEGER) <= CAST(? AS INTEGER)\n"
+		args = append(args, videoDelta, quota.MaxVideos)
+	}
+
+	err = requireRow(c.db.ExecContext(ctx, query, args...))
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if checkVideos {
+		usage, err := c.GetUserUsage(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if usage.VideoCount+videoDelta > quota.MaxVideos {
+			return ErrVideoQuotaExceeded
+		}
+	}
+	return ErrStorageQuotaExceeded
+}
+
+func (c Client) GetUserQuota(ctx context.Context, userID uuid.UUID) (UserQuota, error) {
+	query := `
+	SELECT
+		user_id,
+		created_at,
+		updated_at,
+		max_bytes,
+		max_videos
+	FROM user_quotas
+	WHERE user_id = ?
+	`
+
+	var quota UserQuota
+	err := c.db.QueryRowContext(ctx, query, userID).Scan(
+		&quota.UserID,
+		&quota.CreatedAt,
+		&quota.UpdatedAt,
+		&quota.MaxBytes,
+		&quota.MaxVideos,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserQuota{}, ErrNotFound
+		}
+		return UserQuota{}, err
+	}
+
+	return quota, nil
+}
+
+func (c Client) SetUserQuota(ctx context.Context, params SetUserQuotaParams) (UserQuota, error) {
+	query := `
+	INSERT INTO user_quotas (
+		user_id,
+		created_at,
+		updated_at,
+		max_bytes,
+		max_videos
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		max_bytes = excluded.max_bytes,
+		max_videos = excluded.max_videos
+	`
+	_, err := c.db.ExecContext(ctx, query, params.UserID, params.MaxBytes, params.MaxVideos)
+	if err != nil {
+		return UserQuota{}, err
+	}
+
+	return c.GetUserQuota(ctx, params.UserID)
+}
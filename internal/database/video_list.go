@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	VideoSortCreatedAt = "created_at"
+	VideoSortUpdatedAt = "updated_at"
+	VideoSortTitle     = "title"
+	VideoSortDuration  = "duration"
+)
+
+// A video is a draft until a file has been uploaded for it.
+const (
+	VideoStatusDraft = "draft"
+	VideoStatusReady = "ready"
+)
+
+// videoSortColumns are the expressions ListVideos orders by. Videos without a
+// duration sort as if it were zero.
+var videoSortColumns = map[string]string{
+	VideoSortCreatedAt: "created_at",
+	VideoSortUpdatedAt: "updated_at",
+	VideoSortTitle:     "title",
+	VideoSortDuration:  "COALESCE(duration_seconds, 0)",
+}
+
+// ListVideosParams selects one page of a user's videos, leaving out the ones
+// in the trash. Empty filters match everything.
+type ListVideosParams struct {
+	UserID     uuid.UUID
+	Sort       string
+	Descending bool
+	// AspectRatio matches the current version's, e.g. "16:9".
+	AspectRatio   string
+	Status        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Tags matches videos with any of them, or all of them with
+	// MatchAllTags.
+	Tags         []string
+	MatchAllTags bool
+	// After continues from the previous page's Next.
+	After *VideoCursor
+	Limit int
+}
+
+// VideoCursor is where a page of videos ended: the last video's sort key and,
+// to break ties, its ID. It is only meaningful with the sort it came from.
+type VideoCursor struct {
+	Sort       string    `json:"sort"`
+	Descending bool      `json:"desc"`
+	Key        string    `json:"key"`
+	ID         uuid.UUID `json:"id"`
+}
+
+type VideoPage struct {
+	Videos []Video
+	// Next is nil on the last page.
+	Next *VideoCursor
+}
+
+func validateListVideosParams(params ListVideosParams) error {
+	if _, ok := videoSortColumns[params.Sort]; !ok {
+		return fmt.Errorf("unknown sort %q", params.Sort)
+	}
+	if params.Status != "" && params.Status != VideoStatusDraft && params.Status != VideoStatusReady {
+		return fmt.Errorf("unknown status %q", params.Status)
+	}
+	if _, err := normalizeTags(params.Tags); err != nil {
+		return err
+	}
+	if params.Limit <= 0 {
+		return fmt.Errorf("limit must be positive, got %d", params.Limit)
+	}
+	if params.After != nil && (params.After.Sort != params.Sort || params.After.Descending != params.Descending) {
+		return fmt.Errorf("cursor is for a different sort")
+	}
+	return nil
+}
+
+// videoSortKey renders the value video is sorted by for a cursor.
+func videoSortKey(sort string, video Video) string {
+	switch sort {
+	case VideoSortUpdatedAt:
+		return video.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case VideoSortTitle:
+		return video.Title
+	case VideoSortDuration:
+		duration := 0.0
+		if video.Duration != nil {
+			duration = *video.Duration
+		}
+		return strconv.FormatFloat(duration, 'g', -1, 64)
+	default:
+		return video.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// videoSortArg turns a cursor's key back into a parameter that compares
+// against the sort column.
+func (d dialect) videoSortArg(cursor VideoCursor) (any, error) {
+	switch cursor.Sort {
+	case VideoSortCreatedAt, VideoSortUpdatedAt:
+		t, err := time.Parse(time.RFC3339Nano, cursor.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		return d.timestamp(t), nil
+	case VideoSortDuration:
+		duration, err := strconv.ParseFloat(cursor.Key, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		return duration, nil
+	default:
+		return cursor.Key, nil
+	}
+}
+
+// newVideoPage trims the extra video fetched to tell whether another page
+// follows and points Next at the last one kept.
+func newVideoPage(videos []Video, params ListVideosParams) VideoPage {
+	if len(videos) <= params.Limit {
+		return VideoPage{Videos: videos}
+	}
+	videos = videos[:params.Limit]
+	last := videos[len(videos)-1]
+	return VideoPage{
+		Videos: videos,
+		Next: &VideoCursor{
+			Sort:       params.Sort,
+			Descending: params.Descending,
+			Key:        videoSortKey(params.Sort, last),
+			ID:         last.ID,
+		},
+	}
+}
+
+// ListVideos returns a page of a user's videos in a stable order, using the
+// sort column and then the ID so that pages never overlap or skip a video.
+func (c Client) ListVideos(ctx context.Context, params ListVideosParams) (VideoPage, error) {
+	err := validateListVideosParams(params)
+	if err != nil {
+		return VideoPage{}, err
+	}
+
+	conditions := []string{"user_id = ?", "deleted_at IS NULL"}
+	args := []any{params.UserID}
+	if params.AspectRatio != "" {
+		conditions = append(conditions, "current_version_id IN (SELECT id FROM video_versions WHERE aspect_ratio = ?)")
+		args = append(args, params.AspectRatio)
+	}
+	switch params.Status {
+	case VideoStatusDraft:
+		conditions = append(conditions, "video_url IS NULL")
+	case VideoStatusReady:
+		conditions = append(conditions, "video_url IS NOT NULL")
+	}
+	if params.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, c.db.dialect.timestamp(*params.CreatedAfter))
+	}
+	if params.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, c.db.dialect.timestamp(*params.CreatedBefore))
+	}
+
+	if len(params.Tags) > 0 {
+		tags, err := normalizeTags(params.Tags)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		tags = slices.Compact(slices.Sorted(slices.Values(tags)))
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tags)), ", ")
+		tagged := `id IN (
+			SELECT video_tags.video_id
+			FROM video_tags
+			JOIN tags ON tags.id = video_tags.tag_id
+			WHERE tags.name IN (` + placeholders + `)`
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		if params.MatchAllTags {
+			tagged += `
+			GROUP BY video_tags.video_id
+			HAVING COUNT(*) = ?`
+			args = append(args, len(tags))
+		}
+		conditions = append(conditions, tagged+")")
+	}
+
+	column := videoSortColumns[params.Sort]
+	comparison, direction := ">", "ASC"
+	if params.Descending {
+		comparison, direction = "<", "DESC"
+	}
+	if params.After != nil {
+		key, err := c.db.dialect.videoSortArg(*params.After)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, comparison))
+		args = append(args, key, key, params.After.ID)
+	}
+
+	query := `SELECT` + videoColumns + `
+	FROM videos
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY ` + column + ` ` + direction + `, id ` + direction + `
+	LIMIT ?
+	`
+	args = append(args, params.Limit+1)
+
+	videos, err := c.queryVideos(ctx, query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	return newVideoPage(videos, params), nil
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	VideoVersionSourceUpload = "upload"
+	VideoVersionSourceTrim   = "trim"
+)
+
+// VideoVersion is one set of renditions a video has had. The video row mirrors
+// whichever version is current.
+type VideoVersion struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+	CreateVideoVersionParams
+}
+
+type CreateVideoVersionParams struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	UploadedBy  uuid.UUID `json:"uploaded_by"`
+	Source      string    `json:"source"`
+	VideoURL    string    `json:"video_url"`
+	AudioURL    *string   `json:"audio_url"`
+	SourceKey   *string   `json:"-"`
+	Duration    *float64  `json:"duration_seconds"`
+	AspectRatio string    `json:"aspect_ratio"`
+	StoredBytes int64     `json:"stored_bytes"`
+	// ContentSHA256 is the hash of the upload the version was made from.
+	ContentSHA256 *string `json:"content_sha256"`
+}
+
+const videoVersionColumns = `
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		version,
+		uploaded_by,
+		source,
+		video_url,
+		audio_url,
+		source_key,
+		duration_seconds,
+		aspect_ratio,
+		stored_bytes,
+		content_sha256
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideoVersion(row rowScanner) (VideoVersion, error) {
+	var version VideoVersion
+	err := row.Scan(
+		&version.ID,
+		&version.CreatedAt,
+		&version.UpdatedAt,
+		&version.VideoID,
+		&version.Version,
+		&version.UploadedBy,
+		&version.Source,
+		&version.VideoURL,
+		&version.AudioURL,
+		&version.SourceKey,
+		&version.Duration,
+		&version.AspectRatio,
+		&version.StoredBytes,
+		&version.ContentSHA256,
+	)
+	return version, err
+}
+
+// GetVideoVersions lists a video's versions, newest first.
+func (c Client) GetVideoVersions(ctx context.Context, videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `SELECT` + videoVersionColumns + `
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		version, err := scanVideoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetVideoURLs lists every video_url a video or one of its versions points
+// at, trashed videos included, each once.
+func (c Client) GetVideoURLs(ctx context.Context) ([]string, error) {
+	query := `
+	SELECT video_url FROM videos WHERE video_url IS NOT NULL
+	UNION
+	SELECT video_url FROM video_versions
+	ORDER BY video_url
+	`
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videoURLs := []string{}
+	for rows.Next() {
+		var videoURL string
+		if err := rows.Scan(&videoURL); err != nil {
+			return nil, err
+		}
+		videoURLs = append(videoURLs, videoURL)
+	}
+
+	return videoURLs, rows.Err()
+}
+
+func (c Client) GetVideoVersion(ctx context.Context, id uuid.UUID) (VideoVersion, error) {
+	query := `SELECT` + videoVersionColumns + `
+	FROM video_versions
+	WHERE id = ?
+	`
+
+	version, err := scanVideoVersion(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, ErrNotFound
+		}
+		return VideoVersion{}, err
+	}
+
+	return version, nil
+}
+
+// CreateVideoVersion numbers the new version one past the video's latest.
+func (c Client) CreateVideoVersion(ctx context.Context, params CreateVideoVersionParams) (VideoVersion, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO video_versions (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		version,
+		uploaded_by,
+		source,
+		video_url,
+		audio_url,
+		source_key,
+		duration_seconds,
+		aspect_ratio,
+		stored_bytes,
+		content_sha256
+	) VALUES (
+		?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?,
+		(SELECT COALESCE(MAX(version), 0) + 1 FROM video_versions WHERE video_id = ?),
+		?, ?, ?, ?, ?, ?, ?, ?, ?
+	)
+	`
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		id,
+		params.VideoID,
+		params.VideoID,
+		params.UploadedBy,
+		params.Source,
+		params.VideoURL,
+		params.AudioURL,
+		params.SourceKey,
+		params.Duration,
+		params.AspectRatio,
+		params.StoredBytes,
+		params.ContentSHA256,
+	)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	return c.GetVideoVersion(ctx, id)
+}
+
+// UpdateVideoVersion swaps the renditions of an existing version, for edits
+// like trimming that replace a version rather than adding one.
+func (c Client) UpdateVideoVersion(ctx context.Context, version VideoVersion) error {
+	query := `
+	UPDATE video_versions
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		source = ?,
+		video_url = ?,
+		audio_url = ?,
+		source_key = ?,
+		duration_seconds = ?,
+		aspect_ratio = ?,
+		stored_bytes = ?,
+		content_sha256 = ?
+	WHERE id = ?
+	`
+	return requireRow(c.db.ExecContext(
+		ctx,
+		query,
+		version.Source,
+		version.VideoURL,
+		version.AudioURL,
+		version.SourceKey,
+		version.Duration,
+		version.AspectRatio,
+		version.StoredBytes,
+		version.ContentSHA256,
+		version.ID,
+	))
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -9,23 +10,40 @@ import (
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID               uuid.UUID       `json:"id"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	ThumbnailURL     *string         `json:"thumbnail_url"`
+	VideoURL         *string         `json:"video_url"`
+	AudioURL         *string         `json:"audio_url"`
+	Duration         *float64        `json:"duration_seconds"`
+	SourceKey        *string         `json:"-"`
+	CurrentVersionID *uuid.UUID      `json:"current_version_id"`
+	VideoBytes       int64           `json:"-"`
+	ThumbnailBytes   int64           `json:"-"`
+	DeletedAt        *time.Time      `json:"deleted_at,omitempty"`
+	Subtitles        []SubtitleTrack `json:"subtitles"`
+	Tags             []string        `json:"tags"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Visibility defaults to private.
+	Visibility string    `json:"visibility"`
+	UserID     uuid.UUID `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+// Private videos are only visible to their owner. Anyone can watch unlisted
+// ones given the link, but only public ones turn up in others' searches.
+const (
+	VideoVisibilityPrivate  = "private"
+	VideoVisibilityUnlisted = "unlisted"
+	VideoVisibilityPublic   = "public"
+)
+
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,13 +51,44 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
+		audio_url,
+		duration_seconds,
+		source_key,
+		current_version_id,
+		video_bytes,
+		thumbnail_bytes,
+		deleted_at,
+		visibility,
 		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+`
 
-	rows, err := c.db.Query(query, userID)
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.AudioURL,
+		&video.Duration,
+		&video.SourceKey,
+		&video.CurrentVersionID,
+		&video.VideoBytes,
+		&video.ThumbnailBytes,
+		&video.DeletedAt,
+		&video.Visibility,
+		&video.UserID,
+	)
+	return video, err
+}
+
+// queryVideos runs a SELECT over videoColumns and attaches subtitle tracks and
+// tags to every result.
+func (c Client) queryVideos(ctx context.Context, query string, args ...any) ([]Video, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,109 +96,339 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range videos {
+		if err := c.attachVideoDetails(ctx, &videos[i]); err != nil {
+			return nil, err
+		}
+	}
 
 	return videos, nil
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
-	id := uuid.New()
-	query := `
-	INSERT INTO videos (
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+// GetVideos lists a user's videos, leaving out the ones in the trash.
+func (c Client) GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	query := `SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NULL
+	ORDER BY created_at DESC
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	return c.queryVideos(ctx, query, userID)
+}
+
+func (c Client) GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	query := `SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC
+	`
+	return c.queryVideos(ctx, query, userID)
+}
+
+// GetVideosTrashedBefore finds trashed videos that are due to be purged.
+func (c Client) GetVideosTrashedBefore(ctx context.Context, cutoff time.Time) ([]Video, error) {
+	query := `SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND deleted_at <= ?
+	ORDER BY deleted_at
+	`
+	return c.queryVideos(ctx, query, c.db.dialect.timestamp(cutoff))
+}
+
+// TrashVideo marks a video deleted without removing anything, so it can be
+// restored until it is purged.
+func (c Client) TrashVideo(ctx context.Context, id uuid.UUID) error {
+	return requireRow(c.db.ExecContext(ctx, "UPDATE videos SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", id))
+}
+
+func (c Client) RestoreVideo(ctx context.Context, id uuid.UUID) error {
+	return requireRow(c.db.ExecContext(ctx, "UPDATE videos SET deleted_at = NULL WHERE id = ?", id))
+}
+
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
+	id := uuid.New()
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPrivate
+	}
+	err := c.inTx(ctx, func(tx Client) error {
+		query := `
+		INSERT INTO videos (
+			id,
+			created_at,
+			updated_at,
+			title,
+			description,
+			visibility,
+			user_id
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+		`
+		_, err := tx.db.ExecContext(ctx, query, id, params.Title, params.Description, params.Visibility, params.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.indexVideo(ctx, id, params.Title, params.Description)
+		if err != nil {
+			return err
+		}
+		return tx.adjustUsage(ctx, params.UserID, 0, 1)
+	})
 	if err != nil {
 		return Video{}, err
 	}
 
-	return c.GetVideo(id)
+	return c.GetVideo(ctx, id)
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
-	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+// GetVideo returns the video even if it is in the trash; check DeletedAt.
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	query := `SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return Video{}, nil
+			return Video{}, ErrNotFound
 		}
 		return Video{}, err
 	}
 
+	err = c.attachVideoDetails(ctx, &video)
+	if err != nil {
+		return Video{}, err
+	}
+
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
-	query := `
-	UPDATE videos
-	SET
-		title = ?,
-		description = ?,
-		thumbnail_url = ?,
-		video_url = ?,
-		user_id = ?
-	WHERE id = ?
-	`
+// UpdateVideo saves the video and moves its owner's usage by however much its
+// stored bytes changed.
+func (c Client) UpdateVideo(ctx context.Context, video Video) error {
+	return c.inTx(ctx, func(tx Client) error {
+		var (
+			previousUserID uuid.UUID
+			previousBytes  int64
+		)
+		err := tx.db.QueryRowContext(ctx, "SELECT user_id, video_bytes + thumbnail_bytes FROM videos WHERE id = ?", video.ID).Scan(&previousUserID, &previousBytes)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
 
-	_, err := c.db.Exec(
-		query,
-		video.Title,
-		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		video.UserID,
-		video.ID,
-	)
-	return err
+		query := `
+		UPDATE videos
+		SET
+			updated_at = CURRENT_TIMESTAMP,
+			title = ?,
+			description = ?,
+			thumbnail_url = ?,
+			video_url = ?,
+			audio_url = ?,
+			duration_seconds = ?,
+			source_key = ?,
+			current_version_id = ?,
+			video_bytes = ?,
+			thumbnail_bytes = ?,
+			visibility = ?,
+			user_id = ?
+		WHERE id = ?
+		`
+
+		_, err = tx.db.ExecContext(
+			ctx,
+			query,
+			video.Title,
+			video.Description,
+			&video.ThumbnailURL,
+			&video.VideoURL,
+			video.AudioURL,
+			video.Duration,
+			video.SourceKey,
+			video.CurrentVersionID,
+			video.VideoBytes,
+			video.ThumbnailBytes,
+			video.Visibility,
+			video.UserID,
+			video.ID,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = tx.indexVideo(ctx, video.ID, video.Title, video.Description)
+		if err != nil {
+			return err
+		}
+
+		bytes := video.VideoBytes + video.ThumbnailBytes
+		if previousUserID == video.UserID {
+			return tx.adjustUsage(ctx, video.UserID, bytes-previousBytes, 0)
+		}
+		err = tx.adjustUsage(ctx, previousUserID, -previousBytes, -1)
+		if err != nil {
+			return err
+		}
+		return tx.adjustUsage(ctx, video.UserID, bytes, 1)
+	})
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
-	query := `
-	DELETE FROM videos
-	WHERE id = ?
-	`
-	_, err := c.db.Exec(query, id)
+// UpdateVideoMetadataParams is the metadata a video's owner can edit.
+type UpdateVideoMetadataParams struct {
+	ID          uuid.UUID
+	Title       string
+	Description string
+	Visibility  string
+	// IfMatch, if set, is the video as the caller last read it. The update
+	// then fails with ErrModified unless the stored video still has the same
+	// updated_at and metadata.
+	IfMatch *Video
+}
+
+// UpdateVideoMetadata saves the video's title, description and visibility and
+// returns the updated video.
+func (c Client) UpdateVideoMetadata(ctx context.Context, params UpdateVideoMetadataParams) (Video, error) {
+	err := c.inTx(ctx, func(tx Client) error {
+		query := `
+		UPDATE videos
+		SET
+			updated_at = CURRENT_TIMESTAMP,
+			title = ?,
+			description = ?,
+			visibility = ?
+		WHERE id = ?
+		`
+		args := []any{params.Title, params.Description, params.Visibility, params.ID}
+		if params.IfMatch != nil {
+			query += ` AND updated_at = ? AND title = ? AND COALESCE(description, '') = ? AND visibility = ?`
+			args = append(args, tx.db.dialect.timestamp(params.IfMatch.UpdatedAt), params.IfMatch.Title, params.IfMatch.Description, params.IfMatch.Visibility)
+		}
+
+		err := requireRow(tx.db.ExecContext(ctx, query, args...))
+		if errors.Is(err, ErrNotFound) && params.IfMatch != nil {
+			_, err = tx.GetVideo(ctx, params.ID)
+			if err == nil {
+				return ErrModified
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.indexVideo(ctx, params.ID, params.Title, params.Description)
+	})
+	if err != nil {
+		return Video{}, err
+	}
+
+	return c.GetVideo(ctx, params.ID)
+}
+
+// DeleteVideo removes the video along with its subtitles, chapters, tags,
+// playlist entries and versions, and gives its stored bytes back to the owner. Deleting a video
+// that doesn't exist is not an error.
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	err := c.deleteVideo(ctx, id, "")
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
 	return err
 }
+
+// PurgeTrashedVideo deletes the video if it is still in the trash and was
+// trashed no later than cutoff, returning what it was and its versions so
+// their files and objects can go too. A video that was restored or purged in
+// the meantime is left alone and ErrNotFound returned.
+func (c Client) PurgeTrashedVideo(ctx context.Context, id uuid.UUID, cutoff time.Time) (Video, []VideoVersion, error) {
+	var (
+		video    Video
+		versions []VideoVersion
+	)
+	err := c.inTx(ctx, func(tx Client) error {
+		var err error
+		video, err = tx.GetVideo(ctx, id)
+		if err != nil {
+			return err
+		}
+		versions, err = tx.GetVideoVersions(ctx, id)
+		if err != nil {
+			return err
+		}
+		return tx.deleteVideo(ctx, id, "AND deleted_at IS NOT NULL AND deleted_at <= ?", c.db.dialect.timestamp(cutoff))
+	})
+	if err != nil {
+		return Video{}, nil, err
+	}
+	return video, versions, nil
+}
+
+// deleteVideo removes the video and everything that belongs to it, as long
+// as its row also matches condition. Otherwise nothing changes and it returns
+// ErrNotFound.
+func (c Client) deleteVideo(ctx context.Context, id uuid.UUID, condition string, args ...any) error {
+	return c.inTx(ctx, func(tx Client) error {
+		var (
+			userID uuid.UUID
+			bytes  int64
+		)
+		err := tx.db.QueryRowContext(ctx, "SELECT user_id, video_bytes + thumbnail_bytes FROM videos WHERE id = ?", id).Scan(&userID, &bytes)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.removeVideoFromPlaylists(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, query := range []string{
+			"DELETE FROM subtitle_tracks WHERE video_id = ?",
+			"DELETE FROM chapters WHERE video_id = ?",
+			"DELETE FROM video_tags WHERE video_id = ?",
+			"DELETE FROM video_versions WHERE video_id = ?",
+		} {
+			_, err = tx.db.ExecContext(ctx, query, id)
+			if err != nil {
+				return err
+			}
+		}
+		// The condition is checked by the delete itself, so a concurrent
+		// change to the row makes it miss and the transaction roll back.
+		err = requireRow(tx.db.ExecContext(ctx, "DELETE FROM videos WHERE id = ? "+condition, append([]any{id}, args...)...))
+		if err != nil {
+			return err
+		}
+
+		err = tx.unindexVideo(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.adjustUsage(ctx, userID, -bytes, -1)
+	})
+}
+
+// attachVideoDetails fills in what a video keeps in other tables.
+func (c Client) attachVideoDetails(ctx context.Context, video *Video) error {
+	err := c.attachSubtitleTracks(ctx, video)
+	if err != nil {
+		return err
+	}
+	return c.attachTags(ctx, video)
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Watermark struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpsertWatermarkParams
+}
+
+type UpsertWatermarkParams struct {
+	UserID       uuid.UUID `json:"user_id"`
+	ImageURL     string    `json:"image_url"`
+	FilePath     string    `json:"-"`
+	Position     string    `json:"position"`
+	Opacity      float64   `json:"opacity"`
+	Scale        float64   `json:"scale"`
+	Enabled      bool      `json:"enabled"`
+	RetainSource bool      `json:"retain_source"`
+}
+
+func (c Client) UpsertWatermark(ctx context.Context, params UpsertWatermarkParams) (Watermark, error) {
+	query := `
+	INSERT INTO watermarks (
+		user_id,
+		created_at,
+		updated_at,
+		image_url,
+		file_path,
+		position,
+		opacity,
+		scale,
+		enabled,
+		retain_source
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		image_url = excluded.image_url,
+		file_path = excluded.file_path,
+		position = excluded.position,
+		opacity = excluded.opacity,
+		scale = excluded.scale,
+		enabled = excluded.enabled,
+		retain_source = excluded.retain_source
+	`
+	_, err := c.db.ExecContext(
+		ctx,
+		query,
+		params.UserID,
+		params.ImageURL,
+		params.FilePath,
+		params.Position,
+		params.Opacity,
+		params.Scale,
+		params.Enabled,
+		params.RetainSource,
+	)
+	if err != nil {
+		return Watermark{}, err
+	}
+
+	return c.GetWatermark(ctx, params.UserID)
+}
+
+func (c Client) GetWatermark(ctx context.Context, userID uuid.UUID) (Watermark, error) {
+	query := `
+	SELECT
+		user_id,
+		created_at,
+		updated_at,
+		image_url,
+		file_path,
+		position,
+		opacity,
+		scale,
+		enabled,
+		retain_source
+	FROM watermarks
+	WHERE user_id = ?
+	`
+
+	var watermark Watermark
+	err := c.db.QueryRowContext(ctx, query, userID).Scan(
+		&watermark.UserID,
+		&watermark.CreatedAt,
+		&watermark.UpdatedAt,
+		&watermark.ImageURL,
+		&watermark.FilePath,
+		&watermark.Position,
+		&watermark.Opacity,
+		&watermark.Scale,
+		&watermark.Enabled,
+		&watermark.RetainSource,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Watermark{}, ErrNotFound
+		}
+		return Watermark{}, err
+	}
+
+	return watermark, nil
+}
+
+func (c Client) DeleteWatermark(ctx context.Context, userID uuid.UUID) error {
+	query := `
+	DELETE FROM watermarks
+	WHERE user_id = ?
+	`
+	_, err := c.db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,37 @@
+package ffmpeg
+
+import (
+	"context"
+	"sync"
+)
+
+type Call struct {
+	Name string
+	Args []string
+}
+
+// FakeRunner records every call and answers with Handler, or an empty Result
+// when Handler is nil.
+type FakeRunner struct {
+	Handler func(ctx context.Context, name string, args []string) (Result, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (f *FakeRunner) Run(ctx context.Context, name string, args ...string) (Result, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Name: name, Args: append([]string(nil), args...)})
+	f.mu.Unlock()
+
+	if f.Handler == nil {
+		return Result{}, nil
+	}
+	return f.Handler(ctx, name, args)
+}
+
+func (f *FakeRunner) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
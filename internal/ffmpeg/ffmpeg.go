@@ -0,0 +1,143 @@
+// Package ffmpeg runs ffmpeg and ffprobe as child processes tied to a context,
+// with a per-job timeout, a cap on concurrent processes and stderr captured
+// into the returned error.
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const DefaultMaxStderrBytes = 64 << 10
+
+// Runner executes a media command. ExecRunner is the real implementation and
+// FakeRunner stands in for it in tests.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) (Result, error)
+}
+
+type Result struct {
+	Stdout []byte
+	// Stderr holds at most the runner's stderr limit, keeping the tail since
+	// that's where ffmpeg reports both errors and filter summaries.
+	Stderr []byte
+}
+
+// Error is returned when a command can't start, exits non-zero or runs out of time.
+type Error struct {
+	Name     string
+	Args     []string
+	ExitCode int
+	Stderr   string
+	TimedOut bool
+	Err      error
+}
+
+func (e *Error) Error() string {
+	command := strings.Join(append([]string{e.Name}, e.Args...), " ")
+	reason := e.Err.Error()
+	if e.TimedOut {
+		reason = "timed out"
+	}
+	message := fmt.Sprintf("%s failed (%s): %s", e.Name, reason, command)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		message += "\n" + stderr
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type ExecRunner struct {
+	timeout        time.Duration
+	maxStderrBytes int
+	slots          chan struct{}
+}
+
+// NewExecRunner returns a runner that kills jobs after timeout (zero means no
+// limit beyond the caller's context) and runs at most maxConcurrent at once.
+func NewExecRunner(timeout time.Duration, maxConcurrent int) *ExecRunner {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &ExecRunner{
+		timeout:        timeout,
+		maxStderrBytes: DefaultMaxStderrBytes,
+		slots:          make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (r *ExecRunner) Run(ctx context.Context, name string, args ...string) (Result, error) {
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return Result{}, &Error{Name: name, Args: args, ExitCode: -1, Err: ctx.Err()}
+	}
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	var stdout bytes.Buffer
+	stderr := &tailBuffer{limit: r.maxStderrBytes}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	result := Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if err == nil {
+		return result, nil
+	}
+
+	runErr := &Error{
+		Name:     name,
+		Args:     args,
+		ExitCode: -1,
+		Stderr:   string(result.Stderr),
+		Err:      err,
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		runErr.ExitCode = exitErr.ExitCode()
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		runErr.Err = ctxErr
+		runErr.TimedOut = errors.Is(ctxErr, context.DeadlineExceeded)
+	}
+	return result, runErr
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) Bytes() []byte {
+	if b.truncated {
+		return append([]byte("...\n"), b.buf...)
+	}
+	return b.buf
+}
@@ -0,0 +1,82 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func requireShell(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+}
+
+func TestExecRunner_CapturesOutput(t *testing.T) {
+	requireShell(t)
+	runner := NewExecRunner(time.Minute, 1)
+
+	result, err := runner.Run(context.Background(), "sh", "-c", "echo out; echo err >&2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(result.Stdout) != "out\n" || string(result.Stderr) != "err\n" {
+		t.Errorf("Unexpected output: stdout %q, stderr %q", result.Stdout, result.Stderr)
+	}
+}
+
+func TestExecRunner_ExitErrorKeepsStderrTail(t *testing.T) {
+	requireShell(t)
+	runner := NewExecRunner(time.Minute, 1)
+	runner.maxStderrBytes = 16
+
+	_, err := runner.Run(context.Background(), "sh", "-c", "printf 'first line that is dropped\\nInvalid data' >&2; exit 3")
+	var runErr *Error
+	if !errors.As(err, &runErr) {
+		t.Fatalf("Expected *Error, received %v", err)
+	}
+	if runErr.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, received %d", runErr.ExitCode)
+	}
+	if !strings.HasSuffix(runErr.Stderr, "Invalid data") || strings.Contains(runErr.Stderr, "first line") {
+		t.Errorf("Unexpected stderr %q", runErr.Stderr)
+	}
+	if !strings.Contains(err.Error(), "Invalid data") {
+		t.Errorf("Expected stderr in error message, received %q", err.Error())
+	}
+}
+
+func TestExecRunner_Timeout(t *testing.T) {
+	requireShell(t)
+	runner := NewExecRunner(50*time.Millisecond, 1)
+
+	start := time.Now()
+	_, err := runner.Run(context.Background(), "sh", "-c", "exec sleep 5")
+	var runErr *Error
+	if !errors.As(err, &runErr) || !runErr.TimedOut {
+		t.Fatalf("Expected a timeout error, received %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error to wrap context.DeadlineExceeded")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Command wasn't killed promptly, took %s", elapsed)
+	}
+}
+
+func TestExecRunner_WaitsForSlotUntilCancelled(t *testing.T) {
+	requireShell(t)
+	runner := NewExecRunner(time.Minute, 1)
+	runner.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := runner.Run(ctx, "sh", "-c", "true")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded while waiting for a slot, received %v", err)
+	}
+}
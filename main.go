@@ -9,13 +9,13 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
+	db               database.Store
 	jwtSecret        string
 	platform         string
 	filepathRoot     string
@@ -26,21 +26,48 @@ type apiConfig struct {
 	port             string
 	host			 string
 	s3Client		 *s3.Client
+	defaultWatermark *watermarkSettings
+	loudnorm         *loudnormSettings
+	audioRendition   *audioRendition
+	chapterDetection *chapterDetectionSettings
+	ffmpeg           ffmpeg.Runner
+	processing       *processingAdmission
+	trash            trashSettings
 }
 
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
-	if pathToDB == "" {
+	// DB_URL picks the backend by scheme; DB_PATH is the older SQLite-only name.
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		dbURL = os.Getenv("DB_PATH")
+	}
+	if dbURL == "" {
 		log.Fatal("DB_URL must be set")
 	}
 
-	db, err := database.NewClient(pathToDB)
+	db, err := database.NewClient(dbURL)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(context.Background(), db, os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = prepareSchema(context.Background(), db)
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
+	}
+	if !db.FullTextSearch() {
+		log.Print("SQLite driver was built without FTS5, so search falls back to LIKE matching; build with -tags sqlite_fts5 (make build) for full-text search")
+	}
+
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -96,8 +123,48 @@ func main() {
 		log.Fatalf("Couldn't create new config for s3 client")
 	}
 
+	defaultWatermark, err := loadDefaultWatermark()
+	if err != nil {
+		log.Fatalf("Couldn't load default watermark: %v", err)
+	}
+
+	loudnorm, err := loadLoudnormSettings()
+	if err != nil {
+		log.Fatalf("Couldn't load loudness normalization settings: %v", err)
+	}
+
+	audioRendition, err := loadAudioRendition()
+	if err != nil {
+		log.Fatalf("Couldn't load audio rendition settings: %v", err)
+	}
+
+	chapterDetection, err := loadChapterDetectionSettings()
+	if err != nil {
+		log.Fatalf("Couldn't load chapter detection settings: %v", err)
+	}
+
+	ffmpegRunner, err := loadFFmpegRunner()
+	if err != nil {
+		log.Fatalf("Couldn't configure ffmpeg: %v", err)
+	}
+
+	processing, err := loadProcessingAdmission()
+	if err != nil {
+		log.Fatalf("Couldn't configure processing limits: %v", err)
+	}
+
+	defaultQuota, err := loadDefaultQuota()
+	if err != nil {
+		log.Fatalf("Couldn't load default quota: %v", err)
+	}
+
+	trash, err := loadTrashSettings()
+	if err != nil {
+		log.Fatalf("Couldn't load trash settings: %v", err)
+	}
+
 	cfg := apiConfig{
-		db:               db,
+		db:               db.WithDefaultQuota(defaultQuota),
 		jwtSecret:        jwtSecret,
 		platform:         platform,
 		filepathRoot:     filepathRoot,
@@ -108,6 +175,13 @@ func main() {
 		port:             port,
 		host:			  host,
 		s3Client: 		  s3Client,
+		defaultWatermark: defaultWatermark,
+		loudnorm:         loudnorm,
+		audioRendition:   audioRendition,
+		chapterDetection: chapterDetection,
+		ffmpeg:           ffmpegRunner,
+		processing:       processing,
+		trash:            trash,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -115,6 +189,24 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify-integrity":
+			err = cfg.runVerifyIntegrity(context.Background(), os.Stdout)
+			if err != nil {
+				log.Fatal(err)
+			}
+		case "set-quota":
+			err = cfg.runSetQuota(context.Background(), os.Args[2:], os.Stdout)
+			if err != nil {
+				log.Fatal(err)
+			}
+		default:
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		return
+	}
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
@@ -125,15 +217,53 @@ func main() {
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	mux.HandleFunc("GET /api/sessions", cfg.handlerSessionsGet)
+	mux.HandleFunc("DELETE /api/sessions", cfg.handlerSessionsDelete)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.handlerSessionDelete)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("GET /api/users/me/usage", cfg.handlerUserUsage)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/videos/search", cfg.handlerVideosSearch)
+	mux.HandleFunc("POST /api/videos/bulk", cfg.handlerVideosBulk)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaPatch)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/trim", cfg.handlerVideoTrim)
+	mux.HandleFunc("POST /api/videos/{videoID}/reprocess", cfg.handlerVideoReprocess)
+	mux.HandleFunc("GET /api/videos/{videoID}/versions", cfg.handlerVideoVersionsGet)
+	mux.HandleFunc("POST /api/videos/{videoID}/versions/{versionID}/rollback", cfg.handlerVideoVersionRollback)
+	mux.HandleFunc("GET /api/videos/{videoID}/chapters", cfg.handlerChaptersGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/chapters.vtt", cfg.handlerChaptersWebVTT)
+	mux.HandleFunc("PUT /api/videos/{videoID}/chapters", cfg.handlerChaptersReplace)
+	mux.HandleFunc("POST /api/videos/{videoID}/chapters", cfg.handlerChapterCreate)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/chapters/{chapterID}", cfg.handlerChapterDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/subtitles", cfg.handlerSubtitleUpload)
+	mux.HandleFunc("GET /api/videos/{videoID}/subtitles", cfg.handlerSubtitlesGet)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/subtitles/{trackID}", cfg.handlerSubtitleDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/tags", cfg.handlerVideoTagsAdd)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/tags/{tag}", cfg.handlerVideoTagDelete)
+	mux.HandleFunc("GET /api/tags", cfg.handlerTagsGet)
+
+	mux.HandleFunc("POST /api/playlists", cfg.handlerPlaylistCreate)
+	mux.HandleFunc("GET /api/playlists", cfg.handlerPlaylistsGet)
+	mux.HandleFunc("GET /api/playlists/{playlistID}", cfg.handlerPlaylistGet)
+	mux.HandleFunc("PUT /api/playlists/{playlistID}", cfg.handlerPlaylistUpdate)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}", cfg.handlerPlaylistDelete)
+	mux.HandleFunc("POST /api/playlists/{playlistID}/entries", cfg.handlerPlaylistEntryCreate)
+	mux.HandleFunc("PUT /api/playlists/{playlistID}/entries/{entryID}", cfg.handlerPlaylistEntryMove)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}/entries/{entryID}", cfg.handlerPlaylistEntryDelete)
+
+	mux.HandleFunc("GET /api/trash", cfg.handlerTrashGet)
+	mux.HandleFunc("POST /api/trash/{videoID}/restore", cfg.handlerTrashRestore)
+
+	mux.HandleFunc("PUT /api/watermark", cfg.handlerWatermarkUpdate)
+	mux.HandleFunc("GET /api/watermark", cfg.handlerWatermarkGet)
+	mux.HandleFunc("DELETE /api/watermark", cfg.handlerWatermarkDelete)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
@@ -142,6 +272,8 @@ func main() {
 		Handler: mux,
 	}
 
+	go cfg.purgeTrashPeriodically(context.Background())
+
 	log.Printf("Serving on: %s:%s/app/\n", host, port)
 	log.Fatal(srv.ListenAndServe())
 }
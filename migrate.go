@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// autoMigrateEnabled reads DB_AUTO_MIGRATE, which defaults to true. Turn it off
+// to run migrations separately with "migrate up" before deploying.
+func autoMigrateEnabled() (bool, error) {
+	raw := os.Getenv("DB_AUTO_MIGRATE")
+	if raw == "" {
+		return true, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid DB_AUTO_MIGRATE %q", raw)
+	}
+	return enabled, nil
+}
+
+// prepareSchema migrates the database at startup, or refuses to start against
+// an outdated schema when automatic migration is off.
+func prepareSchema(ctx context.Context, db database.Client) error {
+	enabled, err := autoMigrateEnabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		pending, err := db.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d migrations are pending, run \"migrate up\" first", pending)
+		}
+		return nil
+	}
+
+	_, err = db.Migrate(ctx)
+	return err
+}
+
+// runMigrate handles "migrate up", "migrate down [steps]" and "migrate status".
+func runMigrate(ctx context.Context, db database.Client, args []string, out io.Writer) error {
+	usage := errors.New("usage: migrate up | down [steps] | status")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := db.Migrate(ctx)
+		fmt.Fprintf(out, "applied %d migrations\n", count)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed <= 0 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+			steps = parsed
+		}
+		count, err := db.MigrateDown(ctx, steps)
+		fmt.Fprintf(out, "reverted %d migrations\n", count)
+		return err
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%s: %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return usage
+	}
+}
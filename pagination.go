@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// encodeCursor makes a position in a listing opaque to clients, who should only
+// hand it back to get the next page.
+func encodeCursor(cursor any) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(raw string, cursor any) error {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+	err = json.Unmarshal(data, cursor)
+	if err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+	return nil
+}
+
+// parsePageLimit reads the limit query parameter, defaulting to
+// defaultPageLimit and capped at maxPageLimit.
+func parsePageLimit(query url.Values) (int, error) {
+	raw := query.Get("limit")
+	if raw == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", raw)
+	}
+	return min(limit, maxPageLimit), nil
+}
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
 )
 
-func processVideoForFastStart(filepath string) (string, error) {
+// processVideoForFastStart re-muxes the video with the moov atom up front. When
+// chapterMetadataFilepath is set its chapters are embedded at the same time.
+func processVideoForFastStart(ctx context.Context, runner ffmpeg.Runner, filepath string, chapterMetadataFilepath string) (string, error) {
 	outputFilepath := fmt.Sprintf("%s.processing", filepath)
-	cmd := exec.Command("ffmpeg", "-i", filepath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilepath)
-	err := cmd.Run()
+	args := []string{"-y", "-i", filepath}
+	if chapterMetadataFilepath != "" {
+		args = append(args, "-i", chapterMetadataFilepath, "-map_chapters", "1")
+	}
+	args = append(args, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilepath)
+	_, err := runner.Run(ctx, "ffmpeg", args...)
 
 	if err != nil {
-		return "", fmt.Errorf("unable to execute command. input file path: %s\n outputfile path: %s \nError: %s\n command: %s", filepath, outputFilepath, err, cmd.String())
+		return "", fmt.Errorf("unable to fast start %s: %w", filepath, err)
 	}
 
 	return outputFilepath, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// loadDefaultQuota reads the quota every user gets unless they have an
+// override. USER_QUOTA_BYTES defaults to 10GiB and USER_QUOTA_VIDEOS to 100;
+// set either to 0 to lift that limit.
+func loadDefaultQuota() (database.Quota, error) {
+	quota := database.Quota{
+		MaxBytes:  10 << 30,
+		MaxVideos: 100,
+	}
+	if raw := os.Getenv("USER_QUOTA_BYTES"); raw != "" {
+		maxBytes, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxBytes < 0 {
+			return database.Quota{}, fmt.Errorf("invalid USER_QUOTA_BYTES %q", raw)
+		}
+		quota.MaxBytes = maxBytes
+	}
+	if raw := os.Getenv("USER_QUOTA_VIDEOS"); raw != "" {
+		maxVideos, err := strconv.Atoi(raw)
+		if err != nil || maxVideos < 0 {
+			return database.Quota{}, fmt.Errorf("invalid USER_QUOTA_VIDEOS %q", raw)
+		}
+		quota.MaxVideos = maxVideos
+	}
+	return quota, nil
+}
+
+// respondToWriteError answers a failed write to the store: 413 or 403 when it
+// would have taken the user past their quota, 500 with message otherwise.
+func respondToWriteError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, database.ErrStorageQuotaExceeded):
+		respondWithError(w, http.StatusRequestEntityTooLarge, "This would exceed your storage quota", err)
+	case errors.Is(err, database.ErrVideoQuotaExceeded):
+		respondWithError(w, http.StatusForbidden, "You've reached the maximum number of videos", err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, message, err)
+	}
+}
+
+// runSetQuota handles "set-quota <email> <max_bytes> <max_videos>". Either
+// limit can be "default" to drop the override, or 0 for unlimited.
+func (cfg *apiConfig) runSetQuota(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) != 3 {
+		return errors.New("usage: set-quota <email> <max_bytes|default> <max_videos|default>")
+	}
+
+	user, err := cfg.db.GetUserByEmail(ctx, args[0])
+	if errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("no user with email %s", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("unable to find user %s: %w", args[0], err)
+	}
+
+	params := database.SetUserQuotaParams{UserID: user.ID}
+	if args[1] != "default" {
+		maxBytes, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || maxBytes < 0 {
+			return fmt.Errorf("invalid max_bytes %q", args[1])
+		}
+		params.MaxBytes = &maxBytes
+	}
+	if args[2] != "default" {
+		maxVideos, err := strconv.Atoi(args[2])
+		if err != nil || maxVideos < 0 {
+			return fmt.Errorf("invalid max_videos %q", args[2])
+		}
+		params.MaxVideos = &maxVideos
+	}
+
+	_, err = cfg.db.SetUserQuota(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	quota, err := cfg.db.GetEffectiveQuota(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: max_bytes=%d max_videos=%d (0 is unlimited)\n", user.Email, quota.MaxBytes, quota.MaxVideos)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestQuotaLimits(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	cfg.assetsRoot = t.TempDir()
+	cfg.db = database.NewMemoryStore().WithDefaultQuota(database.Quota{MaxBytes: 10, MaxVideos: 1})
+	owner, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func() *httptest.ResponseRecorder {
+		t.Helper()
+		req := newAuthedRequest(t, cfg, http.MethodPost, "/api/videos", owner.ID)
+		req.Body = io.NopCloser(strings.NewReader(`{"title": "Boots"}`))
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoMetaCreate(rec, req)
+		return rec
+	}
+	if rec := create(); rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+	if rec := create(); rec.Code != http.StatusForbidden {
+		t.Errorf("create over the video limit = %d %s", rec.Code, rec.Body)
+	}
+	videos, err := cfg.db.GetVideos(ctx, owner.ID)
+	if err != nil || len(videos) != 1 {
+		t.Fatalf("videos = %+v, %v", videos, err)
+	}
+	video := videos[0]
+
+	// The thumbnail is only checked against the quota when it's saved.
+	req := newFormFileRequest(t, cfg, "/api/thumbnail_upload/"+video.ID.String(), owner.ID, nil, "thumbnail", "image/png", bytes.Repeat([]byte("x"), 11))
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("thumbnail over the byte limit = %d %s", rec.Code, rec.Body)
+	}
+	if entries, err := os.ReadDir(cfg.assetsRoot); err != nil || len(entries) != 0 {
+		t.Errorf("rejected thumbnail left behind: %v, %v", entries, err)
+	}
+	if usage, err := cfg.db.GetUserUsage(ctx, owner.ID); err != nil || usage.BytesUsed != 0 {
+		t.Errorf("usage = %+v, %v", usage, err)
+	}
+
+	req = newMultipartRequest(t, "video", bytes.Repeat([]byte("x"), 11))
+	authed := newAuthedRequest(t, cfg, http.MethodPost, "/api/video_upload/"+video.ID.String(), owner.ID)
+	req.Header.Set("Authorization", authed.Header.Get("Authorization"))
+	req.SetPathValue("videoID", video.ID.String())
+	rec = httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("video over the byte limit = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRunSetQuota(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	cfg.db = database.NewMemoryStore().WithDefaultQuota(database.Quota{MaxBytes: 10 << 30, MaxVideos: 100})
+	user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{Email: "user@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = cfg.runSetQuota(ctx, []string{"user@example.com", "53687091200", "default"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "user@example.com: max_bytes=53687091200 max_videos=100 (0 is unlimited)\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	override, err := cfg.db.GetUserQuota(ctx, user.ID)
+	if err != nil || override.MaxBytes == nil || *override.MaxBytes != 53687091200 || override.MaxVideos != nil {
+		t.Errorf("override = %+v, %v", override, err)
+	}
+
+	out.Reset()
+	err = cfg.runSetQuota(ctx, []string{"user@example.com", "default", "0"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota, err := cfg.db.GetEffectiveQuota(ctx, user.ID)
+	if err != nil || quota.MaxBytes != 10<<30 || quota.MaxVideos != 0 {
+		t.Errorf("quota = %+v, %v", quota, err)
+	}
+
+	for _, args := range [][]string{
+		{"user@example.com", "1"},
+		{"nobody@example.com", "1", "1"},
+		{"user@example.com", "-1", "1"},
+		{"user@example.com", "1", "lots"},
+	} {
+		if err := cfg.runSetQuota(ctx, args, io.Discard); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
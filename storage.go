@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// uploadVideoObject puts a processed video into the bucket grouped by aspect
+// ratio and returns the key and its public URL.
+func (cfg *apiConfig) uploadVideoObject(ctx context.Context, filePath, aspectRatio, contentType string) (string, string, error) {
+	s3ObjectKey, err := cfg.storeObject(ctx, aspectRatioToText(aspectRatio), "mp4", filePath, contentType)
+	if err != nil {
+		return "", "", err
+	}
+
+	return s3ObjectKey, cfg.getObjectURL(s3ObjectKey), nil
+}
+
+// uploadSourceObject keeps an unprocessed upload around for later re-processing.
+// Sources are never served, so only the key is returned.
+func (cfg *apiConfig) uploadSourceObject(ctx context.Context, filePath, contentType string) (string, error) {
+	return cfg.storeObject(ctx, "source", "mp4", filePath, contentType)
+}
+
+// storeObject puts a file in the bucket under a key derived from its SHA-256,
+// or reuses the object already stored for identical content, and takes a
+// reference on it. Pair every call with releaseObject.
+func (cfg *apiConfig) storeObject(ctx context.Context, prefix, extension, filePath, contentType string) (string, error) {
+	hash, size, err := hashFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// Take the reference before uploading so a concurrent release of the same
+	// content can't delete the object out from under us.
+	blob, created, err := cfg.db.AddBlobReference(ctx, database.CreateBlobParams{
+		Hash:      hash,
+		ObjectKey: fmt.Sprintf("%s/%s.%s", prefix, hash, extension),
+		Size:      size,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !created {
+		// Whoever recorded the blob may still be uploading it, or may have
+		// failed to. Putting the same bytes under the same key is harmless.
+		exists, err := cfg.objectExists(ctx, blob.ObjectKey)
+		if err != nil {
+			cfg.releaseObject(ctx, blob.ObjectKey)
+			return "", err
+		}
+		if exists {
+			return blob.ObjectKey, nil
+		}
+	}
+
+	err = cfg.putObject(ctx, blob.ObjectKey, filePath, contentType, hash)
+	if err != nil {
+		cfg.releaseObject(ctx, blob.ObjectKey)
+		return "", err
+	}
+	return blob.ObjectKey, nil
+}
+
+// releaseObject drops a reference taken by storeObject and deletes the object
+// once nothing points at it.
+func (cfg *apiConfig) releaseObject(ctx context.Context, key string) error {
+	_, err := cfg.db.ReleaseBlob(ctx, key, cfg.deleteObject)
+	if err != nil {
+		return fmt.Errorf("unable to release object %s: %w", key, err)
+	}
+	return nil
+}
+
+// releaseObjectURL releases the object behind a video_url or audio_url. URLs
+// that don't point into the bucket are left alone.
+func (cfg *apiConfig) releaseObjectURL(ctx context.Context, objectURL *string) error {
+	if objectURL == nil {
+		return nil
+	}
+	key, ok := cfg.getObjectKey(*objectURL)
+	if !ok {
+		return nil
+	}
+	return cfg.releaseObject(ctx, key)
+}
+
+// releaseVersionParamsObjects drops the references taken for a version that
+// couldn't be recorded.
+func (cfg *apiConfig) releaseVersionParamsObjects(ctx context.Context, params database.CreateVideoVersionParams) {
+	cfg.releaseVideoVersionObjects(ctx, []database.VideoVersion{{CreateVideoVersionParams: params}})
+}
+
+// releaseVideoVersionObjects drops the references every version of a video
+// holds on its bucket objects. Failures are logged so one bad object doesn't
+// keep the rest around.
+func (cfg *apiConfig) releaseVideoVersionObjects(ctx context.Context, versions []database.VideoVersion) {
+	for _, version := range versions {
+		objectKeys := []string{}
+		for _, objectURL := range []*string{&version.VideoURL, version.AudioURL} {
+			if objectURL == nil {
+				continue
+			}
+			if key, ok := cfg.getObjectKey(*objectURL); ok {
+				objectKeys = append(objectKeys, key)
+			}
+		}
+		if version.SourceKey != nil {
+			objectKeys = append(objectKeys, *version.SourceKey)
+		}
+
+		for _, key := range objectKeys {
+			err := cfg.releaseObject(ctx, key)
+			if err != nil {
+				log.Printf("Couldn't release %s for video %s version %d: %v", key, version.VideoID, version.Version, err)
+			}
+		}
+	}
+}
+
+func hashFile(filePath string) (string, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to open %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to hash %s: %w", filePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// putObject uploads a file along with its SHA-256 so S3 rejects the upload if
+// the bytes it received don't match what we hashed.
+func (cfg *apiConfig) putObject(ctx context.Context, key, filePath, contentType, sha256Hex string) error {
+	checksum, err := sha256HexToBase64(sha256Hex)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:            &cfg.s3Bucket,
+		Key:               &key,
+		Body:              file,
+		ContentType:       &contentType,
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    &checksum,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to put object %s: %w", key, err)
+	}
+	return nil
+}
+
+// sha256HexToBase64 converts our stored hex digests into the base64 form S3
+// uses for checksum headers.
+func sha256HexToBase64(sha256Hex string) (string, error) {
+	digest, err := hex.DecodeString(sha256Hex)
+	if err != nil || len(digest) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 digest %q", sha256Hex)
+	}
+	return base64.StdEncoding.EncodeToString(digest), nil
+}
+
+func (cfg *apiConfig) getObjectURL(key string) string {
+	return fmt.Sprintf("%s/%s", cfg.s3CfDistribution, key)
+}
+
+// getObjectKey maps a video_url back to the bucket key it was served from.
+func (cfg *apiConfig) getObjectKey(objectURL string) (string, bool) {
+	return strings.CutPrefix(objectURL, cfg.s3CfDistribution+"/")
+}
+
+// downloadObject copies an object from the bucket into a temp file. The caller
+// is responsible for removing the file.
+func (cfg *apiConfig) downloadObject(ctx context.Context, key string) (string, error) {
+	output, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to get object %s: %w", key, err)
+	}
+	defer output.Body.Close()
+
+	tempFile, err := os.CreateTemp("", "tubely-source-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	_, err = io.Copy(tempFile, output.Body)
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("unable to download object %s: %w", key, err)
+	}
+
+	return tempFile.Name(), nil
+}
+
+// objectExists reports whether key is in the bucket.
+func (cfg *apiConfig) objectExists(ctx context.Context, key string) (bool, error) {
+	_, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to head object %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (cfg *apiConfig) deleteObject(ctx context.Context, key string) error {
+	_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete object %s: %w", key, err)
+	}
+	return nil
+}
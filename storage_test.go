@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// fakeBucket is an in-memory S3 bucket served over HTTP, enough for the
+// PutObject, HeadObject, GetObject and DeleteObject calls the API makes.
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+// useFakeBucket points cfg's S3 client at a new fakeBucket.
+func useFakeBucket(t *testing.T, cfg *apiConfig) *fakeBucket {
+	t.Helper()
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+
+	cfg.s3Bucket = "tubely-test"
+	cfg.s3CfDistribution = "https://cdn.example.com"
+	cfg.s3Client = s3.New(s3.Options{
+		Region:       "us-east-2",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   server.Client(),
+	})
+	return bucket
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b.objects[key] = data
+		b.puts++
+	case http.MethodHead:
+		data, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	case http.MethodGet:
+		data, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (b *fakeBucket) putCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.puts
+}
+
+func (b *fakeBucket) object(key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[key]
+	return data, ok
+}
+
+func (b *fakeBucket) keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := []string{}
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestStoreObjectDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	bucket := useFakeBucket(t, cfg)
+	writeFile := func(content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "video.mp4")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	first, err := cfg.storeObject(ctx, "landscape", "mp4", writeFile("footage"), "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Identical content shares the object, whatever prefix it's stored under.
+	second, err := cfg.storeObject(ctx, "source", "mp4", writeFile("footage"), "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || bucket.putCount() != 1 {
+		t.Fatalf("identical content stored as %s and %s with %d puts", first, second, bucket.putCount())
+	}
+	other, err := cfg.storeObject(ctx, "landscape", "mp4", writeFile("other footage"), "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Fatalf("different content shares %s", other)
+	}
+
+	blob, err := cfg.db.GetBlob(ctx, strings.TrimSuffix(strings.TrimPrefix(first, "landscape/"), ".mp4"))
+	if err != nil || blob.RefCount != 2 || blob.Size != int64(len("footage")) {
+		t.Fatalf("blob = %+v, %v", blob, err)
+	}
+
+	// The object stays until its last reference is released.
+	if err := cfg.releaseObject(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := bucket.object(first); !ok || string(data) != "footage" {
+		t.Fatalf("object went with a reference left: %q, %v", data, ok)
+	}
+	if err := cfg.releaseObject(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bucket.object(first); ok {
+		t.Fatalf("%s is still in the bucket", first)
+	}
+	if _, err := cfg.db.GetBlob(ctx, blob.Hash); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("blob row left behind: %v", err)
+	}
+	if _, ok := bucket.object(other); !ok {
+		t.Errorf("releasing %s removed %s", first, other)
+	}
+
+	// Storing the content again uploads it afresh.
+	again, err := cfg.storeObject(ctx, "landscape", "mp4", writeFile("footage"), "video/mp4")
+	if err != nil || again != first {
+		t.Fatalf("storeObject after release = %s, %v", again, err)
+	}
+	if _, ok := bucket.object(again); !ok {
+		t.Errorf("%s wasn't uploaded again", again)
+	}
+}
+
+func TestStoreObjectReuploadsMissingObject(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	bucket := useFakeBucket(t, cfg)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("footage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A blob recorded by an upload that never finished.
+	hash, size, err := hashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = cfg.db.AddBlobReference(ctx, database.CreateBlobParams{Hash: hash, ObjectKey: "landscape/" + hash + ".mp4", Size: size})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := cfg.storeObject(ctx, "landscape", "mp4", path, "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := bucket.object(key); !ok || string(data) != "footage" {
+		t.Errorf("missing object wasn't uploaded: %q, %v", data, ok)
+	}
+	if blob, err := cfg.db.GetBlob(ctx, hash); err != nil || blob.RefCount != 2 {
+		t.Errorf("blob = %+v, %v", blob, err)
+	}
+}
+
+func TestReleaseObjectWithoutBlob(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestAPIConfig()
+	bucket := useFakeBucket(t, cfg)
+	bucket.objects["landscape/legacy.mp4"] = []byte("footage")
+
+	// Objects stored before deduplication have no blob row and go straight
+	// away.
+	if err := cfg.releaseObject(ctx, "landscape/legacy.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bucket.object("landscape/legacy.mp4"); ok {
+		t.Error("legacy object is still in the bucket")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type subtitleCue struct {
+	ID       string
+	Start    time.Duration
+	End      time.Duration
+	Settings string
+	Text     []string
+}
+
+var subtitleLanguagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+var errNoSubtitleCues = errors.New("subtitle file contains no cues")
+
+func isWebVTT(data []byte) bool {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	return text == "WEBVTT" || strings.HasPrefix(text, "WEBVTT\n") || strings.HasPrefix(text, "WEBVTT\r\n") ||
+		strings.HasPrefix(text, "WEBVTT ") || strings.HasPrefix(text, "WEBVTT\t")
+}
+
+// convertSubtitlesToWebVTT validates an SRT or WebVTT file and returns it as WebVTT.
+// WebVTT input is kept as-is (apart from line endings) so styles and notes survive.
+func convertSubtitlesToWebVTT(data []byte) ([]byte, error) {
+	if isWebVTT(data) {
+		_, err := parseWebVTT(data)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(normalizeSubtitleText(data)), nil
+	}
+
+	cues, err := parseSRT(data)
+	if err != nil {
+		return nil, err
+	}
+	return formatWebVTT(cues), nil
+}
+
+func normalizeSubtitleText(data []byte) string {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+// splitSubtitleBlocks splits the file into blank-line separated blocks, remembering
+// the line each block starts on for error messages.
+func splitSubtitleBlocks(text string) ([][]string, []int) {
+	blocks := [][]string{}
+	starts := []int{}
+	current := []string{}
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, current)
+				current = []string{}
+			}
+			continue
+		}
+		if len(current) == 0 {
+			starts = append(starts, i+1)
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+	return blocks, starts
+}
+
+func parseSRT(data []byte) ([]subtitleCue, error) {
+	blocks, starts := splitSubtitleBlocks(normalizeSubtitleText(data))
+
+	cues := []subtitleCue{}
+	for i, block := range blocks {
+		lineNumber := starts[i]
+		if !strings.Contains(block[0], "-->") {
+			if _, err := strconv.Atoi(strings.TrimSpace(block[0])); err != nil {
+				return nil, fmt.Errorf("line %d: expected cue number, got %q", lineNumber, block[0])
+			}
+			block = block[1:]
+			lineNumber++
+		}
+		if len(block) == 0 {
+			return nil, fmt.Errorf("line %d: cue is missing its timing line", lineNumber)
+		}
+
+		cue, err := parseCueTiming(block[0], parseSRTTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		// SRT coordinates aren't valid WebVTT cue settings, so they are dropped.
+		cue.Settings = ""
+		cue.Text = block[1:]
+		if len(cue.Text) == 0 {
+			return nil, fmt.Errorf("line %d: cue has no text", lineNumber)
+		}
+		cues = append(cues, cue)
+	}
+
+	if len(cues) == 0 {
+		return nil, errNoSubtitleCues
+	}
+	return cues, nil
+}
+
+func parseWebVTT(data []byte) ([]subtitleCue, error) {
+	blocks, starts := splitSubtitleBlocks(normalizeSubtitleText(data))
+	if len(blocks) == 0 || !strings.HasPrefix(blocks[0][0], "WEBVTT") {
+		return nil, errors.New("missing WEBVTT header")
+	}
+
+	cues := []subtitleCue{}
+	for i, block := range blocks[1:] {
+		lineNumber := starts[i+1]
+		if strings.HasPrefix(block[0], "NOTE") || block[0] == "STYLE" || block[0] == "REGION" {
+			continue
+		}
+
+		id := ""
+		if !strings.Contains(block[0], "-->") {
+			id = block[0]
+			block = block[1:]
+			lineNumber++
+		}
+		if len(block) == 0 {
+			return nil, fmt.Errorf("line %d: cue is missing its timing line", lineNumber)
+		}
+
+		cue, err := parseCueTiming(block[0], parseWebVTTTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		cue.ID = id
+		cue.Text = block[1:]
+		cues = append(cues, cue)
+	}
+
+	if len(cues) == 0 {
+		return nil, errNoSubtitleCues
+	}
+	return cues, nil
+}
+
+func parseCueTiming(line string, parseTimestamp func(string) (time.Duration, error)) (subtitleCue, error) {
+	startText, rest, found := strings.Cut(line, "-->")
+	if !found {
+		return subtitleCue{}, fmt.Errorf("invalid timing line %q", line)
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return subtitleCue{}, fmt.Errorf("invalid timing line %q", line)
+	}
+
+	start, err := parseTimestamp(strings.TrimSpace(startText))
+	if err != nil {
+		return subtitleCue{}, err
+	}
+	end, err := parseTimestamp(fields[0])
+	if err != nil {
+		return subtitleCue{}, err
+	}
+	if end <= start {
+		return subtitleCue{}, fmt.Errorf("cue ends before it starts: %q", line)
+	}
+
+	return subtitleCue{
+		Start:    start,
+		End:      end,
+		Settings: strings.Join(fields[1:], " "),
+	}, nil
+}
+
+// parseSRTTimestamp parses HH:MM:SS,mmm. A '.' separator is accepted too since
+// plenty of SRT files in the wild use it.
+func parseSRTTimestamp(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	return parseTimestampParts(value, parts[0], parts[1], strings.Replace(parts[2], ",", ".", 1))
+}
+
+// parseWebVTTTimestamp parses [HH:]MM:SS.mmm.
+func parseWebVTTTimestamp(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	switch len(parts) {
+	case 2:
+		return parseTimestampParts(value, "0", parts[0], parts[1])
+	case 3:
+		return parseTimestampParts(value, parts[0], parts[1], parts[2])
+	default:
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+}
+
+func parseTimestampParts(value, hoursText, minutesText, secondsText string) (time.Duration, error) {
+	secondsWhole, millisText, found := strings.Cut(secondsText, ".")
+	if !found || len(millisText) != 3 || len(secondsWhole) != 2 || len(minutesText) != 2 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	hours, err := strconv.Atoi(hoursText)
+	if err != nil || hours < 0 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	minutes, err := strconv.Atoi(minutesText)
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	seconds, err := strconv.Atoi(secondsWhole)
+	if err != nil || seconds < 0 || seconds > 59 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	millis, err := strconv.Atoi(millisText)
+	if err != nil || millis < 0 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(millis)*time.Millisecond, nil
+}
+
+func formatWebVTTTimestamp(d time.Duration) string {
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+	d -= seconds * time.Second
+	millis := d / time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, seconds, millis)
+}
+
+func formatWebVTT(cues []subtitleCue) []byte {
+	var builder strings.Builder
+	builder.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		builder.WriteString("\n")
+		if cue.ID != "" {
+			builder.WriteString(cue.ID + "\n")
+		}
+		builder.WriteString(formatWebVTTTimestamp(cue.Start) + " --> " + formatWebVTTTimestamp(cue.End))
+		if cue.Settings != "" {
+			builder.WriteString(" " + cue.Settings)
+		}
+		builder.WriteString("\n")
+		for _, line := range cue.Text {
+			builder.WriteString(line + "\n")
+		}
+	}
+	return []byte(builder.String())
+}
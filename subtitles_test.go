@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConvertSubtitles_SRT(t *testing.T) {
+	input := "1\r\n00:00:01,000 --> 00:00:04,250\r\nHello there\r\n\r\n2\r\n00:01:05,500 --> 00:01:07,000\r\nGeneral Kenobi\r\nYou are a bold one\r\n"
+	expected := "WEBVTT\n\n00:00:01.000 --> 00:00:04.250\nHello there\n\n00:01:05.500 --> 00:01:07.000\nGeneral Kenobi\nYou are a bold one\n"
+
+	result, err := convertSubtitlesToWebVTT([]byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(result) != expected {
+		t.Errorf("Expected: %q\n Received: %q\n", expected, string(result))
+	}
+}
+
+func TestConvertSubtitles_WebVTTPassthrough(t *testing.T) {
+	input := "WEBVTT\n\nNOTE a comment\n\nintro\n00:01.000 --> 00:04.000 align:start\nHello\n"
+
+	result, err := convertSubtitlesToWebVTT([]byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(result) != input {
+		t.Errorf("Expected: %q\n Received: %q\n", input, string(result))
+	}
+}
+
+func TestConvertSubtitles_Invalid(t *testing.T) {
+	inputs := map[string]string{
+		"empty":          "",
+		"bad timestamp":  "1\n00:00:01 --> 00:00:04,000\nHello\n",
+		"end before":     "1\n00:00:04,000 --> 00:00:01,000\nHello\n",
+		"missing text":   "1\n00:00:01,000 --> 00:00:04,000\n",
+		"vtt no cues":    "WEBVTT\n\nNOTE nothing here\n",
+		"vtt bad timing": "WEBVTT\n\n00:01.000 -> 00:04.000\nHello\n",
+	}
+
+	for name, input := range inputs {
+		_, err := convertSubtitlesToWebVTT([]byte(input))
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
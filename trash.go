@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type trashSettings struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+// loadTrashSettings reads how long deleted videos stay restorable
+// (TRASH_RETENTION, default 30 days) and how often the purge runs
+// (TRASH_PURGE_INTERVAL, default hourly).
+func loadTrashSettings() (trashSettings, error) {
+	settings := trashSettings{
+		Retention:     30 * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+	for name, value := range map[string]*time.Duration{
+		"TRASH_RETENTION":      &settings.Retention,
+		"TRASH_PURGE_INTERVAL": &settings.PurgeInterval,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			duration, err := time.ParseDuration(raw)
+			if err != nil || duration <= 0 {
+				return trashSettings{}, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*value = duration
+		}
+	}
+	return settings, nil
+}
+
+// purgeTrashPeriodically runs purgeTrash until ctx is done.
+func (cfg *apiConfig) purgeTrashPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(cfg.trash.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		err := cfg.purgeTrash(ctx, time.Now().Add(-cfg.trash.Retention))
+		if err != nil {
+			log.Printf("Couldn't purge trash: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash permanently deletes videos trashed before cutoff along with
+// their subtitle files, thumbnail and bucket objects.
+func (cfg *apiConfig) purgeTrash(ctx context.Context, cutoff time.Time) error {
+	videos, err := cfg.db.GetVideosTrashedBefore(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, video := range videos {
+		err := cfg.purgeVideo(ctx, video.ID, cutoff)
+		if err != nil {
+			log.Printf("Couldn't purge video %s: %v", video.ID, err)
+		}
+	}
+	return nil
+}
+
+// purgeVideo deletes the video if it is still trashed, then removes its
+// files and releases its objects. A video restored since it was listed is
+// left alone.
+func (cfg *apiConfig) purgeVideo(ctx context.Context, videoID uuid.UUID, cutoff time.Time) error {
+	video, versions, err := cfg.db.PurgeTrashedVideo(ctx, videoID, cutoff)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, track := range video.Subtitles {
+		os.Remove(track.FilePath)
+	}
+	if video.ThumbnailURL != nil {
+		if assetPath, ok := cfg.getAssetPathFromURL(*video.ThumbnailURL); ok {
+			os.Remove(cfg.getAssetDiskPath(assetPath))
+		}
+	}
+	cfg.releaseVideoVersionObjects(ctx, versions)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
+)
+
+const (
+	trimModeCopy     = "copy"
+	trimModeReencode = "reencode"
+)
+
+// parseClipTimestamp accepts plain seconds ("90.5") as well as MM:SS and
+// HH:MM:SS with optional fractional seconds ("01:30", "00:01:30.500").
+func parseClipTimestamp(value string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 || (len(parts) > 1 && seconds >= 60) {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	total := seconds
+
+	multiplier := 60.0
+	for i := len(parts) - 2; i >= 0; i-- {
+		unit, err := strconv.Atoi(parts[i])
+		if err != nil || unit < 0 || (i > 0 && unit >= 60) {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		total += float64(unit) * multiplier
+		multiplier *= 60
+	}
+
+	return time.Duration(total * float64(time.Second)), nil
+}
+
+func formatFFmpegDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// trimVideo cuts [start, end) out of the input. Copy mode seeks on the input so
+// the cut snaps to the nearest keyframe but avoids a re-encode; reencode mode is
+// frame accurate at the cost of transcoding.
+func trimVideo(ctx context.Context, runner ffmpeg.Runner, filepath string, start, end time.Duration, mode string) (string, error) {
+	outputFilepath := fmt.Sprintf("%s.trimmed", filepath)
+
+	args := []string{"-y", "-ss", formatFFmpegDuration(start), "-i", filepath, "-t", formatFFmpegDuration(end - start)}
+	switch mode {
+	case trimModeCopy:
+		args = append(args, "-c", "copy", "-avoid_negative_ts", "make_zero")
+	case trimModeReencode:
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-c:a", "aac")
+	default:
+		return "", fmt.Errorf("unknown trim mode %q", mode)
+	}
+	args = append(args, "-f", "mp4", outputFilepath)
+
+	_, err := runner.Run(ctx, "ffmpeg", args...)
+	if err != nil {
+		return "", fmt.Errorf("unable to trim %s: %w", filepath, err)
+	}
+
+	return outputFilepath, nil
+}
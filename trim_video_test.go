@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClipTimestamp(t *testing.T) {
+	cases := map[string]time.Duration{
+		"0":            0,
+		"90.5":         90*time.Second + 500*time.Millisecond,
+		"01:30":        90 * time.Second,
+		"00:01:30.250": 90*time.Second + 250*time.Millisecond,
+		"1:00:00":      time.Hour,
+	}
+
+	for input, expected := range cases {
+		result, err := parseClipTimestamp(input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", input, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("%s: Expected: %s\n Received: %s\n", input, expected, result)
+		}
+	}
+
+	for _, input := range []string{"", "-1", "abc", "01:75", "1:2:3:4"} {
+		if _, err := parseClipTimestamp(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+var errMissingFormFile = errors.New("missing form file")
+
+type receivedFile struct {
+	FilePath    string
+	ContentType string
+	Size        int64
+	SHA256      string
+}
+
+// contextReader stops reading as soon as ctx is done, so a client that hangs
+// up mid-upload doesn't leave us copying whatever is still buffered.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// receiveMultipartFile streams the named file part of a multipart request into
+// a temp file, hashing it on the way. Callers should wrap r.Body with
+// http.MaxBytesReader first; an oversized body surfaces as *http.MaxBytesError.
+// On success the caller owns the temp file and must remove it.
+func receiveMultipartFile(r *http.Request, fieldName string) (receivedFile, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return receivedFile{}, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return receivedFile{}, errMissingFormFile
+		}
+		if err != nil {
+			return receivedFile{}, err
+		}
+		if part.FormName() != fieldName || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		tempFile, err := os.CreateTemp("", "tubely-upload-*.mp4")
+		if err != nil {
+			return receivedFile{}, err
+		}
+		defer tempFile.Close()
+
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(tempFile, hash), contextReader{ctx: r.Context(), r: part})
+		if err == nil {
+			err = tempFile.Close()
+		}
+		if err != nil {
+			os.Remove(tempFile.Name())
+			return receivedFile{}, err
+		}
+
+		return receivedFile{
+			FilePath:    tempFile.Name(),
+			ContentType: part.Header.Get("Content-Type"),
+			Size:        size,
+			SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		}, nil
+	}
+}
+
+// respondToUploadError maps receiveMultipartFile errors onto responses. Nothing
+// is written when the client has already gone away.
+func respondToUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case r.Context().Err() != nil:
+		return
+	case errors.As(err, &maxBytesErr):
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload is larger than %d bytes", maxBytesErr.Limit), err)
+	case errors.Is(err, errMissingFormFile):
+		respondWithError(w, http.StatusBadRequest, "Could not get video file", err)
+	default:
+		respondWithError(w, http.StatusBadRequest, "Unable to read the upload", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newMultipartRequest(t *testing.T, fieldName string, content []byte) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("title", "ignored")
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+fieldName+`"; filename="clip.mp4"`)
+	header.Set("Content-Type", "video/mp4")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/video_upload/1", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestReceiveMultipartFile(t *testing.T) {
+	content := []byte(strings.Repeat("video bytes ", 1000))
+	req := newMultipartRequest(t, "video", content)
+
+	upload, err := receiveMultipartFile(req, "video")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(upload.FilePath)
+
+	sum := sha256.Sum256(content)
+	if upload.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected hash %s", upload.SHA256)
+	}
+	if upload.Size != int64(len(content)) || upload.ContentType != "video/mp4" {
+		t.Errorf("unexpected upload %+v", upload)
+	}
+	stored, err := os.ReadFile(upload.FilePath)
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Errorf("temp file doesn't hold the upload: %v", err)
+	}
+}
+
+func TestReceiveMultipartFile_MissingField(t *testing.T) {
+	req := newMultipartRequest(t, "thumbnail", []byte("data"))
+
+	_, err := receiveMultipartFile(req, "video")
+	if !errors.Is(err, errMissingFormFile) {
+		t.Fatalf("expected errMissingFormFile, got %v", err)
+	}
+}
+
+func TestReceiveMultipartFile_TooLarge(t *testing.T) {
+	req := newMultipartRequest(t, "video", bytes.Repeat([]byte("x"), 4096))
+	req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, 1024)
+
+	_, err := receiveMultipartFile(req, "video")
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		t.Fatalf("expected *http.MaxBytesError, got %v", err)
+	}
+}
+
+func TestReceiveMultipartFile_ClientGone(t *testing.T) {
+	req := newMultipartRequest(t, "video", []byte("data"))
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	req = req.WithContext(ctx)
+
+	_, err := receiveMultipartFile(req, "video")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// processedVideo is the output of processVideo. Everything it points at lives in
+// temp files that cleanup removes.
+type processedVideo struct {
+	FilePath          string
+	AspectRatio       string
+	Duration          time.Duration
+	AudioFilePath     string
+	StoredBytes       int64
+	SuggestedChapters []chapterMarker
+	tempFiles         []string
+}
+
+func (p *processedVideo) cleanup() {
+	for _, path := range p.tempFiles {
+		os.Remove(path)
+	}
+}
+
+// processVideo runs the configured processing stages over inputPath: watermark,
+// loudness normalization, chapter detection, fast start and the audio-only
+// rendition. chapters are embedded in the output; when there are none and
+// detection is enabled, suggested chapters are embedded and returned instead.
+// The input file itself is left alone.
+func (cfg *apiConfig) processVideo(ctx context.Context, inputPath string, watermark *watermarkSettings, chapters []chapterMarker) (processedVideo, error) {
+	processed := processedVideo{}
+	currentPath := inputPath
+
+	if watermark != nil {
+		watermarkedPath, err := applyWatermark(ctx, cfg.ffmpeg, currentPath, *watermark)
+		if err != nil {
+			return processed, err
+		}
+		processed.tempFiles = append(processed.tempFiles, watermarkedPath)
+		currentPath = watermarkedPath
+	}
+
+	hasAudio := false
+	if cfg.loudnorm != nil || cfg.audioRendition != nil {
+		var err error
+		hasAudio, err = hasAudioStream(ctx, cfg.ffmpeg, currentPath)
+		if err != nil {
+			processed.cleanup()
+			return processedVideo{}, err
+		}
+	}
+
+	if cfg.loudnorm != nil && hasAudio {
+		normalizedPath, err := normalizeLoudness(ctx, cfg.ffmpeg, currentPath, *cfg.loudnorm)
+		if err != nil {
+			processed.cleanup()
+			return processedVideo{}, err
+		}
+		processed.tempFiles = append(processed.tempFiles, normalizedPath)
+		currentPath = normalizedPath
+	}
+
+	duration, err := getVideoDuration(ctx, cfg.ffmpeg, currentPath)
+	if err != nil {
+		processed.cleanup()
+		return processedVideo{}, err
+	}
+	processed.Duration = duration
+
+	if len(chapters) == 0 && cfg.chapterDetection != nil {
+		sceneChanges, err := detectSceneChanges(ctx, cfg.ffmpeg, currentPath, cfg.chapterDetection.Threshold)
+		if err != nil {
+			processed.cleanup()
+			return processedVideo{}, err
+		}
+		processed.SuggestedChapters = suggestChapters(sceneChanges, duration, cfg.chapterDetection.MinLength)
+		chapters = processed.SuggestedChapters
+	}
+
+	chapterMetadataPath := ""
+	if len(chapters) > 0 {
+		chapterMetadataPath, err = writeChapterMetadata(chapters, duration)
+		if err != nil {
+			processed.cleanup()
+			return processedVideo{}, err
+		}
+		processed.tempFiles = append(processed.tempFiles, chapterMetadataPath)
+	}
+
+	fastStartPath, err := processVideoForFastStart(ctx, cfg.ffmpeg, currentPath, chapterMetadataPath)
+	if err != nil {
+		processed.cleanup()
+		return processedVideo{}, err
+	}
+	processed.tempFiles = append(processed.tempFiles, fastStartPath)
+	processed.FilePath = fastStartPath
+
+	processed.AspectRatio, err = getVideoAspectRatio(ctx, cfg.ffmpeg, fastStartPath)
+	if err != nil {
+		processed.cleanup()
+		return processedVideo{}, err
+	}
+
+	if cfg.audioRendition != nil && hasAudio {
+		audioPath, err := extractAudio(ctx, cfg.ffmpeg, fastStartPath, *cfg.audioRendition)
+		if err != nil {
+			processed.cleanup()
+			return processedVideo{}, err
+		}
+		processed.tempFiles = append(processed.tempFiles, audioPath)
+		processed.AudioFilePath = audioPath
+	}
+
+	for _, outputPath := range []string{processed.FilePath, processed.AudioFilePath} {
+		if outputPath == "" {
+			continue
+		}
+		info, err := os.Stat(outputPath)
+		if err != nil {
+			processed.cleanup()
+			return processedVideo{}, err
+		}
+		processed.StoredBytes += info.Size()
+	}
+
+	return processed, nil
+}
+
+// publishProcessedVideo uploads the renditions of a processed video and points
+// the video's URLs at them. It doesn't save the video.
+func (cfg *apiConfig) publishProcessedVideo(ctx context.Context, video *database.Video, processed processedVideo) error {
+	videoKey, videoURL, err := cfg.uploadVideoObject(ctx, processed.FilePath, processed.AspectRatio, "video/mp4")
+	if err != nil {
+		return err
+	}
+
+	var audioURL *string
+	if processed.AudioFilePath != "" {
+		key, err := cfg.storeObject(ctx, "audio", cfg.audioRendition.Extension, processed.AudioFilePath, cfg.audioRendition.ContentType)
+		if err != nil {
+			cfg.releaseObject(ctx, videoKey)
+			return err
+		}
+		url := cfg.getObjectURL(key)
+		audioURL = &url
+	}
+
+	durationSeconds := processed.Duration.Seconds()
+	video.VideoURL = &videoURL
+	video.AudioURL = audioURL
+	video.Duration = &durationSeconds
+	return nil
+}
+
+// newVideoVersionParams describes the renditions publishProcessedVideo just put
+// on video. storedBytes is everything the version keeps in the bucket,
+// including a retained source.
+func newVideoVersionParams(video database.Video, processed processedVideo, uploadedBy uuid.UUID, source string, storedBytes int64) database.CreateVideoVersionParams {
+	return database.CreateVideoVersionParams{
+		VideoID:     video.ID,
+		UploadedBy:  uploadedBy,
+		Source:      source,
+		VideoURL:    *video.VideoURL,
+		AudioURL:    video.AudioURL,
+		SourceKey:   video.SourceKey,
+		Duration:    video.Duration,
+		AspectRatio: processed.AspectRatio,
+		StoredBytes: storedBytes,
+	}
+}
+
+// addVideoVersion records a new version, makes it current and saves the video,
+// all in one transaction. Earlier versions keep their objects so the video can
+// be rolled back to them.
+func (cfg *apiConfig) addVideoVersion(ctx context.Context, video *database.Video, params database.CreateVideoVersionParams) error {
+	return cfg.db.WithTx(ctx, func(tx database.Store) error {
+		return createCurrentVersion(ctx, tx, video, params)
+	})
+}
+
+func createCurrentVersion(ctx context.Context, tx database.Store, video *database.Video, params database.CreateVideoVersionParams) error {
+	version, err := tx.CreateVideoVersion(ctx, params)
+	if err != nil {
+		return err
+	}
+	video.CurrentVersionID = &version.ID
+	video.VideoBytes += version.StoredBytes
+	return tx.UpdateVideo(ctx, *video)
+}
+
+// replaceCurrentVersion overwrites the current version with new renditions and
+// saves the video, for edits that shouldn't add to the history. The version
+// keeps its source and upload hash unless params sets them. The caller releases
+// the objects the old renditions used.
+func (cfg *apiConfig) replaceCurrentVersion(ctx context.Context, video *database.Video, params database.CreateVideoVersionParams) error {
+	return cfg.db.WithTx(ctx, func(tx database.Store) error {
+		if video.CurrentVersionID == nil {
+			return createCurrentVersion(ctx, tx, video, params)
+		}
+		version, err := tx.GetVideoVersion(ctx, *video.CurrentVersionID)
+		if errors.Is(err, database.ErrNotFound) {
+			return createCurrentVersion(ctx, tx, video, params)
+		}
+		if err != nil {
+			return err
+		}
+
+		previousBytes := version.StoredBytes
+		params.VideoID = version.VideoID
+		params.UploadedBy = version.UploadedBy
+		if params.Source == "" {
+			params.Source = version.Source
+		}
+		if params.ContentSHA256 == nil {
+			params.ContentSHA256 = version.ContentSHA256
+		}
+		version.CreateVideoVersionParams = params
+		err = tx.UpdateVideoVersion(ctx, version)
+		if err != nil {
+			return err
+		}
+		video.VideoBytes += version.StoredBytes - previousBytes
+		return tx.UpdateVideo(ctx, *video)
+	})
+}
+
+// applyVideoVersion points the video at a version's renditions.
+func applyVideoVersion(video *database.Video, version database.VideoVersion) {
+	videoURL := version.VideoURL
+	video.VideoURL = &videoURL
+	video.AudioURL = version.AudioURL
+	video.SourceKey = version.SourceKey
+	video.Duration = version.Duration
+	video.CurrentVersionID = &version.ID
+}
+
+// getManualChapterMarkers returns the chapters a user entered for a video, which
+// take precedence over detected ones when processing.
+func (cfg *apiConfig) getManualChapterMarkers(ctx context.Context, video database.Video) ([]chapterMarker, error) {
+	chapters, err := cfg.db.GetChapters(ctx, video.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	manual := []database.Chapter{}
+	for _, chapter := range chapters {
+		if chapter.Source == database.ChapterSourceManual {
+			manual = append(manual, chapter)
+		}
+	}
+	return chapterMarkersFromDatabase(manual), nil
+}
+
+// saveSuggestedChapters stores detected chapters, replacing older suggestions.
+func (cfg *apiConfig) saveSuggestedChapters(ctx context.Context, video database.Video, processed processedVideo) error {
+	if len(processed.SuggestedChapters) == 0 {
+		return nil
+	}
+	_, err := cfg.db.ReplaceChapters(ctx, video.ID, chapterParamsFromMarkers(processed.SuggestedChapters, database.ChapterSourceSuggested))
+	return err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
+)
+
+const fakeLoudnormMeasurement = `{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"target_offset" : "0.58"
+}`
+
+// newFakeMediaRunner stands in for ffmpeg and ffprobe on a 10 second 16:9
+// video with an audio track. ffmpeg writes its output file, holding the first
+// input's bytes plus the output's extension, so later stages and uploads find
+// something content dependent.
+func newFakeMediaRunner() *ffmpeg.FakeRunner {
+	return &ffmpeg.FakeRunner{
+		Handler: func(ctx context.Context, name string, args []string) (ffmpeg.Result, error) {
+			if name == "ffprobe" {
+				switch {
+				case slices.Contains(args, "-show_format"):
+					return ffmpeg.Result{Stdout: []byte(`{"format":{"duration":"10.000000"}}`)}, nil
+				case slices.Contains(args, "a"):
+					return ffmpeg.Result{Stdout: []byte(`{"streams":[{"index":1}]}`)}, nil
+				default:
+					return ffmpeg.Result{Stdout: []byte(`{"streams":[{"width":1920,"height":1080}]}`)}, nil
+				}
+			}
+
+			outputPath := args[len(args)-1]
+			if outputPath == "-" {
+				return ffmpeg.Result{Stderr: []byte("[Parsed_loudnorm_0 @ 0x5581]\n" + fakeLoudnormMeasurement + "\n")}, nil
+			}
+			inputPath := args[slices.Index(args, "-i")+1]
+			input, err := os.ReadFile(inputPath)
+			if err != nil {
+				return ffmpeg.Result{}, fmt.Errorf("fake %s: %w", name, err)
+			}
+			output := append(input, filepath.Ext(outputPath)...)
+			return ffmpeg.Result{}, os.WriteFile(outputPath, output, 0600)
+		},
+	}
+}
+
+// publishTestVideo processes content and publishes it as a new version of
+// video, the way an upload does.
+func publishTestVideo(t *testing.T, cfg *apiConfig, video *database.Video, content string) {
+	t.Helper()
+	ctx := context.Background()
+	inputPath := filepath.Join(t.TempDir(), "upload.mp4")
+	err := os.WriteFile(inputPath, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processed, err := cfg.processVideo(ctx, inputPath, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processed.cleanup()
+	err = cfg.publishProcessedVideo(ctx, video, processed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.addVideoVersion(ctx, video, newVideoVersionParams(*video, processed, video.UserID, database.VideoVersionSourceUpload, processed.StoredBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findCall returns the first call whose arguments include all of want, in
+// order but not necessarily adjacent.
+func findCall(calls []ffmpeg.Call, name string, want ...string) (ffmpeg.Call, bool) {
+	for _, call := range calls {
+		if call.Name != name {
+			continue
+		}
+		rest, found := call.Args, true
+		for _, arg := range want {
+			i := slices.Index(rest, arg)
+			if i == -1 {
+				found = false
+				break
+			}
+			rest = rest[i+1:]
+		}
+		if found {
+			return call, true
+		}
+	}
+	return ffmpeg.Call{}, false
+}
+
+func formatCalls(calls []ffmpeg.Call) string {
+	lines := []string{}
+	for _, call := range calls {
+		lines = append(lines, call.Name+" "+strings.Join(call.Args, " "))
+	}
+	return strings.Join(lines, "\n")
+}
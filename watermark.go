@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ffmpeg"
+	"github.com/google/uuid"
+)
+
+type watermarkSettings struct {
+	FilePath     string
+	Position     string
+	Opacity      float64
+	Scale        float64
+	RetainSource bool
+}
+
+const (
+	defaultWatermarkPosition = "bottom-right"
+	defaultWatermarkOpacity  = 0.5
+	defaultWatermarkScale    = 0.15
+)
+
+// watermarkPositions maps a position name to overlay filter coordinates,
+// keeping the watermark 10px away from the frame edges.
+var watermarkPositions = map[string]string{
+	"top-left":     "10:10",
+	"top-right":    "main_w-overlay_w-10:10",
+	"bottom-left":  "10:main_h-overlay_h-10",
+	"bottom-right": "main_w-overlay_w-10:main_h-overlay_h-10",
+	"center":       "(main_w-overlay_w)/2:(main_h-overlay_h)/2",
+}
+
+func validateWatermarkSettings(position string, opacity, scale float64) error {
+	if _, ok := watermarkPositions[position]; !ok {
+		return fmt.Errorf("unknown watermark position %q", position)
+	}
+	if opacity <= 0 || opacity > 1 {
+		return fmt.Errorf("watermark opacity must be in (0, 1], got %v", opacity)
+	}
+	if scale <= 0 || scale > 1 {
+		return fmt.Errorf("watermark scale must be in (0, 1], got %v", scale)
+	}
+	return nil
+}
+
+// loadDefaultWatermark reads the deployment-wide watermark from the environment.
+// It returns nil when WATERMARK_PATH isn't set.
+func loadDefaultWatermark() (*watermarkSettings, error) {
+	filePath := os.Getenv("WATERMARK_PATH")
+	if filePath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, fmt.Errorf("unable to read WATERMARK_PATH: %w", err)
+	}
+
+	settings := watermarkSettings{
+		FilePath: filePath,
+		Position: defaultWatermarkPosition,
+		Opacity:  defaultWatermarkOpacity,
+		Scale:    defaultWatermarkScale,
+	}
+	var err error
+	if position := os.Getenv("WATERMARK_POSITION"); position != "" {
+		settings.Position = position
+	}
+	if opacity := os.Getenv("WATERMARK_OPACITY"); opacity != "" {
+		settings.Opacity, err = strconv.ParseFloat(opacity, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WATERMARK_OPACITY: %w", err)
+		}
+	}
+	if scale := os.Getenv("WATERMARK_SCALE"); scale != "" {
+		settings.Scale, err = strconv.ParseFloat(scale, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WATERMARK_SCALE: %w", err)
+		}
+	}
+	if retainSource := os.Getenv("WATERMARK_RETAIN_SOURCE"); retainSource != "" {
+		settings.RetainSource, err = strconv.ParseBool(retainSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WATERMARK_RETAIN_SOURCE: %w", err)
+		}
+	}
+
+	err = validateWatermarkSettings(settings.Position, settings.Opacity, settings.Scale)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// getWatermarkSettings returns the user's own watermark when they have an
+// enabled one, falling back to the deployment default. Nil means no watermark.
+func (cfg *apiConfig) getWatermarkSettings(ctx context.Context, userID uuid.UUID) (*watermarkSettings, error) {
+	watermark, err := cfg.db.GetWatermark(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return cfg.defaultWatermark, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !watermark.Enabled {
+		return nil, nil
+	}
+
+	return &watermarkSettings{
+		FilePath:     watermark.FilePath,
+		Position:     watermark.Position,
+		Opacity:      watermark.Opacity,
+		Scale:        watermark.Scale,
+		RetainSource: watermark.RetainSource,
+	}, nil
+}
+
+// applyWatermark overlays the watermark image scaled relative to the video
+// width. Overlays can't be stream copied, so the video track is re-encoded.
+func applyWatermark(ctx context.Context, runner ffmpeg.Runner, filepath string, watermark watermarkSettings) (string, error) {
+	outputFilepath := fmt.Sprintf("%s.watermarked", filepath)
+	filter := fmt.Sprintf(
+		"[1:v][0:v]scale2ref=w=main_w*%s:h=ow/a[wm][base];[wm]format=rgba,colorchannelmixer=aa=%s[wmo];[base][wmo]overlay=%s[out]",
+		strconv.FormatFloat(watermark.Scale, 'f', -1, 64),
+		strconv.FormatFloat(watermark.Opacity, 'f', -1, 64),
+		watermarkPositions[watermark.Position],
+	)
+
+	_, err := runner.Run(ctx, "ffmpeg", "-y", "-i", filepath, "-i", watermark.FilePath,
+		"-filter_complex", filter, "-map", "[out]", "-map", "0:a?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-c:a", "copy",
+		"-f", "mp4", outputFilepath)
+	if err != nil {
+		return "", fmt.Errorf("unable to watermark %s: %w", filepath, err)
+	}
+
+	return outputFilepath, nil
+}